@@ -32,9 +32,28 @@ func main() {
 	}
 	defer grpcClients.Close() // Ensure connections are closed on shutdown
 
+	// Tokens are verified locally with the published keys; revocations are synced in the background
+	verifierConfig := authmw.DefaultVerifierConfig()
+	verifierConfig.Issuer = getEnv("JWT_ISSUER", verifierConfig.Issuer)
+	verifierConfig.Audience = getEnv("JWT_AUDIENCE", verifierConfig.Audience)
+	verifierConfig.MaxStaleness = getEnvDuration("REVOCATION_MAX_STALENESS", verifierConfig.MaxStaleness)
+	verifierConfig.AccessTokenTTL = getEnvDuration("ACCESS_TOKEN_TTL", verifierConfig.AccessTokenTTL)
+
+	verifierCtx, stopVerifier := context.WithCancel(context.Background())
+	defer stopVerifier()
+
+	tokenVerifier := authmw.NewTokenVerifier(grpcClients.AuthClient, verifierConfig)
+	go tokenVerifier.Run(verifierCtx)
+
+	// REQUIRE_VERIFIED_EMAIL=true keeps unverified users from changing their profile and addresses
+	requireVerified := func(next http.Handler) http.Handler { return next }
+	if getEnv("REQUIRE_VERIFIED_EMAIL", "false") == "true" {
+		requireVerified = authmw.RequireVerifiedEmail
+	}
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(grpcClients.AuthClient)
-	userHandler := handlers.NewUserHandler(grpcClients.UserClient)
+	userHandler := handlers.NewUserHandler(grpcClients.UserClient, grpcClients.AuthClient)
 
 	// Setup router with Chi
 	r := chi.NewRouter()
@@ -50,26 +69,124 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// Public keys for verifying access tokens (no auth required)
+	r.Get("/.well-known/jwks.json", authHandler.JWKS)
+
 	// API routes under /api/v1
 	r.Route("/api/v1", func(r chi.Router) {
 		// Auth routes (public - no authentication required)
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/register", authHandler.Register)
 			r.Post("/login", authHandler.Login)
+			r.Post("/refresh", authHandler.Refresh)
+
+			r.Post("/verify-email", authHandler.VerifyEmail)
+			r.Post("/verify-email/resend", authHandler.ResendVerification)
+
+			r.Route("/password", func(r chi.Router) {
+				r.Post("/forgot", authHandler.ForgotPassword)
+				r.Post("/reset", authHandler.ResetPassword)
+
+				// Changing a known password re-checks it; other sessions are signed out
+				r.With(authmw.AuthMiddleware(tokenVerifier), authmw.RequireUserToken).Post("/change", authHandler.ChangePassword)
+			})
+
+			// Email change: request sends a link to the new address, confirm is that link
+			r.Route("/email", func(r chi.Router) {
+				r.With(authmw.AuthMiddleware(tokenVerifier), authmw.RequireUserToken).Post("/change", authHandler.ChangeEmail)
+				r.Post("/confirm", authHandler.ConfirmEmailChange)
+			})
+
+			// Logout needs to know whose token it is revoking
+			r.With(authmw.AuthMiddleware(tokenVerifier), authmw.RequireUserToken).Post("/logout", authHandler.Logout)
+			r.With(authmw.AuthMiddleware(tokenVerifier), authmw.RequireUserToken).Get("/me", authHandler.Me)
+
+			// Sessions: one per login, so a lost device can be signed out on its own
+			r.Route("/sessions", func(r chi.Router) {
+				r.Use(authmw.AuthMiddleware(tokenVerifier))
+				r.Use(authmw.RequireUserToken)
+
+				r.Get("/", authHandler.ListSessions)
+				r.Delete("/{sessionId}", authHandler.RevokeSession)
+			})
+
+			// API keys for scripts; they are managed with a normal login, never with another key
+			r.Route("/api-keys", func(r chi.Router) {
+				r.Use(authmw.AuthMiddleware(tokenVerifier))
+				r.Use(authmw.RequireUserToken)
+
+				r.Post("/", authHandler.CreateAPIKey)
+				r.Get("/", authHandler.ListAPIKeys)
+				r.Delete("/{keyId}", authHandler.RevokeAPIKey)
+			})
+
+			// Social login: start redirects to the identity provider, which redirects back to callback
+			r.Route("/oauth", func(r chi.Router) {
+				r.Get("/providers", authHandler.OAuthProviders)
+				r.Get("/{provider}/start", authHandler.OAuthStart)
+				r.Get("/{provider}/callback", authHandler.OAuthCallback)
+			})
+
+			// Two-factor authentication: verify is the second login step, the rest manage the caller's own MFA
+			r.Route("/mfa", func(r chi.Router) {
+				r.Post("/verify", authHandler.VerifyMFA)
+
+				r.Group(func(r chi.Router) {
+					r.Use(authmw.AuthMiddleware(tokenVerifier))
+					r.Use(authmw.RequireUserToken)
+
+					r.Post("/enroll", authHandler.EnrollMFA)
+					r.Post("/confirm", authHandler.ConfirmMFA)
+					r.Post("/disable", authHandler.DisableMFA)
+					r.Post("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+				})
+			})
 		})
 
 		// User routes (protected - require authentication)
 		r.Route("/users", func(r chi.Router) {
 			// Apply auth middleware to all user routes
-			r.Use(authmw.AuthMiddleware(grpcClients.AuthClient))
+			r.Use(authmw.AuthMiddleware(tokenVerifier))
 
 			r.Get("/{id}", userHandler.GetUser)
-			r.Put("/{id}", userHandler.UpdateUser)
-			r.Delete("/{id}", userHandler.DeleteUser)
+			r.With(requireVerified).Put("/{id}", userHandler.UpdateUser)
+			r.With(requireVerified).Patch("/{id}", userHandler.PatchUser)
+			r.With(authmw.RequireUserToken).Delete("/{id}", userHandler.DeleteUser)
 
 			// Address sub-routes
-			r.Post("/{id}/addresses", userHandler.AddAddress)
+			r.With(requireVerified).Post("/{id}/addresses", userHandler.AddAddress)
 			r.Get("/{id}/addresses", userHandler.GetAddresses)
+			r.Get("/{id}/addresses/{addressId}", userHandler.GetAddress)
+			r.With(requireVerified).Put("/{id}/addresses/{addressId}", userHandler.UpdateAddress)
+			r.With(requireVerified).Delete("/{id}/addresses/{addressId}", userHandler.DeleteAddress)
+			r.With(requireVerified).Post("/{id}/addresses/{addressId}/default", userHandler.SetDefaultAddress)
+
+			// Preferences; not behind requireVerified so anyone can opt out of marketing
+			r.Get("/{id}/preferences", userHandler.GetPreferences)
+			r.Patch("/{id}/preferences", userHandler.UpdatePreferences)
+
+			// Data export (GDPR access requests): built in the background, then downloaded as a zip
+			r.Group(func(r chi.Router) {
+				r.Use(authmw.RequireUserToken)
+
+				r.Post("/{id}/export", userHandler.RequestDataExport)
+				r.Get("/{id}/exports/{exportId}", userHandler.GetDataExport)
+				r.Get("/{id}/exports/{exportId}/download", userHandler.DownloadDataExport)
+			})
+		})
+
+		// Admin routes: support staff (users:read:any) can search users, changing them takes users:write:any
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(authmw.AuthMiddleware(tokenVerifier))
+
+			r.With(authmw.RequirePermission(authmw.PermUsersReadAny)).Get("/users", userHandler.ListUsers)
+
+			r.Group(func(r chi.Router) {
+				r.Use(authmw.RequirePermission(authmw.PermUsersWriteAny))
+
+				r.Post("/users/{id}/unlock", authHandler.UnlockAccount)
+				r.Post("/users/{id}/undelete", authHandler.UndeleteAccount)
+			})
 		})
 
 		// TODO: Add product, order, payment routes as you build those services
@@ -120,3 +237,17 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvDuration parses a duration such as "30s" from the environment, falling back to the default
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("Invalid %s %q", key, value)
+	}
+	return d
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"api-gateway/internal/middleware"
+	authpb "go-project/proto/auth"
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewEmail        string `json:"new_email"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+type ConfirmEmailChangeResponse struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// ChangePassword handles POST /api/v1/auth/password/change
+// The caller stays logged in; every other session is signed out
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	// Wrong current passwords are throttled like failed logins
+	var trailer metadata.MD
+	_, err = h.authClient.ChangePassword(clientContext(r), &authpb.ChangePasswordRequest{
+		UserId:          middleware.GetUserID(r.Context()),
+		SessionId:       middleware.GetSessionID(r.Context()),
+		CurrentPassword: req.CurrentPassword,
+		NewPassword:     req.NewPassword,
+	}, grpc.Trailer(&trailer))
+	if err != nil {
+		log.Printf("gRPC ChangePassword error: %v", err)
+		if writeValidationError(w, "Password change failed", err) {
+			return
+		}
+		setRetryAfter(w, trailer)
+		http.Error(w, "Password change failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Password changed, other sessions have been signed out"})
+}
+
+// ChangeEmail handles POST /api/v1/auth/email/change
+// The new address gets a confirmation link; the email only changes once it is opened
+func (h *AuthHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewEmail == "" {
+		http.Error(w, "current_password and new_email are required", http.StatusBadRequest)
+		return
+	}
+
+	var trailer metadata.MD
+	grpcRes, err := h.authClient.RequestEmailChange(clientContext(r), &authpb.RequestEmailChangeRequest{
+		UserId:          middleware.GetUserID(r.Context()),
+		SessionId:       middleware.GetSessionID(r.Context()),
+		CurrentPassword: req.CurrentPassword,
+		NewEmail:        req.NewEmail,
+	}, grpc.Trailer(&trailer))
+	if err != nil {
+		log.Printf("gRPC RequestEmailChange error: %v", err)
+		setRetryAfter(w, trailer)
+		http.Error(w, "Email change failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(MessageResponse{Message: grpcRes.Message})
+}
+
+// ConfirmEmailChange handles POST /api/v1/auth/email/confirm
+func (h *AuthHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req ConfirmEmailChangeRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	grpcRes, err := h.authClient.ConfirmEmailChange(r.Context(), &authpb.ConfirmEmailChangeRequest{
+		Token: req.Token,
+	})
+	if err != nil {
+		log.Printf("gRPC ConfirmEmailChange error: %v", err)
+		http.Error(w, "Email change failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ConfirmEmailChangeResponse{
+		UserID: grpcRes.UserId,
+		Email:  grpcRes.Email,
+	})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"api-gateway/internal/middleware"
+	authpb "go-project/proto/auth"
+)
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`          // Permissions the key may use, e.g. "users:read:any"
+	ExpiresInDays int      `json:"expires_in_days"` // 0 for the default lifetime
+}
+
+// APIKeyResponse describes a key without its secret
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"` // Shown once; send it as the X-API-Key header
+}
+
+type ListAPIKeysResponse struct {
+	APIKeys []APIKeyResponse `json:"api_keys"`
+}
+
+// CreateAPIKey handles POST /api/v1/auth/api-keys
+func (h *AuthHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, "expires_in_days cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	grpcRes, err := h.authClient.CreateAPIKey(r.Context(), &authpb.CreateAPIKeyRequest{
+		UserId:    middleware.GetUserID(r.Context()),
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresIn: int64(req.ExpiresInDays) * 24 * 60 * 60,
+	})
+	if err != nil {
+		log.Printf("gRPC CreateAPIKey error: %v", err)
+		http.Error(w, "Failed to create API key: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := CreateAPIKeyResponse{
+		APIKeyResponse: apiKeyResponse(grpcRes.ApiKey),
+		Key:            grpcRes.Key,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListAPIKeys handles GET /api/v1/auth/api-keys
+func (h *AuthHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	grpcRes, err := h.authClient.ListAPIKeys(r.Context(), &authpb.ListAPIKeysRequest{
+		UserId: middleware.GetUserID(r.Context()),
+	})
+	if err != nil {
+		log.Printf("gRPC ListAPIKeys error: %v", err)
+		http.Error(w, "Failed to list API keys", httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := ListAPIKeysResponse{APIKeys: make([]APIKeyResponse, 0, len(grpcRes.ApiKeys))}
+	for _, k := range grpcRes.ApiKeys {
+		resp.APIKeys = append(resp.APIKeys, apiKeyResponse(k))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeAPIKey handles DELETE /api/v1/auth/api-keys/{keyId}
+// Gateways stop accepting the key within the token cache window (see VerifierConfig.MaxStaleness)
+func (h *AuthHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	_, err := h.authClient.RevokeAPIKey(r.Context(), &authpb.RevokeAPIKeyRequest{
+		UserId: middleware.GetUserID(r.Context()),
+		KeyId:  chi.URLParam(r, "keyId"),
+	})
+	if err != nil {
+		log.Printf("gRPC RevokeAPIKey error: %v", err)
+		http.Error(w, "Failed to revoke API key: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "API key revoked"})
+}
+
+func apiKeyResponse(k *authpb.APIKey) APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:        k.Id,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    k.Scopes,
+		CreatedAt: time.Unix(k.CreatedAt, 0).UTC(),
+		ExpiresAt: time.Unix(k.ExpiresAt, 0).UTC(),
+	}
+	if resp.Scopes == nil {
+		resp.Scopes = []string{}
+	}
+	if k.LastUsedAt != 0 {
+		lastUsed := time.Unix(k.LastUsedAt, 0).UTC()
+		resp.LastUsedAt = &lastUsed
+	}
+	return resp
+}
@@ -5,7 +5,13 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"api-gateway/internal/middleware"
 	authpb "go-project/proto/auth"
 )
 
@@ -36,9 +42,94 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token  string `json:"token"`
-	UserID string `json:"user_id"`
-	Name   string `json:"name"`
+	Token        string   `json:"token"`
+	UserID       string   `json:"user_id"`
+	Name         string   `json:"name"`
+	Email        string   `json:"email"`
+	Roles        []string `json:"roles"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int64    `json:"expires_in"`
+
+	// With two-factor authentication the tokens are empty; post the mfa_token and a code to /auth/mfa/verify
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	AllSessions  bool   `json:"all_sessions"` // Sign out everywhere, not just this device
+}
+
+type LogoutResponse struct {
+	Message string `json:"message"`
+}
+
+// JWK is a public signing key as published in the JWKS document
+type JWK struct {
+	KID string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// MeResponse describes the authenticated caller and the token they presented
+type MeResponse struct {
+	UserID        string    `json:"user_id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	EmailVerified bool      `json:"email_verified"`
+	Roles         []string  `json:"roles"`
+	Permissions   []string  `json:"permissions"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastLogin     time.Time `json:"last_login"`
+	Session       MeSession `json:"session"`
+}
+
+type MeSession struct {
+	ID        string    `json:"id"`
+	TokenID   string    `json:"token_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RefreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 // TODO(human): Implement Register handler
@@ -72,7 +163,10 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("gRPC Register error: %v", err)
-		http.Error(w, "Registration failed: "+err.Error(), http.StatusInternalServerError)
+		if writeValidationError(w, "Registration failed", err) {
+			return
+		}
+		http.Error(w, "Registration failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -113,21 +207,368 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Password: req.Password,
 	}
 
-	grpcRes, err := h.authClient.Login(r.Context(), grpcReq)
+	// auth-service throttles failed logins per client IP and records the device of the new session
+	ctx := clientContext(r)
+
+	var trailer metadata.MD
+	grpcRes, err := h.authClient.Login(ctx, grpcReq, grpc.Trailer(&trailer))
 	if err != nil {
 		log.Printf("gRPC Login error: %v", err)
-		http.Error(w, "Login failed: "+err.Error(), http.StatusUnauthorized) // 401 for auth failures
+		// 401 bad credentials, 429 backing off, 423 locked, 403 unverified email
+		setRetryAfter(w, trailer)
+		http.Error(w, "Login failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 
 	resp := LoginResponse{
-		Token:  grpcRes.Token,
-		UserID: grpcRes.UserId,
-		Name:   grpcRes.Name,
+		Token:        grpcRes.Token,
+		UserID:       grpcRes.UserId,
+		Name:         grpcRes.Name,
+		Email:        grpcRes.Email,
+		Roles:        grpcRes.Roles,
+		RefreshToken: grpcRes.RefreshToken,
+		ExpiresIn:    grpcRes.ExpiresIn,
+		MFARequired:  grpcRes.MfaRequired,
+		MFAToken:     grpcRes.MfaToken,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+
+}
+
+// Me handles GET /api/v1/auth/me
+// This is a protected route - returns who the bearer token belongs to
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	grpcRes, err := h.authClient.GetMe(r.Context(), &authpb.GetMeRequest{
+		Token: middleware.GetToken(r.Context()),
+	})
+	if err != nil {
+		log.Printf("gRPC GetMe error: %v", err)
+		http.Error(w, "Failed to get current user: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := MeResponse{
+		UserID:        grpcRes.UserId,
+		Email:         grpcRes.Email,
+		Name:          grpcRes.Name,
+		EmailVerified: grpcRes.EmailVerified,
+		Roles:         grpcRes.Roles,
+		Permissions:   grpcRes.Permissions,
+		MFAEnabled:    grpcRes.MfaEnabled,
+		CreatedAt:     time.Unix(grpcRes.CreatedAt, 0).UTC(),
+		LastLogin:     time.Unix(grpcRes.LastLogin, 0).UTC(),
+		Session: MeSession{
+			ID:        grpcRes.SessionId,
+			TokenID:   grpcRes.TokenId,
+			IssuedAt:  time.Unix(grpcRes.IssuedAt, 0).UTC(),
+			ExpiresAt: time.Unix(grpcRes.ExpiresAt, 0).UTC(),
+		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resp)
+}
 
+// Refresh handles POST /api/v1/auth/refresh
+// The refresh token is single-use: the response carries the replacement that must be used next time
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	grpcRes, err := h.authClient.RefreshToken(clientContext(r), &authpb.RefreshTokenRequest{
+		RefreshToken: req.RefreshToken,
+	})
+	if err != nil {
+		log.Printf("gRPC RefreshToken error: %v", err)
+		http.Error(w, "Refresh failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := RefreshResponse{
+		Token:        grpcRes.Token,
+		RefreshToken: grpcRes.RefreshToken,
+		ExpiresIn:    grpcRes.ExpiresIn,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Logout handles POST /api/v1/auth/logout
+// This is a protected route - the bearer token is revoked, along with the refresh token if provided
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req LogoutRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// The body is optional: a bare POST just revokes the access token
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	_, err = h.authClient.Logout(r.Context(), &authpb.LogoutRequest{
+		Token:        middleware.GetToken(r.Context()),
+		RefreshToken: req.RefreshToken,
+	})
+	if err != nil {
+		log.Printf("gRPC Logout error: %v", err)
+		http.Error(w, "Logout failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	if req.AllSessions {
+		_, err = h.authClient.RevokeAllSessions(r.Context(), &authpb.RevokeAllSessionsRequest{
+			UserId: middleware.GetUserID(r.Context()),
+		})
+		if err != nil {
+			log.Printf("gRPC RevokeAllSessions error: %v", err)
+			http.Error(w, "Failed to revoke sessions: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+			return
+		}
+	}
+
+	resp := LogoutResponse{
+		Message: "Logged out successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// JWKS handles GET /.well-known/jwks.json
+// Services verify access tokens locally with these keys instead of calling ValidateToken
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	grpcRes, err := h.authClient.GetJWKS(r.Context(), &authpb.GetJWKSRequest{})
+	if err != nil {
+		log.Printf("gRPC GetJWKS error: %v", err)
+		http.Error(w, "Failed to get signing keys", http.StatusBadGateway)
+		return
+	}
+
+	resp := JWKSResponse{Keys: make([]JWK, 0, len(grpcRes.Keys))}
+	for _, k := range grpcRes.Keys {
+		resp.Keys = append(resp.Keys, JWK{
+			KID: k.Kid,
+			Kty: k.Kty,
+			Alg: k.Alg,
+			Use: k.Use,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+		})
+	}
+
+	// Keys change at most once per rotation, so clients may cache briefly
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ForgotPassword handles POST /api/v1/auth/password/forgot
+// Always answers 202 so callers cannot tell whether the email is registered
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	grpcRes, err := h.authClient.RequestPasswordReset(r.Context(), &authpb.RequestPasswordResetRequest{
+		Email: req.Email,
+	})
+	if err != nil {
+		log.Printf("gRPC RequestPasswordReset error: %v", err)
+		http.Error(w, "Failed to request password reset", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(MessageResponse{Message: grpcRes.Message})
+}
+
+// ResetPassword handles POST /api/v1/auth/password/reset
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.NewPassword == "" {
+		http.Error(w, "Token and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.authClient.ResetPassword(r.Context(), &authpb.ResetPasswordRequest{
+		Token:       req.Token,
+		NewPassword: req.NewPassword,
+	})
+	if err != nil {
+		log.Printf("gRPC ResetPassword error: %v", err)
+		if writeValidationError(w, "Password reset failed", err) {
+			return
+		}
+		http.Error(w, "Password reset failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Password has been reset, please log in again"})
+}
+
+// VerifyEmail handles POST /api/v1/auth/verify-email
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	grpcRes, err := h.authClient.VerifyEmail(r.Context(), &authpb.VerifyEmailRequest{
+		Token: req.Token,
+	})
+	if err != nil {
+		log.Printf("gRPC VerifyEmail error: %v", err)
+		http.Error(w, "Email verification failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: grpcRes.Message})
+}
+
+// ResendVerification handles POST /api/v1/auth/verify-email/resend
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	grpcRes, err := h.authClient.ResendVerificationEmail(r.Context(), &authpb.ResendVerificationEmailRequest{
+		Email: req.Email,
+	})
+	if err != nil {
+		log.Printf("gRPC ResendVerificationEmail error: %v", err)
+		http.Error(w, "Failed to resend verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(MessageResponse{Message: grpcRes.Message})
+}
+
+// UnlockAccount handles POST /api/v1/admin/users/{id}/unlock
+// Clears failed logins so a locked-out user can sign in before the lock expires
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	_, err := h.authClient.UnlockAccount(r.Context(), &authpb.UnlockAccountRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		log.Printf("gRPC UnlockAccount error: %v", err)
+		http.Error(w, "Failed to unlock account: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Account unlocked"})
+}
+
+// UndeleteAccount handles POST /api/v1/admin/users/{id}/undelete
+// Restores a deleted account during its grace period; the user logs in again afterwards
+func (h *AuthHandler) UndeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	_, err := h.authClient.UndeleteAccount(r.Context(), &authpb.UndeleteAccountRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		log.Printf("gRPC UndeleteAccount error: %v", err)
+		http.Error(w, "Failed to restore account: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Account restored"})
 }
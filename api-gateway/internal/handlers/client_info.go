@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// clientContext forwards the end user's IP and user agent to auth-service in gRPC metadata.
+// They drive login throttling and describe the device of each session.
+func clientContext(r *http.Request) context.Context {
+	return metadata.AppendToOutgoingContext(r.Context(),
+		"x-client-ip", clientIP(r),
+		"x-user-agent", r.UserAgent(),
+	)
+}
+
+// clientIP is the address of the connecting client.
+// X-Forwarded-For is deliberately ignored: anyone could set it and dodge per-IP throttling.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authpb "go-project/proto/auth"
+)
+
+// DataExportResponse describes a data export; download_url is set once it is ready
+type DataExportResponse struct {
+	ID          string     `json:"export_id"`
+	Status      string     `json:"status"` // pending, running, ready or failed
+	StatusURL   string     `json:"status_url"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // The export can no longer be downloaded after this
+	Error       string     `json:"error,omitempty"`
+}
+
+// dataExportResponse converts a protobuf DataExport to JSON
+func dataExportResponse(userID string, export *authpb.DataExport) DataExportResponse {
+	resp := DataExportResponse{
+		ID:        export.Id,
+		Status:    export.Status,
+		StatusURL: fmt.Sprintf("/api/v1/users/%s/exports/%s", userID, export.Id),
+		CreatedAt: time.Unix(export.CreatedAt, 0).UTC(),
+		Error:     export.Error,
+	}
+	if export.Status == "ready" {
+		resp.DownloadURL = resp.StatusURL + "/download"
+	}
+	if export.CompletedAt != 0 {
+		completedAt := time.Unix(export.CompletedAt, 0).UTC()
+		resp.CompletedAt = &completedAt
+	}
+	if export.ExpiresAt != 0 {
+		expiresAt := time.Unix(export.ExpiresAt, 0).UTC()
+		resp.ExpiresAt = &expiresAt
+	}
+	return resp
+}
+
+// RequestDataExport handles POST /api/v1/users/:id/export
+// The export is built in the background: the response is 202 Accepted with the status URL to poll
+// in the Location header. Asking again while an export is in progress returns that export.
+func (h *UserHandler) RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grpcResp, err := h.authClient.RequestDataExport(r.Context(), &authpb.RequestDataExportRequest{
+		UserId: requestedUserID,
+	})
+	if err != nil {
+		log.Printf("gRPC RequestDataExport error: %v", err)
+		http.Error(w, "Failed to request data export: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := dataExportResponse(requestedUserID, grpcResp.Export)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", resp.StatusURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetDataExport handles GET /api/v1/users/:id/exports/:exportId
+func (h *UserHandler) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grpcResp, err := h.authClient.GetDataExport(r.Context(), &authpb.GetDataExportRequest{
+		UserId:   requestedUserID,
+		ExportId: chi.URLParam(r, "exportId"),
+	})
+	if err != nil {
+		log.Printf("gRPC GetDataExport error: %v", err)
+		http.Error(w, "Failed to get data export: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dataExportResponse(requestedUserID, grpcResp.Export))
+}
+
+// DownloadDataExport handles GET /api/v1/users/:id/exports/:exportId/download
+// It answers 409 Conflict while the export is not ready yet.
+func (h *UserHandler) DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grpcResp, err := h.authClient.DownloadDataExport(r.Context(), &authpb.DownloadDataExportRequest{
+		UserId:   requestedUserID,
+		ExportId: chi.URLParam(r, "exportId"),
+	})
+	if err != nil {
+		if status.Code(err) == codes.FailedPrecondition {
+			http.Error(w, grpcErrorMessage(err), http.StatusConflict)
+			return
+		}
+		log.Printf("gRPC DownloadDataExport error: %v", err)
+		http.Error(w, "Failed to download data export: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", grpcResp.Filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(grpcResp.Archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(grpcResp.Archive)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// FieldError is one invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is the 400 body for requests with invalid fields
+type ValidationErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// httpStatus maps the status code of a failed gRPC call to an HTTP status, using fallback for the rest
+func httpStatus(err error, fallback int) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusLocked
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusBadGateway
+	default:
+		return fallback
+	}
+}
+
+// grpcErrorMessage strips the "rpc error: code = ..." prefix from a gRPC error
+func grpcErrorMessage(err error) string {
+	if s, ok := status.FromError(err); ok {
+		return s.Message()
+	}
+	return err.Error()
+}
+
+// setRetryAfter copies the retry-after trailer of a throttled call into the Retry-After header
+func setRetryAfter(w http.ResponseWriter, trailer metadata.MD) {
+	if values := trailer.Get("retry-after"); len(values) > 0 {
+		w.Header().Set("Retry-After", values[0])
+	}
+}
+
+// writeValidationError renders the field violations of an INVALID_ARGUMENT error as a JSON 400.
+// It returns false, writing nothing, if the error carries no field details.
+func writeValidationError(w http.ResponseWriter, message string, err error) bool {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.InvalidArgument {
+		return false
+	}
+
+	resp := ValidationErrorResponse{Error: message}
+	for _, detail := range s.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.FieldViolations {
+				resp.Fields = append(resp.Fields, FieldError{
+					Field:   v.Field,
+					Code:    v.Reason,
+					Message: v.Description,
+				})
+			}
+		}
+	}
+	if len(resp.Fields) == 0 {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(resp)
+	return true
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"api-gateway/internal/middleware"
+	authpb "go-project/proto/auth"
+)
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // TOTP or recovery code
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAChangeRequest turns MFA off or replaces recovery codes; both factors are required
+type MFAChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"` // TOTP or recovery code
+}
+
+type EnrollMFAResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// VerifyMFA handles POST /api/v1/auth/mfa/verify
+// Second step of a login for accounts with two-factor authentication
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req VerifyMFARequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		http.Error(w, "mfa_token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	// Wrong codes count as failed logins; a correct one starts a session for this device
+	ctx := clientContext(r)
+
+	var trailer metadata.MD
+	grpcRes, err := h.authClient.VerifyMFA(ctx, &authpb.VerifyMFARequest{
+		MfaToken: req.MFAToken,
+		Code:     req.Code,
+	}, grpc.Trailer(&trailer))
+	if err != nil {
+		log.Printf("gRPC VerifyMFA error: %v", err)
+		setRetryAfter(w, trailer)
+		http.Error(w, "Verification failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := LoginResponse{
+		Token:        grpcRes.Token,
+		UserID:       grpcRes.UserId,
+		Name:         grpcRes.Name,
+		Email:        grpcRes.Email,
+		Roles:        grpcRes.Roles,
+		RefreshToken: grpcRes.RefreshToken,
+		ExpiresIn:    grpcRes.ExpiresIn,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// EnrollMFA handles POST /api/v1/auth/mfa/enroll
+// Returns a new secret; two-factor authentication is enabled once a code is confirmed
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	grpcRes, err := h.authClient.EnrollMFA(r.Context(), &authpb.EnrollMFARequest{
+		UserId: middleware.GetUserID(r.Context()),
+	})
+	if err != nil {
+		log.Printf("gRPC EnrollMFA error: %v", err)
+		http.Error(w, "Enrollment failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := EnrollMFAResponse{
+		Secret:     grpcRes.Secret,
+		OtpauthURI: grpcRes.OtpauthUri,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ConfirmMFA handles POST /api/v1/auth/mfa/confirm
+// The recovery codes in the response are never shown again
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	grpcRes, err := h.authClient.ConfirmMFA(r.Context(), &authpb.ConfirmMFARequest{
+		UserId: middleware.GetUserID(r.Context()),
+		Code:   req.Code,
+	})
+	if err != nil {
+		log.Printf("gRPC ConfirmMFA error: %v", err)
+		http.Error(w, "Confirmation failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: grpcRes.RecoveryCodes})
+}
+
+// DisableMFA handles POST /api/v1/auth/mfa/disable
+func (h *AuthHandler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMFAChange(w, r)
+	if !ok {
+		return
+	}
+
+	// Wrong passwords and codes are throttled like failed logins
+	var trailer metadata.MD
+	_, err := h.authClient.DisableMFA(clientContext(r), &authpb.DisableMFARequest{
+		UserId:          middleware.GetUserID(r.Context()),
+		Code:            req.Code,
+		CurrentPassword: req.CurrentPassword,
+	}, grpc.Trailer(&trailer))
+	if err != nil {
+		log.Printf("gRPC DisableMFA error: %v", err)
+		setRetryAfter(w, trailer)
+		http.Error(w, "Failed to disable two-factor authentication: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes handles POST /api/v1/auth/mfa/recovery-codes
+// Invalidates all previous recovery codes
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMFAChange(w, r)
+	if !ok {
+		return
+	}
+
+	var trailer metadata.MD
+	grpcRes, err := h.authClient.RegenerateRecoveryCodes(clientContext(r), &authpb.RegenerateRecoveryCodesRequest{
+		UserId:          middleware.GetUserID(r.Context()),
+		Code:            req.Code,
+		CurrentPassword: req.CurrentPassword,
+	}, grpc.Trailer(&trailer))
+	if err != nil {
+		log.Printf("gRPC RegenerateRecoveryCodes error: %v", err)
+		setRetryAfter(w, trailer)
+		http.Error(w, "Failed to regenerate recovery codes: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: grpcRes.RecoveryCodes})
+}
+
+// decodeMFACode reads a {"code": "..."} body, writing the error response itself on failure
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (MFACodeRequest, bool) {
+	var req MFACodeRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return req, false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
+
+// decodeMFAChange reads a {"current_password": "...", "code": "..."} body, writing the error response itself on failure
+func decodeMFAChange(w http.ResponseWriter, r *http.Request) (MFAChangeRequest, bool) {
+	var req MFAChangeRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return req, false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.CurrentPassword == "" || req.Code == "" {
+		http.Error(w, "current_password and code are required", http.StatusBadRequest)
+		return req, false
+	}
+
+	return req, true
+}
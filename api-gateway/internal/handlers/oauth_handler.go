@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	authpb "go-project/proto/auth"
+)
+
+type OAuthProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+type OAuthLoginResponse struct {
+	LoginResponse
+	NewUser bool `json:"new_user"` // The account was created by this login
+}
+
+// OAuthProviders handles GET /api/v1/auth/oauth/providers
+func (h *AuthHandler) OAuthProviders(w http.ResponseWriter, r *http.Request) {
+	grpcRes, err := h.authClient.ListOAuthProviders(r.Context(), &authpb.ListOAuthProvidersRequest{})
+	if err != nil {
+		log.Printf("gRPC ListOAuthProviders error: %v", err)
+		http.Error(w, "Failed to list identity providers", httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	providers := grpcRes.Providers
+	if providers == nil {
+		providers = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(OAuthProvidersResponse{Providers: providers})
+}
+
+// OAuthStart handles GET /api/v1/auth/oauth/{provider}/start
+// Redirects the browser to the identity provider's sign-in page
+func (h *AuthHandler) OAuthStart(w http.ResponseWriter, r *http.Request) {
+	grpcRes, err := h.authClient.StartOAuthLogin(r.Context(), &authpb.StartOAuthLoginRequest{
+		Provider: chi.URLParam(r, "provider"),
+	})
+	if err != nil {
+		log.Printf("gRPC StartOAuthLogin error: %v", err)
+		http.Error(w, "Failed to start login: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	http.Redirect(w, r, grpcRes.AuthorizationUrl, http.StatusFound)
+}
+
+// OAuthCallback handles GET /api/v1/auth/oauth/{provider}/callback
+// The identity provider redirects here with ?code=...&state=... (or ?error=... if the user declined)
+func (h *AuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		msg := providerErr
+		if desc := query.Get("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		http.Error(w, "Login was not completed: "+msg, http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("code") == "" || query.Get("state") == "" {
+		http.Error(w, "code and state are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := clientContext(r)
+
+	var trailer metadata.MD
+	grpcRes, err := h.authClient.CompleteOAuthLogin(ctx, &authpb.CompleteOAuthLoginRequest{
+		Provider: chi.URLParam(r, "provider"),
+		State:    query.Get("state"),
+		Code:     query.Get("code"),
+	}, grpc.Trailer(&trailer))
+	if err != nil {
+		log.Printf("gRPC CompleteOAuthLogin error: %v", err)
+		setRetryAfter(w, trailer)
+		http.Error(w, "Login failed: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := OAuthLoginResponse{
+		LoginResponse: LoginResponse{
+			Token:        grpcRes.Token,
+			UserID:       grpcRes.UserId,
+			Name:         grpcRes.Name,
+			Email:        grpcRes.Email,
+			Roles:        grpcRes.Roles,
+			RefreshToken: grpcRes.RefreshToken,
+			ExpiresIn:    grpcRes.ExpiresIn,
+			MFARequired:  grpcRes.MfaRequired,
+			MFAToken:     grpcRes.MfaToken,
+		},
+		NewUser: grpcRes.NewUser,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	userpb "go-project/proto/user"
+)
+
+// PreferencesResponse holds a user's settings for the storefront and notifications
+type PreferencesResponse struct {
+	Locale               string     `json:"locale"`
+	Currency             string     `json:"currency"`
+	Timezone             string     `json:"timezone"`
+	MarketingEmail       bool       `json:"marketing_email"`
+	MarketingSMS         bool       `json:"marketing_sms"`
+	NotificationChannels []string   `json:"notification_channels"`
+	UpdatedAt            *time.Time `json:"updated_at,omitempty"` // Missing while the user has the defaults
+}
+
+// preferencesResponse converts protobuf Preferences to JSON
+func preferencesResponse(prefs *userpb.Preferences) PreferencesResponse {
+	resp := PreferencesResponse{
+		Locale:               prefs.Locale,
+		Currency:             prefs.Currency,
+		Timezone:             prefs.Timezone,
+		MarketingEmail:       prefs.MarketingEmail,
+		MarketingSMS:         prefs.MarketingSms,
+		NotificationChannels: prefs.NotificationChannels,
+	}
+	if resp.NotificationChannels == nil {
+		resp.NotificationChannels = []string{}
+	}
+	if prefs.UpdatedAt != nil {
+		updatedAt := prefs.UpdatedAt.AsTime()
+		resp.UpdatedAt = &updatedAt
+	}
+	return resp
+}
+
+// GetPreferences handles GET /api/v1/users/:id/preferences
+func (h *UserHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grpcResp, err := h.userClient.GetPreferences(r.Context(), &userpb.GetPreferencesRequest{
+		UserId: requestedUserID,
+	})
+	if err != nil {
+		log.Printf("gRPC GetPreferences error: %v", err)
+		http.Error(w, "Failed to get preferences: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if grpcResp.Error != "" {
+		http.Error(w, grpcResp.Error, userServiceErrorStatus(grpcResp.Error))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferencesResponse(grpcResp.Preferences))
+}
+
+// UpdatePreferences handles PATCH /api/v1/users/:id/preferences with a JSON merge patch:
+// only the preferences in the body change. Preferences always have a value, so null is refused.
+func (h *UserHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	prefs := &userpb.Preferences{}
+	mask := &fieldmaskpb.FieldMask{}
+	for field, raw := range patch {
+		if string(raw) == "null" {
+			http.Error(w, fmt.Sprintf("%s cannot be null", field), http.StatusBadRequest)
+			return
+		}
+
+		var target any
+		switch field {
+		case "locale":
+			target = &prefs.Locale
+		case "currency":
+			target = &prefs.Currency
+		case "timezone":
+			target = &prefs.Timezone
+		case "marketing_email":
+			target = &prefs.MarketingEmail
+		case "marketing_sms":
+			target = &prefs.MarketingSms
+		case "notification_channels":
+			target = &prefs.NotificationChannels
+		default:
+			http.Error(w, fmt.Sprintf("Unknown preference %q", field), http.StatusBadRequest)
+			return
+		}
+
+		if err := json.Unmarshal(raw, target); err != nil {
+			http.Error(w, fmt.Sprintf("%s has the wrong type", field), http.StatusBadRequest)
+			return
+		}
+		mask.Paths = append(mask.Paths, field)
+	}
+
+	if len(mask.Paths) == 0 {
+		http.Error(w, "At least one preference must be provided", http.StatusBadRequest)
+		return
+	}
+
+	grpcResp, err := h.userClient.UpdatePreferences(r.Context(), &userpb.UpdatePreferencesRequest{
+		UserId:      requestedUserID,
+		Preferences: prefs,
+		UpdateMask:  mask,
+	})
+	if err != nil {
+		log.Printf("gRPC UpdatePreferences error: %v", err)
+		http.Error(w, "Failed to update preferences: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if grpcResp.Error != "" {
+		http.Error(w, grpcResp.Error, userServiceErrorStatus(grpcResp.Error))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferencesResponse(grpcResp.Preferences))
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"api-gateway/internal/middleware"
+	authpb "go-project/proto/auth"
+)
+
+// SessionResponse is one device the user is logged in on
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"` // The session making this request
+}
+
+type ListSessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// ListSessions handles GET /api/v1/auth/sessions
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	grpcRes, err := h.authClient.ListSessions(r.Context(), &authpb.ListSessionsRequest{
+		UserId:           middleware.GetUserID(r.Context()),
+		CurrentSessionId: middleware.GetSessionID(r.Context()),
+	})
+	if err != nil {
+		log.Printf("gRPC ListSessions error: %v", err)
+		http.Error(w, "Failed to list sessions", httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resp := ListSessionsResponse{Sessions: make([]SessionResponse, 0, len(grpcRes.Sessions))}
+	for _, s := range grpcRes.Sessions {
+		resp.Sessions = append(resp.Sessions, SessionResponse{
+			ID:         s.Id,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IpAddress,
+			CreatedAt:  time.Unix(s.CreatedAt, 0).UTC(),
+			LastSeenAt: time.Unix(s.LastSeenAt, 0).UTC(),
+			Current:    s.Current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeSession handles DELETE /api/v1/auth/sessions/{sessionId}
+// Signs that device out without touching the password or the other sessions
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	_, err := h.authClient.RevokeSession(r.Context(), &authpb.RevokeSessionRequest{
+		UserId:    middleware.GetUserID(r.Context()),
+		SessionId: chi.URLParam(r, "sessionId"),
+	})
+	if err != nil {
+		log.Printf("gRPC RevokeSession error: %v", err)
+		http.Error(w, "Failed to revoke session: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Session revoked"})
+}
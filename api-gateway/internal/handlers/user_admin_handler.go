@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	userpb "go-project/proto/user"
+)
+
+// AdminUserResponse is a user as the back office sees it
+type AdminUserResponse struct {
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	Name      string     `json:"name"`
+	Phone     string     `json:"phone"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type ListUsersResponse struct {
+	Users         []AdminUserResponse `json:"users"`
+	NextPageToken string              `json:"next_page_token,omitempty"` // Pass as page_token for the next page
+	TotalCount    int64               `json:"total_count"`
+}
+
+// ListUsers handles GET /api/v1/admin/users
+// Query parameters: email and name (prefixes), created_after and created_before (RFC 3339),
+// include_deleted, sort (created_at, email or name), order (asc or desc), page_size and page_token
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	var err error
+	query := r.URL.Query()
+	req := &userpb.ListUsersRequest{
+		EmailPrefix: query.Get("email"),
+		NamePrefix:  query.Get("name"),
+		SortBy:      query.Get("sort"),
+		PageToken:   query.Get("page_token"),
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		req.Descending = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	if v := query.Get("include_deleted"); v != "" {
+		includeDeleted, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "include_deleted must be true or false", http.StatusBadRequest)
+			return
+		}
+		req.IncludeDeleted = includeDeleted
+	}
+
+	if v := query.Get("page_size"); v != "" {
+		pageSize, err := strconv.Atoi(v)
+		if err != nil || pageSize < 1 {
+			http.Error(w, "page_size must be a positive number", http.StatusBadRequest)
+			return
+		}
+		// user-service caps the page size; this only keeps huge values from overflowing
+		req.PageSize = int32(min(pageSize, 1000))
+	}
+
+	if req.CreatedAfter, err = timeParam(query, "created_after"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.CreatedBefore, err = timeParam(query, "created_before"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	grpcResp, err := h.userClient.ListUsers(r.Context(), req)
+	if err != nil {
+		log.Printf("gRPC ListUsers error: %v", err)
+		http.Error(w, "Failed to list users", httpStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	if grpcResp.Error != "" {
+		http.Error(w, grpcResp.Error, http.StatusBadRequest)
+		return
+	}
+
+	resp := ListUsersResponse{
+		Users:         make([]AdminUserResponse, 0, len(grpcResp.Users)),
+		NextPageToken: grpcResp.NextPageToken,
+		TotalCount:    grpcResp.TotalCount,
+	}
+	for _, u := range grpcResp.Users {
+		user := AdminUserResponse{
+			ID:        u.Id,
+			Email:     u.Email,
+			Name:      u.Name,
+			Phone:     u.Phone,
+			CreatedAt: u.CreatedAt.AsTime(),
+			UpdatedAt: u.UpdatedAt.AsTime(),
+		}
+		if u.DeletedAt != nil {
+			deletedAt := u.DeletedAt.AsTime()
+			user.DeletedAt = &deletedAt
+		}
+		resp.Users = append(resp.Users, user)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// timeParam reads an optional RFC 3339 query parameter
+func timeParam(query url.Values, name string) (*timestamppb.Timestamp, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time, e.g. 2024-01-31T00:00:00Z", name)
+	}
+	return timestamppb.New(t), nil
+}
@@ -3,23 +3,31 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
 	"api-gateway/internal/middleware"
+	authpb "go-project/proto/auth"
 	userpb "go-project/proto/user"
 )
 
 // UserHandler handles user-related HTTP endpoints
 type UserHandler struct {
 	userClient userpb.UserServiceClient
+	authClient authpb.AuthServiceClient // Account deletion starts in auth-service, which owns the credentials
 }
 
-func NewUserHandler(userClient userpb.UserServiceClient) *UserHandler {
-	return &UserHandler{userClient: userClient}
+func NewUserHandler(userClient userpb.UserServiceClient, authClient authpb.AuthServiceClient) *UserHandler {
+	return &UserHandler{userClient: userClient, authClient: authClient}
 }
 
 // Request/Response types
@@ -36,30 +44,64 @@ type UserResponse struct {
 }
 
 type AddAddressRequest struct {
-	Street     string `json:"street"`
-	City       string `json:"city"`
-	State      string `json:"state"`
-	PostalCode string `json:"postal_code"`
-	Country    string `json:"country"`
-	IsDefault  bool   `json:"is_default"`
+	Type          string `json:"type"` // shipping, billing or both (default)
+	Label         string `json:"label"`
+	RecipientName string `json:"recipient_name"`
+	Phone         string `json:"phone"`
+	Street        string `json:"street"`
+	City          string `json:"city"`
+	State         string `json:"state"`
+	PostalCode    string `json:"postal_code"`
+	Country       string `json:"country"`
+	IsDefault     bool   `json:"is_default"` // default for every purpose the type covers
+}
+
+// UpdateAddressRequest replaces every field of an address but the default flags, which change only
+// if is_default is sent
+type UpdateAddressRequest struct {
+	AddAddressRequest
+	IsDefault *bool `json:"is_default"`
 }
 
 type AddressResponse struct {
-	ID         string `json:"id"`
-	Street     string `json:"street"`
-	City       string `json:"city"`
-	State      string `json:"state"`
-	PostalCode string `json:"postal_code"`
-	Country    string `json:"country"`
-	IsDefault  bool   `json:"is_default"`
+	ID                string `json:"id"`
+	Type              string `json:"type"`
+	Label             string `json:"label"`
+	RecipientName     string `json:"recipient_name"`
+	Phone             string `json:"phone"`
+	Street            string `json:"street"`
+	City              string `json:"city"`
+	State             string `json:"state"`
+	PostalCode        string `json:"postal_code"`
+	Country           string `json:"country"`
+	IsDefault         bool   `json:"is_default"`
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
 }
 
-type DeleteUserResponse struct {
+// AddressSuggestion is a correction proposed by address verification; the address is saved as sent
+type AddressSuggestion struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
 	Message string `json:"message"`
 }
 
+// SavedAddressResponse is returned when an address is added or updated
+type SavedAddressResponse struct {
+	AddressResponse
+	Suggestions []AddressSuggestion `json:"suggestions,omitempty"`
+}
+
+type DeleteUserResponse struct {
+	Message    string `json:"message"`
+	PurgeAfter string `json:"purge_after"` // RFC 3339; the account can be restored until then
+}
+
 // Helper function
 
+// authorizeUserAccess lets users access their own data, and privileged roles
+// (support, admin) access anyone's data through the users:*:any permissions.
+// An API key reaches its owner's data only with the matching users:*:self scope (or users:*:any).
 func authorizeUserAccess(r *http.Request) (string, error) {
 	requestedID := chi.URLParam(r, "id")
 	authenticatedID := middleware.GetUserID(r.Context())
@@ -68,13 +110,99 @@ func authorizeUserAccess(r *http.Request) (string, error) {
 		return "", errors.New("no authenticated user found")
 	}
 
-	if requestedID != authenticatedID {
+	anyPermission := anyUserPermission(r.Method)
+	if requestedID != authenticatedID && !middleware.HasPermission(r.Context(), anyPermission) {
 		return "", errors.New("forbidden: cannot access other users' data")
 	}
 
+	// Bearer tokens always carry the self permissions; keys only carry the scopes they were given
+	selfPermission := selfUserPermission(r.Method)
+	if requestedID == authenticatedID && middleware.GetAPIKeyID(r.Context()) != "" &&
+		!middleware.HasPermission(r.Context(), selfPermission) && !middleware.HasPermission(r.Context(), anyPermission) {
+		return "", errors.New("forbidden: API key is missing scope " + selfPermission)
+	}
+
 	return requestedID, nil
 }
 
+// addressResponse converts a protobuf Address to JSON
+func addressResponse(addr *userpb.Address) AddressResponse {
+	return AddressResponse{
+		ID:                addr.Id,
+		Type:              addr.Type,
+		Label:             addr.Label,
+		RecipientName:     addr.RecipientName,
+		Phone:             addr.Phone,
+		Street:            addr.Street,
+		City:              addr.City,
+		State:             addr.State,
+		PostalCode:        addr.PostalCode,
+		Country:           addr.Country,
+		IsDefault:         addr.IsDefault,
+		IsDefaultShipping: addr.IsDefaultShipping,
+		IsDefaultBilling:  addr.IsDefaultBilling,
+	}
+}
+
+// savedAddressResponse converts a saved address and its verification suggestions to JSON
+func savedAddressResponse(addr *userpb.Address, suggestions []*userpb.AddressSuggestion) SavedAddressResponse {
+	resp := SavedAddressResponse{AddressResponse: addressResponse(addr)}
+	for _, suggestion := range suggestions {
+		resp.Suggestions = append(resp.Suggestions, AddressSuggestion{
+			Field:   suggestion.Field,
+			Value:   suggestion.Value,
+			Message: suggestion.Message,
+		})
+	}
+	return resp
+}
+
+// userServiceErrorStatus maps an error reported by user-service to 404 for unknown users and addresses, 400 otherwise
+func userServiceErrorStatus(message string) int {
+	if strings.HasSuffix(message, "not found") {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// userETag is the entity tag of a profile version
+func userETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion reads the profile version from an If-Match header; no header or "*" gives 0, which
+// skips the check. ok is false for tags we never issue (weak, malformed or lists), which cannot match.
+func ifMatchVersion(header string) (version int64, ok bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	if len(header) < 3 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// selfUserPermission maps an HTTP method to the permission needed to act on one's own data
+func selfUserPermission(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return middleware.PermUsersReadSelf
+	}
+	return middleware.PermUsersWriteSelf
+}
+
+// anyUserPermission maps an HTTP method to the permission needed to act on another user
+func anyUserPermission(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return middleware.PermUsersReadAny
+	}
+	return middleware.PermUsersWriteAny
+}
+
 // GetUser handles GET /api/v1/users/:id
 // This is a protected route - user_id will be in the context from auth middleware
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
@@ -109,10 +237,12 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", userETag(grpcResp.User.Version))
 	json.NewEncoder(w).Encode(resp)
 }
 
 // UpdateUser handles PUT /api/v1/users/:id
+// Replaces the name and phone; send If-Match with the ETag from GET to avoid overwriting someone else's change
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	requestedUserID, err := authorizeUserAccess(r)
 
@@ -134,16 +264,109 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Name == "" && req.Phone == "" {
-		http.Error(w, "At least one field (name or phone) must be provided", http.StatusBadRequest)
+	// A missing name used to wipe it; single fields are changed with PATCH
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Name is required; use PATCH to change single fields", http.StatusBadRequest)
 		return
 	}
 
-	grpcResp, err := h.userClient.UpdateUser(r.Context(), &userpb.UpdateUserRequest{
-		UserId: requestedUserID,
-		Name:   req.Name,
-		Phone:  req.Phone,
+	h.updateUser(w, r, &userpb.UpdateUserRequest{
+		UserId:     requestedUserID,
+		Name:       req.Name,
+		Phone:      req.Phone,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "phone"}},
 	})
+}
+
+// PatchUser handles PATCH /api/v1/users/:id with a JSON merge patch (RFC 7396): only the fields in the
+// body change, and null removes the phone. If-Match works as for PUT.
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	patch, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	req := &userpb.UpdateUserRequest{UserId: requestedUserID, UpdateMask: &fieldmaskpb.FieldMask{}}
+	for field, raw := range patch {
+		var value *string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			http.Error(w, field+" must be a string or null", http.StatusBadRequest)
+			return
+		}
+
+		switch field {
+		case "name":
+			if value == nil {
+				http.Error(w, "Name cannot be removed", http.StatusBadRequest)
+				return
+			}
+			req.Name = *value
+		case "phone":
+			if value != nil {
+				req.Phone = *value
+			}
+		case "email":
+			http.Error(w, "Email is changed through POST /api/v1/auth/email/change", http.StatusBadRequest)
+			return
+		default:
+			http.Error(w, fmt.Sprintf("Field %q cannot be changed", field), http.StatusBadRequest)
+			return
+		}
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, field)
+	}
+
+	if len(req.UpdateMask.Paths) == 0 {
+		http.Error(w, "At least one field (name or phone) must be provided", http.StatusBadRequest)
+		return
+	}
+
+	h.updateUser(w, r, req)
+}
+
+// readMergePatch reads a JSON merge patch (RFC 7396) body as its top-level fields.
+// On failure it has already written the error response.
+func readMergePatch(w http.ResponseWriter, r *http.Request) (map[string]json.RawMessage, bool) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+			http.Error(w, "Content-Type must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+			return nil, false
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		http.Error(w, "Merge patch must be a JSON object", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return patch, true
+}
+
+// updateUser sends an update with the If-Match precondition and writes the result. A profile changed
+// since that version gets 412 with the current ETag.
+func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, req *userpb.UpdateUserRequest) {
+	version, ok := ifMatchVersion(r.Header.Get("If-Match"))
+	if !ok {
+		http.Error(w, "If-Match does not match the current version", http.StatusPreconditionFailed)
+		return
+	}
+	req.ExpectedVersion = version
+
+	grpcResp, err := h.userClient.UpdateUser(r.Context(), req)
 
 	if err != nil {
 		log.Printf("gRPC UpdateUser error: %v", err)
@@ -151,8 +374,14 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if grpcResp.Conflict {
+		w.Header().Set("ETag", userETag(grpcResp.User.Version))
+		http.Error(w, grpcResp.Error, http.StatusPreconditionFailed)
+		return
+	}
+
 	if grpcResp.Error != "" {
-		http.Error(w, grpcResp.Error, http.StatusNotFound)
+		http.Error(w, grpcResp.Error, userServiceErrorStatus(grpcResp.Error))
 		return
 	}
 
@@ -164,38 +393,32 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", userETag(grpcResp.User.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resp)
 }
 
 // DeleteUser handles DELETE /api/v1/users/:id
+// Login stops and every token is revoked at once; personal data is purged after the grace period
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	// Your implementation here
 	requestedUserID, err := authorizeUserAccess(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	// Call the user service via gRPC
-	grpcResp, err := h.userClient.DeleteUser(r.Context(), &userpb.DeleteUserRequest{
+	grpcResp, err := h.authClient.DeleteAccount(r.Context(), &authpb.DeleteAccountRequest{
 		UserId: requestedUserID,
 	})
-
 	if err != nil {
-		log.Printf("gRPC DeleteUser error: %v", err)
-		http.Error(w, "Failed to delete user: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("gRPC DeleteAccount error: %v", err)
+		http.Error(w, "Failed to delete user: "+grpcErrorMessage(err), httpStatus(err, http.StatusInternalServerError))
 		return
 	}
 
-	if grpcResp.Error != "" {
-		http.Error(w, grpcResp.Error, http.StatusNotFound)
-		return
-	}
-
-	// Convert protobuf User to JSON response
 	resp := DeleteUserResponse{
-		Message: "User deleted successfully",
+		Message:    "User deleted successfully",
+		PurgeAfter: time.Unix(grpcResp.PurgeAfter, 0).UTC().Format(time.RFC3339),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -234,13 +457,17 @@ func (h *UserHandler) AddAddress(w http.ResponseWriter, r *http.Request) {
 
 	// Call gRPC service to add the address
 	grpcResp, err := h.userClient.AddAddress(r.Context(), &userpb.AddAddressRequest{
-		UserId:     requestedUserID,
-		Street:     req.Street,
-		City:       req.City,
-		State:      req.State,
-		PostalCode: req.PostalCode,
-		Country:    req.Country,
-		IsDefault:  req.IsDefault,
+		UserId:        requestedUserID,
+		Type:          req.Type,
+		Label:         req.Label,
+		RecipientName: req.RecipientName,
+		Phone:         req.Phone,
+		Street:        req.Street,
+		City:          req.City,
+		State:         req.State,
+		PostalCode:    req.PostalCode,
+		Country:       req.Country,
+		IsDefault:     req.IsDefault,
 	})
 
 	if err != nil {
@@ -254,16 +481,8 @@ func (h *UserHandler) AddAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert protobuf Address to JSON response
-	resp := AddressResponse{
-		ID:         grpcResp.Address.Id,
-		Street:     grpcResp.Address.Street,
-		City:       grpcResp.Address.City,
-		State:      grpcResp.Address.State,
-		PostalCode: grpcResp.Address.PostalCode,
-		Country:    grpcResp.Address.Country,
-		IsDefault:  grpcResp.Address.IsDefault,
-	}
+	// Convert protobuf Address to JSON response, with any corrections verification suggests
+	resp := savedAddressResponse(grpcResp.Address, grpcResp.Suggestions)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated) // 201 Created for new resource
@@ -299,17 +518,149 @@ func (h *UserHandler) GetAddresses(w http.ResponseWriter, r *http.Request) {
 	// Note: We need to handle the case where addresses might be empty
 	addresses := make([]AddressResponse, 0, len(grpcResp.Addresses))
 	for _, addr := range grpcResp.Addresses {
-		addresses = append(addresses, AddressResponse{
-			ID:         addr.Id,
-			Street:     addr.Street,
-			City:       addr.City,
-			State:      addr.State,
-			PostalCode: addr.PostalCode,
-			Country:    addr.Country,
-			IsDefault:  addr.IsDefault,
-		})
+		addresses = append(addresses, addressResponse(addr))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(addresses)
 }
+
+// GetAddress handles GET /api/v1/users/:id/addresses/:addressId
+func (h *UserHandler) GetAddress(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grpcResp, err := h.userClient.GetAddress(r.Context(), &userpb.GetAddressRequest{
+		UserId:    requestedUserID,
+		AddressId: chi.URLParam(r, "addressId"),
+	})
+	if err != nil {
+		log.Printf("gRPC GetAddress error: %v", err)
+		http.Error(w, "Failed to get address: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if grpcResp.Error != "" {
+		http.Error(w, grpcResp.Error, userServiceErrorStatus(grpcResp.Error))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(addressResponse(grpcResp.Address))
+}
+
+// UpdateAddress handles PUT /api/v1/users/:id/addresses/:addressId
+// Every field is replaced; is_default=true unsets the previous defaults for the address's type, and
+// leaving it out keeps the address's current defaults
+func (h *UserHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req UpdateAddressRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Street == "" || req.City == "" || req.Country == "" {
+		http.Error(w, "Street, city, and country are required", http.StatusBadRequest)
+		return
+	}
+
+	grpcResp, err := h.userClient.UpdateAddress(r.Context(), &userpb.UpdateAddressRequest{
+		UserId:        requestedUserID,
+		AddressId:     chi.URLParam(r, "addressId"),
+		Type:          req.Type,
+		Label:         req.Label,
+		RecipientName: req.RecipientName,
+		Phone:         req.Phone,
+		Street:        req.Street,
+		City:          req.City,
+		State:         req.State,
+		PostalCode:    req.PostalCode,
+		Country:       req.Country,
+		IsDefault:     req.IsDefault,
+	})
+	if err != nil {
+		log.Printf("gRPC UpdateAddress error: %v", err)
+		http.Error(w, "Failed to update address: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if grpcResp.Error != "" {
+		http.Error(w, grpcResp.Error, userServiceErrorStatus(grpcResp.Error))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(savedAddressResponse(grpcResp.Address, grpcResp.Suggestions))
+}
+
+// DeleteAddress handles DELETE /api/v1/users/:id/addresses/:addressId
+// A default shipping or billing address left behind passes to the newest remaining one of that kind
+func (h *UserHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grpcResp, err := h.userClient.DeleteAddress(r.Context(), &userpb.DeleteAddressRequest{
+		UserId:    requestedUserID,
+		AddressId: chi.URLParam(r, "addressId"),
+	})
+	if err != nil {
+		log.Printf("gRPC DeleteAddress error: %v", err)
+		http.Error(w, "Failed to delete address: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if grpcResp.Error != "" {
+		http.Error(w, grpcResp.Error, userServiceErrorStatus(grpcResp.Error))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetDefaultAddress handles POST /api/v1/users/:id/addresses/:addressId/default?type=shipping|billing
+// Without a type the address becomes the default for everything it can be used for
+func (h *UserHandler) SetDefaultAddress(w http.ResponseWriter, r *http.Request) {
+	requestedUserID, err := authorizeUserAccess(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grpcResp, err := h.userClient.SetDefaultAddress(r.Context(), &userpb.SetDefaultAddressRequest{
+		UserId:    requestedUserID,
+		AddressId: chi.URLParam(r, "addressId"),
+		Type:      r.URL.Query().Get("type"),
+	})
+	if err != nil {
+		log.Printf("gRPC SetDefaultAddress error: %v", err)
+		http.Error(w, "Failed to set default address: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if grpcResp.Error != "" {
+		http.Error(w, grpcResp.Error, userServiceErrorStatus(grpcResp.Error))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(addressResponse(grpcResp.Address))
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import "testing"
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		header      string
+		wantVersion int64
+		wantOK      bool
+	}{
+		{header: "", wantVersion: 0, wantOK: true},
+		{header: "*", wantVersion: 0, wantOK: true},
+		{header: userETag(7), wantVersion: 7, wantOK: true},
+		{header: ` "7" `, wantVersion: 7, wantOK: true},
+		{header: `W/"7"`},
+		{header: "7"},
+		{header: `""`},
+		{header: `"0"`},
+		{header: `"-1"`},
+		{header: `"seven"`},
+		{header: `"7", "8"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			version, ok := ifMatchVersion(tt.header)
+			if version != tt.wantVersion || ok != tt.wantOK {
+				t.Errorf("ifMatchVersion(%q) = %d, %v; want %d, %v", tt.header, version, ok, tt.wantVersion, tt.wantOK)
+			}
+		})
+	}
+}
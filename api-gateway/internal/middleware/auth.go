@@ -2,63 +2,94 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
-
-	authpb "go-project/proto/auth"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
 // This follows Go best practices for context.WithValue
 type contextKey string
 
-const userIDKey contextKey = "user_id"
+const (
+	userIDKey      contextKey = "user_id"
+	tokenKey       contextKey = "token"
+	rolesKey       contextKey = "roles"
+	permissionsKey contextKey = "permissions"
+	verifiedKey    contextKey = "email_verified"
+	sessionIDKey   contextKey = "session_id"
+	apiKeyIDKey    contextKey = "api_key_id"
+)
+
+// Permissions understood by the gateway
+// They mirror the role_permissions table in auth-service
+const (
+	PermUsersReadSelf  = "users:read:self"
+	PermUsersWriteSelf = "users:write:self"
+	PermUsersReadAny   = "users:read:any"
+	PermUsersWriteAny  = "users:write:any"
+)
 
-// AuthMiddleware validates JWT tokens by calling the auth service
+// AuthMiddleware validates JWT tokens, locally when possible (see TokenVerifier),
+// or an API key sent in the X-API-Key header. Both put the same principal into the context.
 // This is a higher-order function (middleware pattern in Go web servers)
 // It takes a handler and returns a new handler that adds authentication
-func AuthMiddleware(authClient authpb.AuthServiceClient) func(http.Handler) http.Handler {
+func AuthMiddleware(verifier *TokenVerifier) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract the token from the Authorization header
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
+			apiKey := r.Header.Get("X-API-Key")
+			if authHeader == "" && apiKey == "" {
 				http.Error(w, "Authorization header required", http.StatusUnauthorized)
 				return
 			}
 
-			// Extract and validate the token format
-			// The Authorization header should be in format: "Bearer <token>"
-			const bearerPrefix = "Bearer "
-			if !strings.HasPrefix(authHeader, bearerPrefix) {
-				http.Error(w, "Authorization header must start with 'Bearer '", http.StatusUnauthorized)
-				return // CRITICAL: Must return after error response
+			var (
+				principal *Principal
+				token     string
+				err       error
+			)
+			if authHeader != "" {
+				// Extract and validate the token format
+				// The Authorization header should be in format: "Bearer <token>"
+				const bearerPrefix = "Bearer "
+				if !strings.HasPrefix(authHeader, bearerPrefix) {
+					http.Error(w, "Authorization header must start with 'Bearer '", http.StatusUnauthorized)
+					return // CRITICAL: Must return after error response
+				}
+
+				token = strings.TrimSpace(strings.TrimPrefix(authHeader, bearerPrefix))
+				if token == "" {
+					http.Error(w, "Token cannot be empty", http.StatusUnauthorized)
+					return
+				}
+
+				principal, err = verifier.Verify(r.Context(), token)
+			} else {
+				principal, err = verifier.VerifyAPIKey(r.Context(), strings.TrimSpace(apiKey))
 			}
 
-			token := strings.TrimSpace(strings.TrimPrefix(authHeader, bearerPrefix))
-			if token == "" {
-				http.Error(w, "Token cannot be empty", http.StatusUnauthorized)
+			if errors.Is(err, ErrInvalidToken) {
+				http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
 				return
 			}
-
-			// Call the auth service to validate the token
-			resp, err := authClient.ValidateToken(r.Context(), &authpb.ValidateTokenRequest{
-				Token: token,
-			})
-
 			if err != nil {
+				log.Printf("Token validation error: %v", err)
 				http.Error(w, "Failed to validate token", http.StatusInternalServerError)
 				return
 			}
 
-			if !resp.Valid {
-				http.Error(w, "Invalid token: "+resp.Error, http.StatusUnauthorized)
-				return
-			}
-
-			// Add user_id to request context for downstream handlers to use
+			// Add the principal to request context for downstream handlers to use
 			// Context is Go's way of passing request-scoped values through the call chain
-			ctx := context.WithValue(r.Context(), userIDKey, resp.UserId)
+			ctx := context.WithValue(r.Context(), userIDKey, principal.UserID)
+			ctx = context.WithValue(ctx, tokenKey, token)
+			ctx = context.WithValue(ctx, rolesKey, principal.Roles)
+			ctx = context.WithValue(ctx, permissionsKey, principal.Permissions)
+			ctx = context.WithValue(ctx, verifiedKey, principal.EmailVerified)
+			ctx = context.WithValue(ctx, sessionIDKey, principal.SessionID)
+			ctx = context.WithValue(ctx, apiKeyIDKey, principal.APIKeyID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -72,3 +103,102 @@ func GetUserID(ctx context.Context) string {
 	}
 	return ""
 }
+
+// GetToken returns the raw bearer token of the authenticated request
+// Handlers need it to act on the token itself (e.g. logout)
+func GetToken(ctx context.Context) string {
+	if token, ok := ctx.Value(tokenKey).(string); ok {
+		return token
+	}
+	return ""
+}
+
+// GetSessionID returns the session the bearer token belongs to
+// Empty for tokens minted before sessions existed
+func GetSessionID(ctx context.Context) string {
+	if sessionID, ok := ctx.Value(sessionIDKey).(string); ok {
+		return sessionID
+	}
+	return ""
+}
+
+// GetAPIKeyID returns the API key the request was authenticated with
+// Empty for requests with a bearer token
+func GetAPIKeyID(ctx context.Context) string {
+	if keyID, ok := ctx.Value(apiKeyIDKey).(string); ok {
+		return keyID
+	}
+	return ""
+}
+
+// RequireUserToken rejects requests authenticated with an API key.
+// Account management (sessions, MFA, API keys themselves) needs a real login,
+// so a leaked key can't be used to mint more keys or lock its owner out.
+func RequireUserToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIKeyID(r.Context()) != "" {
+			http.Error(w, "This endpoint cannot be used with an API key", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetRoles returns the roles of the authenticated user
+func GetRoles(ctx context.Context) []string {
+	if roles, ok := ctx.Value(rolesKey).([]string); ok {
+		return roles
+	}
+	return nil
+}
+
+// HasPermission reports whether the authenticated user was granted a permission
+func HasPermission(ctx context.Context, permission string) bool {
+	permissions, _ := ctx.Value(permissionsKey).([]string)
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission rejects requests whose token does not carry the given permission
+// It must be mounted after AuthMiddleware, e.g. r.With(RequirePermission("users:read:any"))
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if GetUserID(r.Context()) == "" {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			if !HasPermission(r.Context(), permission) {
+				http.Error(w, "forbidden: missing permission "+permission, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsEmailVerified reports whether the authenticated user has verified their email
+func IsEmailVerified(ctx context.Context) bool {
+	verified, _ := ctx.Value(verifiedKey).(bool)
+	return verified
+}
+
+// RequireVerifiedEmail rejects users who have not verified their email address yet
+// A freshly verified user must refresh their token for the new status to be seen
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsEmailVerified(r.Context()) {
+			http.Error(w, "Email address must be verified first", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
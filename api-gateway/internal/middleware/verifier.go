@@ -0,0 +1,465 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	authpb "go-project/proto/auth"
+)
+
+// minSyncInterval keeps a tiny MaxStaleness from turning the revocation sync into a busy loop
+const minSyncInterval = time.Second
+
+func init() {
+	// auth-service issues iat with microseconds; keep them so revocation cutoffs compare exactly
+	jwt.TimePrecision = time.Microsecond
+}
+
+var (
+	// ErrInvalidToken means the token was checked and rejected (401)
+	ErrInvalidToken = errors.New("invalid token")
+	// errKeysUnavailable means the token could not be checked locally and the RPC must decide
+	errKeysUnavailable = errors.New("signing key not available locally")
+)
+
+// Principal is the authenticated caller, as established from an access token or an API key
+type Principal struct {
+	UserID        string
+	Roles         []string
+	Permissions   []string
+	EmailVerified bool
+	SessionID     string
+	APIKeyID      string // Set instead of SessionID for API keys
+	ExpiresAt     time.Time
+}
+
+// VerifierConfig tunes how the gateway trades freshness for latency
+type VerifierConfig struct {
+	Issuer   string
+	Audience string
+
+	// MaxStaleness bounds how long a revoked token may still be accepted.
+	// The revocation feed is synced well within it and RPC results are cached for at most this long.
+	MaxStaleness time.Duration
+
+	// KeyRefreshInterval is how often the JWKS is re-fetched from auth-service
+	KeyRefreshInterval time.Duration
+
+	// AccessTokenTTL must be at least auth-service's ACCESS_TOKEN_TTL. Once a per-user cutoff is older
+	// than that, every token it revokes has expired and the cutoff is forgotten.
+	AccessTokenTTL time.Duration
+}
+
+// DefaultVerifierConfig returns settings matching auth-service defaults
+func DefaultVerifierConfig() VerifierConfig {
+	return VerifierConfig{
+		Issuer:             "auth-service",
+		Audience:           "gocommerce",
+		MaxStaleness:       30 * time.Second,
+		KeyRefreshInterval: 5 * time.Minute,
+		AccessTokenTTL:     15 * time.Minute,
+	}
+}
+
+// TokenVerifier checks access tokens without a round trip to auth-service whenever it can.
+//
+//  1. A token seen recently is answered from a cache keyed by its SHA-256 hash.
+//  2. Otherwise it is verified locally with the published JWKS and checked
+//     against a locally synced copy of the revocation list.
+//  3. If the key is unknown or the revocation list is too stale, it falls back
+//     to the ValidateToken RPC and caches the answer.
+type TokenVerifier struct {
+	authClient authpb.AuthServiceClient
+	cfg        VerifierConfig
+
+	mu              sync.RWMutex
+	keys            map[string]crypto.PublicKey // kid -> public key
+	keysFetchedAt   time.Time
+	revokedJTIs     map[string]time.Time // jti or session ID -> expiry of its last token
+	userCutoffs     map[string]time.Time // user_id -> revoked_before
+	revocationsAsOf int64
+	lastSync        time.Time
+	cache           map[string]cachedPrincipal // token hash -> result
+}
+
+type cachedPrincipal struct {
+	principal *Principal
+	until     time.Time
+}
+
+// NewTokenVerifier creates a verifier; call Run to keep its keys and revocations fresh
+func NewTokenVerifier(authClient authpb.AuthServiceClient, cfg VerifierConfig) *TokenVerifier {
+	return &TokenVerifier{
+		authClient:  authClient,
+		cfg:         cfg,
+		keys:        make(map[string]crypto.PublicKey),
+		revokedJTIs: make(map[string]time.Time),
+		userCutoffs: make(map[string]time.Time),
+		cache:       make(map[string]cachedPrincipal),
+	}
+}
+
+// Run syncs signing keys and revocations in the background until ctx is cancelled
+func (v *TokenVerifier) Run(ctx context.Context) {
+	v.refreshKeys(ctx)
+	v.syncRevocations(ctx)
+
+	// Sync several times per staleness window so one failed call doesn't break the bound
+	ticker := time.NewTicker(max(v.cfg.MaxStaleness/3, minSyncInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v.syncRevocations(ctx)
+			v.purgeExpired()
+
+			v.mu.RLock()
+			keysDue := time.Since(v.keysFetchedAt) >= v.cfg.KeyRefreshInterval
+			v.mu.RUnlock()
+			if keysDue {
+				v.refreshKeys(ctx)
+			}
+		}
+	}
+}
+
+// Verify returns the principal of a valid, unrevoked token.
+// ErrInvalidToken (possibly wrapped) means the token was rejected; any other error is a transport failure.
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	tokenHash := hashToken(token)
+
+	if p := v.cached(tokenHash); p != nil {
+		return p, nil
+	}
+
+	if v.revocationsFresh() {
+		p, err := v.verifyLocally(ctx, token)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, errKeysUnavailable) {
+			return nil, err
+		}
+	}
+
+	return v.verifyRemotely(ctx, token, tokenHash)
+}
+
+// VerifyAPIKey returns the principal of a valid API key. API keys are opaque, so they are always
+// checked by auth-service; answers are cached like remotely validated tokens, which also bounds
+// how long a revoked key keeps working to MaxStaleness.
+func (v *TokenVerifier) VerifyAPIKey(ctx context.Context, key string) (*Principal, error) {
+	keyHash := hashToken(key)
+
+	if p := v.cached(keyHash); p != nil {
+		return p, nil
+	}
+
+	resp, err := v.authClient.ValidateAPIKey(ctx, &authpb.ValidateAPIKeyRequest{
+		Key: key,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Valid {
+		return nil, errors.Join(ErrInvalidToken, errors.New(resp.Error))
+	}
+
+	p := &Principal{
+		UserID:        resp.UserId,
+		Roles:         resp.Roles,
+		Permissions:   resp.Permissions,
+		EmailVerified: resp.EmailVerified,
+		APIKeyID:      resp.KeyId,
+		ExpiresAt:     time.Unix(resp.ExpiresAt, 0),
+	}
+	v.cachePrincipal(keyHash, p)
+
+	return p, nil
+}
+
+func (v *TokenVerifier) verifyLocally(ctx context.Context, token string) (*Principal, error) {
+	claims := &accessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithIssuer(v.cfg.Issuer),
+		jwt.WithAudience(v.cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	if errors.Is(err, errKeysUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	if claims.UserID == "" || claims.ID == "" || claims.IssuedAt == nil {
+		return nil, errors.Join(ErrInvalidToken, errors.New("missing claims"))
+	}
+
+	if v.isRevoked(claims) {
+		return nil, errors.Join(ErrInvalidToken, errors.New("token has been revoked"))
+	}
+
+	return &Principal{
+		UserID:        claims.UserID,
+		Roles:         claims.Roles,
+		Permissions:   claims.Permissions,
+		EmailVerified: claims.EmailVerified,
+		SessionID:     claims.SessionID,
+		ExpiresAt:     claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (v *TokenVerifier) verifyRemotely(ctx context.Context, token, tokenHash string) (*Principal, error) {
+	resp, err := v.authClient.ValidateToken(ctx, &authpb.ValidateTokenRequest{
+		Token: token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Valid {
+		return nil, errors.Join(ErrInvalidToken, errors.New(resp.Error))
+	}
+
+	p := &Principal{
+		UserID:        resp.UserId,
+		Roles:         resp.Roles,
+		Permissions:   resp.Permissions,
+		EmailVerified: resp.EmailVerified,
+		SessionID:     resp.SessionId,
+		ExpiresAt:     time.Unix(resp.ExpiresAt, 0),
+	}
+
+	v.cachePrincipal(tokenHash, p)
+
+	return p, nil
+}
+
+// cachePrincipal caches until the token or key expires, but never longer than the staleness bound
+func (v *TokenVerifier) cachePrincipal(hash string, p *Principal) {
+	until := time.Now().Add(v.cfg.MaxStaleness)
+	if p.ExpiresAt.Before(until) {
+		until = p.ExpiresAt
+	}
+
+	v.mu.Lock()
+	v.cache[hash] = cachedPrincipal{principal: p, until: until}
+	v.mu.Unlock()
+}
+
+func (v *TokenVerifier) cached(tokenHash string) *Principal {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	entry, ok := v.cache[tokenHash]
+	if !ok || time.Now().After(entry.until) {
+		return nil
+	}
+	return entry.principal
+}
+
+// revocationsFresh reports whether the local revocation list is recent enough to rely on
+func (v *TokenVerifier) revocationsFresh() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return !v.lastSync.IsZero() && time.Since(v.lastSync) <= v.cfg.MaxStaleness
+}
+
+func (v *TokenVerifier) isRevoked(claims *accessClaims) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if _, ok := v.revokedJTIs[claims.ID]; ok {
+		return true
+	}
+	// Revoked sessions are listed by their ID alongside individual tokens
+	if _, ok := v.revokedJTIs[claims.SessionID]; ok && claims.SessionID != "" {
+		return true
+	}
+
+	cutoff, ok := v.userCutoffs[claims.UserID]
+	return ok && claims.IssuedAt.Before(cutoff)
+}
+
+// publicKey looks up a kid, re-fetching the JWKS at most once per staleness window on a miss
+func (v *TokenVerifier) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	recentlyFetched := time.Since(v.keysFetchedAt) < v.cfg.MaxStaleness
+	v.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+	if recentlyFetched {
+		return nil, errKeysUnavailable
+	}
+
+	v.refreshKeys(ctx)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errKeysUnavailable
+}
+
+func (v *TokenVerifier) refreshKeys(ctx context.Context) {
+	resp, err := v.authClient.GetJWKS(ctx, &authpb.GetJWKSRequest{})
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Record the attempt even on failure so a bad kid can't trigger a fetch per request
+	v.keysFetchedAt = time.Now()
+
+	if err != nil {
+		log.Printf("Failed to fetch JWKS: %v", err)
+		return
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(resp.Keys))
+	for _, jwk := range resp.Keys {
+		key, err := parseJWK(jwk)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	v.keys = keys
+}
+
+func (v *TokenVerifier) syncRevocations(ctx context.Context) {
+	v.mu.RLock()
+	since := v.revocationsAsOf
+	v.mu.RUnlock()
+
+	// Step back a little to cover revocations committed while the previous snapshot was read
+	if since > 0 {
+		since -= 5
+	}
+
+	resp, err := v.authClient.GetRevocations(ctx, &authpb.GetRevocationsRequest{Since: since})
+	if err != nil {
+		log.Printf("Failed to sync revocations: %v", err)
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, t := range resp.Tokens {
+		v.revokedJTIs[t.Jti] = time.Unix(t.ExpiresAt, 0)
+	}
+	for _, u := range resp.Users {
+		if cutoff := userCutoff(u); cutoff.After(v.userCutoffs[u.UserId]) {
+			v.userCutoffs[u.UserId] = cutoff
+		}
+	}
+	v.revocationsAsOf = resp.AsOf
+	v.lastSync = time.Now()
+}
+
+// purgeExpired drops cache entries and revocations that can no longer matter
+func (v *TokenVerifier) purgeExpired() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	for hash, entry := range v.cache {
+		if now.After(entry.until) {
+			delete(v.cache, hash)
+		}
+	}
+	for jti, exp := range v.revokedJTIs {
+		if now.After(exp) {
+			delete(v.revokedJTIs, jti)
+		}
+	}
+	for userID, cutoff := range v.userCutoffs {
+		if now.Sub(cutoff) > v.cfg.AccessTokenTTL {
+			delete(v.userCutoffs, userID)
+		}
+	}
+}
+
+// userCutoff returns the moment before which the user's tokens are revoked. An auth-service that
+// only sends whole seconds meant "issued at or before that second", i.e. before the next one.
+func userCutoff(u *authpb.UserRevocation) time.Time {
+	if u.RevokedBeforeMicros != 0 {
+		return time.UnixMicro(u.RevokedBeforeMicros)
+	}
+	return time.Unix(u.RevokedBefore+1, 0)
+}
+
+// accessClaims mirrors the claims auth-service puts in access tokens
+type accessClaims struct {
+	UserID        string   `json:"user_id"`
+	Roles         []string `json:"roles"`
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+	SessionID     string   `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+func parseJWK(jwk *authpb.JSONWebKey) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, errors.New("unsupported curve " + jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.New("unsupported key type " + jwk.Kty)
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
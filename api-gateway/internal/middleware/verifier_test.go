@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+
+	authpb "go-project/proto/auth"
+)
+
+// fakeAuthClient serves a fixed JWKS and revocation list; any other RPC panics
+type fakeAuthClient struct {
+	authpb.AuthServiceClient
+
+	mu          sync.Mutex
+	jwks        []*authpb.JSONWebKey
+	revocations *authpb.GetRevocationsResponse
+	syncs       int
+}
+
+func (c *fakeAuthClient) GetJWKS(ctx context.Context, in *authpb.GetJWKSRequest, opts ...grpc.CallOption) (*authpb.GetJWKSResponse, error) {
+	return &authpb.GetJWKSResponse{Keys: c.jwks}, nil
+}
+
+func (c *fakeAuthClient) GetRevocations(ctx context.Context, in *authpb.GetRevocationsRequest, opts ...grpc.CallOption) (*authpb.GetRevocationsResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.syncs++
+	if c.revocations == nil {
+		return &authpb.GetRevocationsResponse{AsOf: time.Now().Unix()}, nil
+	}
+	return c.revocations, nil
+}
+
+// newTestVerifier returns a verifier whose keys and revocations are synced from a fake auth-service,
+// and a function signing access tokens it accepts
+func newTestVerifier(t *testing.T, revocations *authpb.GetRevocationsResponse) (*TokenVerifier, func(accessClaims) string) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	client := &fakeAuthClient{
+		jwks: []*authpb.JSONWebKey{{
+			Kid: "key-1",
+			Kty: "OKP",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}},
+		revocations: revocations,
+	}
+	v := NewTokenVerifier(client, DefaultVerifierConfig())
+	v.refreshKeys(context.Background())
+	v.syncRevocations(context.Background())
+
+	sign := func(claims accessClaims) string {
+		claims.Issuer = v.cfg.Issuer
+		claims.Audience = jwt.ClaimStrings{v.cfg.Audience}
+		if claims.ID == "" {
+			claims.ID = "jti-1"
+		}
+		if claims.ExpiresAt == nil {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(15 * time.Minute))
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = "key-1"
+		signed, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+	return v, sign
+}
+
+func TestTokenVerifierRevocations(t *testing.T) {
+	cutoff := time.Now().Add(-time.Minute).Truncate(time.Second).Add(400 * time.Millisecond)
+
+	revocations := &authpb.GetRevocationsResponse{
+		Tokens: []*authpb.RevokedToken{
+			{Jti: "revoked-jti", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+			{Jti: "revoked-session", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		},
+		Users: []*authpb.UserRevocation{{
+			UserId:              "user-1",
+			RevokedBefore:       cutoff.Unix(),
+			RevokedBeforeMicros: cutoff.UnixMicro(),
+		}},
+		AsOf: time.Now().Unix(),
+	}
+
+	tests := []struct {
+		name     string
+		jti      string
+		session  string
+		userID   string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{name: "not revoked", userID: "user-2", issuedAt: cutoff},
+		{name: "revoked by jti", jti: "revoked-jti", userID: "user-2", issuedAt: time.Now(), revoked: true},
+		{name: "revoked session", session: "revoked-session", userID: "user-2", issuedAt: time.Now(), revoked: true},
+		{name: "issued a second before the cutoff", userID: "user-1", issuedAt: cutoff.Add(-time.Second), revoked: true},
+		{name: "issued earlier in the cutoff's second", userID: "user-1", issuedAt: cutoff.Add(-100 * time.Millisecond), revoked: true},
+		{name: "issued later in the cutoff's second", userID: "user-1", issuedAt: cutoff.Add(100 * time.Millisecond)},
+		{name: "issued after the cutoff", userID: "user-1", issuedAt: cutoff.Add(time.Second)},
+	}
+
+	v, sign := newTestVerifier(t, revocations)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := sign(accessClaims{
+				UserID:    tt.userID,
+				SessionID: tt.session,
+				RegisteredClaims: jwt.RegisteredClaims{
+					ID:       tt.jti,
+					IssuedAt: jwt.NewNumericDate(tt.issuedAt),
+				},
+			})
+
+			_, err := v.verifyLocally(context.Background(), token)
+			if tt.revoked && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("verifyLocally error = %v, want ErrInvalidToken", err)
+			}
+			if !tt.revoked && err != nil {
+				t.Errorf("verifyLocally: %v", err)
+			}
+		})
+	}
+}
+
+func TestUserCutoff(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *authpb.UserRevocation
+		want time.Time
+	}{
+		{
+			name: "microseconds",
+			in:   &authpb.UserRevocation{RevokedBefore: 1_700_000_000, RevokedBeforeMicros: 1_700_000_000_250_000},
+			want: time.UnixMicro(1_700_000_000_250_000),
+		},
+		{
+			// Older auth-service: "issued at or before this second"
+			name: "whole seconds only",
+			in:   &authpb.UserRevocation{RevokedBefore: 1_700_000_000},
+			want: time.Unix(1_700_000_001, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := userCutoff(tt.in); !got.Equal(tt.want) {
+				t.Errorf("userCutoff = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenVerifierPurgeExpired(t *testing.T) {
+	v := NewTokenVerifier(&fakeAuthClient{}, DefaultVerifierConfig())
+	now := time.Now()
+
+	v.userCutoffs["recent"] = now.Add(-time.Minute)
+	v.userCutoffs["old"] = now.Add(-v.cfg.AccessTokenTTL - time.Minute)
+	v.revokedJTIs["live"] = now.Add(time.Minute)
+	v.revokedJTIs["expired"] = now.Add(-time.Minute)
+	v.cache["fresh"] = cachedPrincipal{until: now.Add(time.Minute)}
+	v.cache["stale"] = cachedPrincipal{until: now.Add(-time.Minute)}
+
+	v.purgeExpired()
+
+	if _, ok := v.userCutoffs["recent"]; !ok {
+		t.Error("cutoff younger than the access token TTL dropped")
+	}
+	if _, ok := v.userCutoffs["old"]; ok {
+		t.Error("cutoff older than the access token TTL kept")
+	}
+	if _, ok := v.revokedJTIs["expired"]; ok || len(v.revokedJTIs) != 1 {
+		t.Errorf("revokedJTIs = %v, want only the live one", v.revokedJTIs)
+	}
+	if _, ok := v.cache["stale"]; ok || len(v.cache) != 1 {
+		t.Errorf("cache has %d entries, want only the fresh one", len(v.cache))
+	}
+}
+
+// A MaxStaleness too small to divide by three used to panic in time.NewTicker
+func TestTokenVerifierRunWithTinyStaleness(t *testing.T) {
+	client := &fakeAuthClient{}
+	cfg := DefaultVerifierConfig()
+	cfg.MaxStaleness = time.Nanosecond
+	v := NewTokenVerifier(client, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	v.Run(ctx)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.syncs != 1 {
+		t.Errorf("synced %d times in 50ms, want only the initial sync", client.syncs)
+	}
+}
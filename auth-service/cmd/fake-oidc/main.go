@@ -0,0 +1,40 @@
+// Command fake-oidc is a minimal OpenID Connect provider for local development and the API tests.
+// It signs in anyone without a password: the identity comes from the authorize request
+// (login_hint is the email; name, email_verified=false and deny=1 are optional).
+// Never point a deployment reachable by anyone else at it: whoever can reach the gateway could sign in as any user.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"auth-service/internal/idp/fakeoidc"
+)
+
+func main() {
+	port := getEnv("PORT", "9000")
+	issuer := getEnv("ISSUER", "http://localhost:"+port)
+
+	p, err := fakeoidc.New(fakeoidc.Config{
+		Issuer:       issuer,
+		PublicURL:    getEnv("PUBLIC_URL", issuer),
+		ClientID:     getEnv("CLIENT_ID", "gocommerce"),
+		ClientSecret: getEnv("CLIENT_SECRET", "gocommerce-secret"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	log.Printf("Fake OIDC provider listening on :%s (issuer %s)", port, issuer)
+	if err := http.ListenAndServe(":"+port, p.Handler()); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
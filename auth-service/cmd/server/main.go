@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
 	"auth-service/internal/handlers"
+	"auth-service/internal/idp"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"auth-service/internal/password"
+	"auth-service/internal/profiles"
 	"auth-service/internal/repository"
 	"auth-service/internal/service"
 	pb "go-project/proto/auth"
@@ -34,10 +44,79 @@ func main() {
 		log.Fatalf("Failed to ping database: %v", err)
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "23094uoifhpowisrfhp02893ryufpowafh"
+	authConfig := service.DefaultConfig()
+	authConfig.Issuer = getEnv("JWT_ISSUER", authConfig.Issuer)
+	authConfig.Audience = getEnv("JWT_AUDIENCE", authConfig.Audience)
+	authConfig.AccessTokenTTL = getEnvDuration("ACCESS_TOKEN_TTL", authConfig.AccessTokenTTL)
+	authConfig.RefreshTokenTTL = getEnvDuration("REFRESH_TOKEN_TTL", authConfig.RefreshTokenTTL)
+	authConfig.PasswordResetTTL = getEnvDuration("PASSWORD_RESET_TTL", authConfig.PasswordResetTTL)
+	authConfig.PasswordResetURL = getEnv("PASSWORD_RESET_URL", authConfig.PasswordResetURL)
+	authConfig.EmailVerificationTTL = getEnvDuration("EMAIL_VERIFICATION_TTL", authConfig.EmailVerificationTTL)
+	authConfig.EmailVerificationURL = getEnv("EMAIL_VERIFICATION_URL", authConfig.EmailVerificationURL)
+	authConfig.RequireVerifiedEmailForLogin = getEnv("UNVERIFIED_EMAIL_POLICY", "allow") == "block_login"
+	authConfig.EmailChangeTTL = getEnvDuration("EMAIL_CHANGE_TTL", authConfig.EmailChangeTTL)
+	authConfig.EmailChangeURL = getEnv("EMAIL_CHANGE_URL", authConfig.EmailChangeURL)
+
+	authConfig.MFAIssuer = getEnv("MFA_ISSUER", authConfig.MFAIssuer)
+	authConfig.MFAChallengeTTL = getEnvDuration("MFA_CHALLENGE_TTL", authConfig.MFAChallengeTTL)
+	authConfig.OAuthStateTTL = getEnvDuration("OAUTH_STATE_TTL", authConfig.OAuthStateTTL)
+	authConfig.APIKeyDefaultTTL = getEnvDuration("API_KEY_DEFAULT_TTL", authConfig.APIKeyDefaultTTL)
+	authConfig.APIKeyMaxTTL = getEnvDuration("API_KEY_MAX_TTL", authConfig.APIKeyMaxTTL)
+	authConfig.RegistrationGracePeriod = getEnvDuration("REGISTRATION_GRACE_PERIOD", authConfig.RegistrationGracePeriod)
+	authConfig.AccountDeletionGracePeriod = getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", authConfig.AccountDeletionGracePeriod)
+	authConfig.DataExportTTL = getEnvDuration("DATA_EXPORT_TTL", authConfig.DataExportTTL)
+
+	// Failed logins slow down after LOGIN_BACKOFF_AFTER and lock the account after LOGIN_LOCK_AFTER
+	authConfig.Lockout.Window = getEnvDuration("LOGIN_FAILURE_WINDOW", authConfig.Lockout.Window)
+	authConfig.Lockout.BackoffAfter = getEnvInt("LOGIN_BACKOFF_AFTER", authConfig.Lockout.BackoffAfter)
+	authConfig.Lockout.BaseDelay = getEnvDuration("LOGIN_BACKOFF_BASE", authConfig.Lockout.BaseDelay)
+	authConfig.Lockout.MaxDelay = getEnvDuration("LOGIN_BACKOFF_MAX", authConfig.Lockout.MaxDelay)
+	authConfig.Lockout.LockAfter = getEnvInt("LOGIN_LOCK_AFTER", authConfig.Lockout.LockAfter)
+	authConfig.Lockout.LockDuration = getEnvDuration("LOGIN_LOCK_DURATION", authConfig.Lockout.LockDuration)
+	authConfig.Lockout.IPMaxFailures = getEnvInt("LOGIN_IP_MAX_FAILURES", authConfig.Lockout.IPMaxFailures)
+	authConfig.Lockout.IPBlockDuration = getEnvDuration("LOGIN_IP_BLOCK_DURATION", authConfig.Lockout.IPBlockDuration)
+
+	// New passwords must follow the policy; BREACHED_PASSWORDS_FILE adds an offline list of breached password hashes
+	authConfig.PasswordPolicy.MinLength = getEnvInt("PASSWORD_MIN_LENGTH", authConfig.PasswordPolicy.MinLength)
+	authConfig.PasswordPolicy.MinCharClasses = getEnvInt("PASSWORD_MIN_CHAR_CLASSES", authConfig.PasswordPolicy.MinCharClasses)
+	authConfig.PasswordPolicy.RejectPersonalInfo = getEnv("PASSWORD_REJECT_PERSONAL_INFO", "true") == "true"
+	// Hashes made with another algorithm or lower costs are upgraded on the next login
+	authConfig.PasswordHasher.Algorithm = getEnv("PASSWORD_HASH_ALG", authConfig.PasswordHasher.Algorithm)
+	authConfig.PasswordHasher.BcryptCost = getEnvInt("BCRYPT_COST", authConfig.PasswordHasher.BcryptCost)
+	authConfig.PasswordHasher.Argon2.Memory = uint32(getEnvUint("ARGON2_MEMORY_KIB", uint64(authConfig.PasswordHasher.Argon2.Memory), 32))
+	authConfig.PasswordHasher.Argon2.Iterations = uint32(getEnvUint("ARGON2_ITERATIONS", uint64(authConfig.PasswordHasher.Argon2.Iterations), 32))
+	authConfig.PasswordHasher.Argon2.Parallelism = uint8(getEnvUint("ARGON2_PARALLELISM", uint64(authConfig.PasswordHasher.Argon2.Parallelism), 8))
+	if err := authConfig.PasswordHasher.Validate(); err != nil {
+		log.Fatalf("Invalid password hashing settings: %v", err)
+	}
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := password.LoadBreachedList(path)
+		if err != nil {
+			log.Fatalf("Failed to load breached passwords: %v", err)
+		}
+		log.Printf("Loaded %d breached password hashes from %s", breached.Size(), path)
+		authConfig.PasswordPolicy.Breached = breached
+	}
+
+	// Signing keys are generated and rotated by the service itself and stored in the database.
+	// Retired keys keep verifying for the overlap window, which must outlive any access token.
+	keyRotationInterval := getEnvDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour)
+	keyOverlap := getEnvDuration("JWT_KEY_OVERLAP", 24*time.Hour)
+	if keyOverlap < authConfig.AccessTokenTTL {
+		log.Printf("JWT_KEY_OVERLAP %s is shorter than ACCESS_TOKEN_TTL, using %s", keyOverlap, authConfig.AccessTokenTTL)
+		keyOverlap = authConfig.AccessTokenTTL
+	}
+
+	keyring, err := keys.NewKeyring(
+		repository.NewPostgresSigningKeyRepository(db),
+		getEnv("JWT_SIGNING_ALG", keys.AlgRS256),
+		keyRotationInterval,
+		keyOverlap,
+	)
+	if err != nil {
+		log.Fatalf("Failed to initialize signing keys: %v", err)
 	}
+	go keyring.Run(context.Background(), time.Minute)
 
 	userServiceUrl := os.Getenv("USER_SERVICE_URL")
 
@@ -54,8 +133,49 @@ func main() {
 
 	userClient := userpb.NewUserServiceClient(userConn)
 	userRepo := repository.NewPostgresUserRepository(db)
-	authService := service.NewAuthService(userRepo, jwtSecret)
-	authHandler := handlers.NewAuthHandler(authService, userClient)
+	refreshTokenRepo := repository.NewPostgresRefreshTokenRepository(db)
+	mfaRepo := repository.NewPostgresMFARepository(db)
+	sessionRepo := repository.NewPostgresSessionRepository(db)
+	identityRepo := repository.NewPostgresIdentityRepository(db)
+	apiKeyRepo := repository.NewPostgresAPIKeyRepository(db)
+	dataExportRepo := repository.NewPostgresDataExportRepository(db)
+
+	// REVOCATION_STORE=memory keeps revocations in-process (single instance, lost on restart)
+	var revocationStore repository.RevocationStore = repository.NewPostgresRevocationStore(db)
+	if os.Getenv("REVOCATION_STORE") == "memory" {
+		revocationStore = repository.NewInMemoryRevocationStore()
+	}
+
+	// LOGIN_ATTEMPT_STORE=memory keeps failed login counters in-process (single instance, lost on restart)
+	var loginAttempts repository.LoginAttemptStore = repository.NewPostgresLoginAttemptStore(db)
+	if os.Getenv("LOGIN_ATTEMPT_STORE") == "memory" {
+		loginAttempts = repository.NewInMemoryLoginAttemptStore()
+	}
+
+	mailer, err := newMailSender()
+	if err != nil {
+		log.Fatalf("Failed to initialize mail sender: %v", err)
+	}
+
+	profileStore := profiles.NewGRPCStore(userClient)
+
+	authService := service.NewAuthService(userRepo, refreshTokenRepo, revocationStore, loginAttempts, sessionRepo, mfaRepo, identityRepo, newIdentityProviders(), apiKeyRepo, dataExportRepo, profileStore, keyring, mailer, authConfig)
+	authHandler := handlers.NewAuthHandler(authService)
+
+	// Repairs registrations that failed halfway (see ReconcileProfiles); 0 disables it
+	if every := getEnvDuration("PROFILE_RECONCILE_INTERVAL", 10*time.Minute); every > 0 {
+		go authService.RunProfileReconciliation(context.Background(), every)
+	}
+
+	// Erases accounts whose deletion grace period is over; 0 disables it
+	if every := getEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour); every > 0 {
+		go authService.RunAccountPurge(context.Background(), every)
+	}
+
+	// Builds requested data exports and deletes expired ones; 0 disables it
+	if every := getEnvDuration("DATA_EXPORT_INTERVAL", 30*time.Second); every > 0 {
+		go authService.RunDataExports(context.Background(), every)
+	}
 
 	grpcServer := grpc.NewServer()
 	pb.RegisterAuthServiceServer(grpcServer, authHandler)
@@ -72,3 +192,102 @@ func main() {
 	}
 
 }
+
+// newMailSender picks the mail backend from MAIL_SENDER: log (default), file or smtp
+func newMailSender() (mail.Sender, error) {
+	switch getEnv("MAIL_SENDER", "log") {
+	case "log":
+		return mail.NewLogSender(), nil
+	case "file":
+		return mail.NewFileSender(getEnv("MAIL_DIR", "./mail"))
+	case "smtp":
+		return mail.NewSMTPSender(
+			getEnv("SMTP_ADDR", "localhost:25"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			getEnv("MAIL_FROM", "noreply@gocommerce.local"),
+		), nil
+	default:
+		return nil, errors.New("unknown MAIL_SENDER " + os.Getenv("MAIL_SENDER"))
+	}
+}
+
+// newIdentityProviders reads the OpenID Connect providers listed in OIDC_PROVIDERS (e.g. "google,fake").
+// Each one is configured by OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+func newIdentityProviders() map[string]idp.Provider {
+	redirectURL := getEnv("OAUTH_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oauth/%s/callback")
+
+	providers := make(map[string]idp.Provider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := idp.OIDCConfig{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  strings.ReplaceAll(redirectURL, "%s", name),
+		}
+		if cfg.IssuerURL == "" || cfg.ClientID == "" {
+			log.Fatalf("Identity provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+
+		providers[name] = idp.NewOIDCProvider(cfg)
+		log.Printf("Identity provider %s enabled (%s)", name, cfg.IssuerURL)
+	}
+
+	return providers
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration parses a duration such as "15m" from the environment, falling back to the default
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, value, err)
+	}
+	return d
+}
+
+// getEnvUint reads a positive integer that must fit in bits bits
+func getEnvUint(key string, defaultValue uint64, bits int) uint64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.ParseUint(value, 10, bits)
+	if err != nil || n == 0 {
+		log.Fatalf("Invalid %s %q", key, value)
+	}
+	return n
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Fatalf("Invalid %s %q", key, value)
+	}
+	return n
+}
@@ -4,46 +4,38 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
+	"strconv"
+	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"auth-service/internal/models"
 	"auth-service/internal/service"
 	pb "go-project/proto/auth"
-	userpb "go-project/proto/user"
 )
 
 type AuthHandler struct {
 	pb.UnimplementedAuthServiceServer
 	authService *service.AuthService
-	userClient  userpb.UserServiceClient // gRPC client for User Service
 }
 
-func NewAuthHandler(authService *service.AuthService, userClient userpb.UserServiceClient) *AuthHandler {
+func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
-		userClient:  userClient,
 	}
 }
 
 func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
-	// Step 1: Register user in Auth Service (creates credentials)
-	userID, err := h.authService.Register(req.Email, req.Password, req.Name)
+	// Creates the credentials here and the profile in User Service, or neither
+	userID, err := h.authService.Register(ctx, req.Email, req.Password, req.Name)
 	if err != nil {
-		return nil, err
-	}
-
-	// Step 2: Create user profile in User Service via gRPC
-
-	createUserResp, err := h.userClient.CreateUser(ctx, &userpb.CreateUserRequest{
-		UserId: userID,
-		Email:  req.Email,
-		Name:   req.Name,
-		Phone:  "",
-	})
-
-	if err != nil {
-		return nil, err
-	}
-	if createUserResp.Error != "" {
-		return nil, errors.New(createUserResp.Error)
+		return nil, registerError(err)
 	}
 	log.Printf("✅ User registered: ID=%s, Email=%s", userID, req.Email)
 
@@ -54,21 +46,34 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 }
 
 func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	token, err := h.authService.Login(req.Email, req.Password)
+	result, err := h.authService.Login(req.Email, req.Password, clientInfo(ctx))
 	if err != nil {
-		return nil, err
+		return nil, loginError(ctx, err)
 	}
 
+	if result.MFAToken != "" {
+		return &pb.LoginResponse{
+			MfaRequired: true,
+			MfaToken:    result.MFAToken,
+		}, nil
+	}
+
+	log.Printf("✅ User logged in: ID=%s", result.User.ID)
+
 	return &pb.LoginResponse{
-		Token:  token,
-		UserId: "",
-		Name:   "",
+		Token:        result.Tokens.AccessToken,
+		UserId:       result.User.ID,
+		Name:         result.User.Name,
+		RefreshToken: result.Tokens.RefreshToken,
+		ExpiresIn:    int64(result.Tokens.ExpiresIn.Seconds()),
+		Email:        result.User.Email,
+		Roles:        result.Roles,
 	}, nil
 }
 
 func (h *AuthHandler) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse,
 	error) {
-	userID, err := h.authService.ValidateToken(req.Token)
+	claims, err := h.authService.ValidateToken(req.Token)
 	if err != nil {
 		return &pb.ValidateTokenResponse{
 			Valid:  false,
@@ -78,8 +83,677 @@ func (h *AuthHandler) ValidateToken(ctx context.Context, req *pb.ValidateTokenRe
 	}
 
 	return &pb.ValidateTokenResponse{
-		Valid:  true,
-		UserId: userID,
-		Error:  "",
+		Valid:         true,
+		UserId:        claims.UserID,
+		Error:         "",
+		Roles:         claims.Roles,
+		Permissions:   claims.Permissions,
+		ExpiresAt:     claims.ExpiresAt.Unix(),
+		EmailVerified: claims.EmailVerified,
+		SessionId:     claims.SessionID,
+	}, nil
+}
+
+func (h *AuthHandler) GetMe(ctx context.Context, req *pb.GetMeRequest) (*pb.GetMeResponse, error) {
+	me, err := h.authService.GetMe(req.Token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return &pb.GetMeResponse{
+		UserId:        me.User.ID,
+		Email:         me.User.Email,
+		Name:          me.User.Name,
+		EmailVerified: me.User.EmailVerified,
+		Roles:         me.Claims.Roles,
+		Permissions:   me.Claims.Permissions,
+		MfaEnabled:    me.MFAEnabled,
+		CreatedAt:     me.User.CreatedAt.Unix(),
+		LastLogin:     me.User.LastLogin.Unix(),
+		TokenId:       me.Claims.ID,
+		IssuedAt:      me.Claims.IssuedAt.Unix(),
+		ExpiresAt:     me.Claims.ExpiresAt.Unix(),
+		SessionId:     me.Claims.SessionID,
+	}, nil
+}
+
+func (h *AuthHandler) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	tokens, err := h.authService.RefreshToken(req.RefreshToken, clientInfo(ctx))
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	return &pb.RefreshTokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}, nil
+}
+
+func (h *AuthHandler) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	if err := h.authService.Logout(req.Token, req.RefreshToken); err != nil {
+		return nil, tokenError(err)
+	}
+
+	return &pb.LogoutResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) RevokeAllSessions(ctx context.Context, req *pb.RevokeAllSessionsRequest) (*pb.RevokeAllSessionsResponse, error) {
+	if err := h.authService.RevokeAllSessions(req.UserId); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔒 All sessions revoked: ID=%s", req.UserId)
+
+	return &pb.RevokeAllSessionsResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) GetJWKS(ctx context.Context, req *pb.GetJWKSRequest) (*pb.GetJWKSResponse, error) {
+	jwks := h.authService.PublicKeys()
+
+	pbKeys := make([]*pb.JSONWebKey, 0, len(jwks))
+	for _, k := range jwks {
+		pbKeys = append(pbKeys, &pb.JSONWebKey{
+			Kid: k.KID,
+			Kty: k.Kty,
+			Alg: k.Alg,
+			Use: k.Use,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+		})
+	}
+
+	return &pb.GetJWKSResponse{Keys: pbKeys}, nil
+}
+
+func (h *AuthHandler) GetRevocations(ctx context.Context, req *pb.GetRevocationsRequest) (*pb.GetRevocationsResponse, error) {
+	tokens, users, asOf, err := h.authService.Revocations(time.Unix(req.Since, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.GetRevocationsResponse{
+		Tokens: make([]*pb.RevokedToken, 0, len(tokens)),
+		Users:  make([]*pb.UserRevocation, 0, len(users)),
+		AsOf:   asOf.Unix(),
+	}
+	for _, t := range tokens {
+		resp.Tokens = append(resp.Tokens, &pb.RevokedToken{Jti: t.JTI, ExpiresAt: t.ExpiresAt.Unix()})
+	}
+	for _, u := range users {
+		resp.Users = append(resp.Users, &pb.UserRevocation{
+			UserId:              u.UserID,
+			RevokedBefore:       u.RevokedBefore.Unix(),
+			RevokedBeforeMicros: u.RevokedBefore.UnixMicro(),
+		})
+	}
+
+	return resp, nil
+}
+
+func (h *AuthHandler) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	if err := h.authService.RequestPasswordReset(req.Email); err != nil {
+		return nil, err
+	}
+
+	// Same answer whether or not the email exists
+	return &pb.RequestPasswordResetResponse{
+		Message: "If an account exists for this email, a reset link has been sent",
 	}, nil
 }
+
+func (h *AuthHandler) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	if err := h.authService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		return nil, tokenError(err)
+	}
+
+	return &pb.ResetPasswordResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	userID, err := h.authService.VerifyEmail(req.Token)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	log.Printf("✅ Email verified: ID=%s", userID)
+
+	return &pb.VerifyEmailResponse{
+		UserId:  userID,
+		Message: "Email verified successfully",
+	}, nil
+}
+
+func (h *AuthHandler) ResendVerificationEmail(ctx context.Context, req *pb.ResendVerificationEmailRequest) (*pb.ResendVerificationEmailResponse, error) {
+	if err := h.authService.ResendVerificationEmail(req.Email); err != nil {
+		return nil, err
+	}
+
+	return &pb.ResendVerificationEmailResponse{
+		Message: "If this email needs verification, a new link has been sent",
+	}, nil
+}
+
+func (h *AuthHandler) UnlockAccount(ctx context.Context, req *pb.UnlockAccountRequest) (*pb.UnlockAccountResponse, error) {
+	if err := h.authService.UnlockAccount(req.UserId); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔓 Account unlocked: ID=%s", req.UserId)
+
+	return &pb.UnlockAccountResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) EnrollMFA(ctx context.Context, req *pb.EnrollMFARequest) (*pb.EnrollMFAResponse, error) {
+	secret, uri, err := h.authService.BeginMFAEnrollment(req.UserId)
+	if err != nil {
+		return nil, mfaError(ctx, err)
+	}
+
+	return &pb.EnrollMFAResponse{
+		Secret:     secret,
+		OtpauthUri: uri,
+	}, nil
+}
+
+func (h *AuthHandler) ConfirmMFA(ctx context.Context, req *pb.ConfirmMFARequest) (*pb.ConfirmMFAResponse, error) {
+	codes, err := h.authService.ConfirmMFAEnrollment(req.UserId, req.Code)
+	if err != nil {
+		return nil, mfaError(ctx, err)
+	}
+
+	log.Printf("🔐 Two-factor authentication enabled: ID=%s", req.UserId)
+
+	return &pb.ConfirmMFAResponse{RecoveryCodes: codes}, nil
+}
+
+func (h *AuthHandler) DisableMFA(ctx context.Context, req *pb.DisableMFARequest) (*pb.DisableMFAResponse, error) {
+	if err := h.authService.DisableMFA(req.UserId, req.CurrentPassword, req.Code, clientInfo(ctx)); err != nil {
+		return nil, mfaError(ctx, err)
+	}
+
+	log.Printf("🔓 Two-factor authentication disabled: ID=%s", req.UserId)
+
+	return &pb.DisableMFAResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(ctx context.Context, req *pb.RegenerateRecoveryCodesRequest) (*pb.RegenerateRecoveryCodesResponse, error) {
+	codes, err := h.authService.RegenerateRecoveryCodes(req.UserId, req.CurrentPassword, req.Code, clientInfo(ctx))
+	if err != nil {
+		return nil, mfaError(ctx, err)
+	}
+
+	return &pb.RegenerateRecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (h *AuthHandler) VerifyMFA(ctx context.Context, req *pb.VerifyMFARequest) (*pb.VerifyMFAResponse, error) {
+	result, err := h.authService.VerifyMFA(req.MfaToken, req.Code, clientInfo(ctx))
+	if err != nil {
+		return nil, loginError(ctx, err)
+	}
+
+	log.Printf("✅ User logged in with two-factor authentication: ID=%s", result.User.ID)
+
+	return &pb.VerifyMFAResponse{
+		Token:        result.Tokens.AccessToken,
+		UserId:       result.User.ID,
+		Name:         result.User.Name,
+		RefreshToken: result.Tokens.RefreshToken,
+		ExpiresIn:    int64(result.Tokens.ExpiresIn.Seconds()),
+		Email:        result.User.Email,
+		Roles:        result.Roles,
+	}, nil
+}
+
+func (h *AuthHandler) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	sessions, err := h.authService.ListSessions(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListSessionsResponse{Sessions: make([]*pb.Session, 0, len(sessions))}
+	for _, s := range sessions {
+		resp.Sessions = append(resp.Sessions, &pb.Session{
+			Id:         s.ID,
+			UserAgent:  s.UserAgent,
+			IpAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt.Unix(),
+			LastSeenAt: s.LastSeenAt.Unix(),
+			Current:    s.ID == req.CurrentSessionId,
+		})
+	}
+
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	err := h.authService.RevokeSession(req.UserId, req.SessionId)
+	if errors.Is(err, service.ErrSessionNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔒 Session revoked: ID=%s session=%s", req.UserId, req.SessionId)
+
+	return &pb.RevokeSessionResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.CreateAPIKeyResponse, error) {
+	key, rawKey, err := h.authService.CreateAPIKey(req.UserId, req.Name, req.Scopes, time.Duration(req.ExpiresIn)*time.Second)
+	if errors.Is(err, service.ErrInvalidScope) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, service.ErrAPIKeyNameRequired) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔑 API key created: ID=%s key=%s", req.UserId, key.Prefix)
+
+	return &pb.CreateAPIKeyResponse{ApiKey: apiKeyToProto(key), Key: rawKey}, nil
+}
+
+func (h *AuthHandler) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysRequest) (*pb.ListAPIKeysResponse, error) {
+	keys, err := h.authService.ListAPIKeys(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListAPIKeysResponse{ApiKeys: make([]*pb.APIKey, 0, len(keys))}
+	for i := range keys {
+		resp.ApiKeys = append(resp.ApiKeys, apiKeyToProto(&keys[i]))
+	}
+
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*pb.RevokeAPIKeyResponse, error) {
+	err := h.authService.RevokeAPIKey(req.UserId, req.KeyId)
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔒 API key revoked: ID=%s key=%s", req.UserId, req.KeyId)
+
+	return &pb.RevokeAPIKeyResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) ValidateAPIKey(ctx context.Context, req *pb.ValidateAPIKeyRequest) (*pb.ValidateAPIKeyResponse, error) {
+	principal, err := h.authService.ValidateAPIKey(req.Key)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		return &pb.ValidateAPIKeyResponse{Valid: false, Error: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ValidateAPIKeyResponse{
+		Valid:         true,
+		UserId:        principal.User.ID,
+		Roles:         principal.Roles,
+		Permissions:   principal.Permissions,
+		EmailVerified: principal.User.EmailVerified,
+		KeyId:         principal.Key.ID,
+		ExpiresAt:     principal.Key.ExpiresAt.Unix(),
+	}, nil
+}
+
+func (h *AuthHandler) ListOAuthProviders(ctx context.Context, req *pb.ListOAuthProvidersRequest) (*pb.ListOAuthProvidersResponse, error) {
+	return &pb.ListOAuthProvidersResponse{Providers: h.authService.OAuthProviders()}, nil
+}
+
+func (h *AuthHandler) StartOAuthLogin(ctx context.Context, req *pb.StartOAuthLoginRequest) (*pb.StartOAuthLoginResponse, error) {
+	authURL, err := h.authService.StartOAuthLogin(ctx, req.Provider)
+	if err != nil {
+		return nil, oauthError(ctx, err)
+	}
+
+	return &pb.StartOAuthLoginResponse{AuthorizationUrl: authURL}, nil
+}
+
+func (h *AuthHandler) CompleteOAuthLogin(ctx context.Context, req *pb.CompleteOAuthLoginRequest) (*pb.CompleteOAuthLoginResponse, error) {
+	result, err := h.authService.CompleteOAuthLogin(ctx, req.Provider, req.State, req.Code, clientInfo(ctx))
+	if err != nil {
+		return nil, oauthError(ctx, err)
+	}
+
+	if result.MFAToken != "" {
+		return &pb.CompleteOAuthLoginResponse{
+			MfaRequired: true,
+			MfaToken:    result.MFAToken,
+		}, nil
+	}
+
+	if result.Created {
+		log.Printf("✅ User registered via %s: ID=%s, Email=%s", req.Provider, result.User.ID, result.User.Email)
+	}
+
+	log.Printf("✅ User logged in via %s: ID=%s", req.Provider, result.User.ID)
+
+	return &pb.CompleteOAuthLoginResponse{
+		Token:        result.Tokens.AccessToken,
+		UserId:       result.User.ID,
+		Name:         result.User.Name,
+		RefreshToken: result.Tokens.RefreshToken,
+		ExpiresIn:    int64(result.Tokens.ExpiresIn.Seconds()),
+		Email:        result.User.Email,
+		Roles:        result.Roles,
+		NewUser:      result.Created,
+	}, nil
+}
+
+func (h *AuthHandler) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	err := h.authService.ChangePassword(req.UserId, req.SessionId, req.CurrentPassword, req.NewPassword, clientInfo(ctx))
+	if err != nil {
+		return nil, accountError(ctx, err)
+	}
+
+	log.Printf("🔒 Password changed: ID=%s", req.UserId)
+
+	return &pb.ChangePasswordResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) RequestEmailChange(ctx context.Context, req *pb.RequestEmailChangeRequest) (*pb.RequestEmailChangeResponse, error) {
+	err := h.authService.RequestEmailChange(req.UserId, req.SessionId, req.CurrentPassword, req.NewEmail, clientInfo(ctx))
+	if err != nil {
+		return nil, accountError(ctx, err)
+	}
+
+	return &pb.RequestEmailChangeResponse{
+		Message: "A confirmation link has been sent to the new email address",
+	}, nil
+}
+
+func (h *AuthHandler) ConfirmEmailChange(ctx context.Context, req *pb.ConfirmEmailChangeRequest) (*pb.ConfirmEmailChangeResponse, error) {
+	user, err := h.authService.ConfirmEmailChange(ctx, req.Token)
+	if err != nil {
+		return nil, accountError(ctx, err)
+	}
+
+	log.Printf("✅ Email changed: ID=%s, Email=%s", user.ID, user.Email)
+
+	return &pb.ConfirmEmailChangeResponse{
+		UserId: user.ID,
+		Email:  user.Email,
+	}, nil
+}
+
+func (h *AuthHandler) DeleteAccount(ctx context.Context, req *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	purgeAfter, err := h.authService.DeleteAccount(ctx, req.UserId)
+	if err != nil {
+		return nil, deletionError(err)
+	}
+
+	log.Printf("🗑️ Account deleted: ID=%s, purge after %s", req.UserId, purgeAfter.Format(time.RFC3339))
+
+	return &pb.DeleteAccountResponse{PurgeAfter: purgeAfter.Unix()}, nil
+}
+
+func (h *AuthHandler) UndeleteAccount(ctx context.Context, req *pb.UndeleteAccountRequest) (*pb.UndeleteAccountResponse, error) {
+	if err := h.authService.UndeleteAccount(ctx, req.UserId); err != nil {
+		return nil, deletionError(err)
+	}
+
+	log.Printf("♻️ Account restored: ID=%s", req.UserId)
+
+	return &pb.UndeleteAccountResponse{Success: true}, nil
+}
+
+func (h *AuthHandler) RequestDataExport(ctx context.Context, req *pb.RequestDataExportRequest) (*pb.RequestDataExportResponse, error) {
+	export, err := h.authService.RequestDataExport(req.UserId)
+	if err != nil {
+		return nil, dataExportError(err)
+	}
+
+	log.Printf("📦 Data export queued: ID=%s export=%s", req.UserId, export.ID)
+
+	return &pb.RequestDataExportResponse{Export: dataExportToProto(export)}, nil
+}
+
+func (h *AuthHandler) GetDataExport(ctx context.Context, req *pb.GetDataExportRequest) (*pb.GetDataExportResponse, error) {
+	export, err := h.authService.GetDataExport(req.UserId, req.ExportId)
+	if err != nil {
+		return nil, dataExportError(err)
+	}
+
+	return &pb.GetDataExportResponse{Export: dataExportToProto(export)}, nil
+}
+
+func (h *AuthHandler) DownloadDataExport(ctx context.Context, req *pb.DownloadDataExportRequest) (*pb.DownloadDataExportResponse, error) {
+	archive, err := h.authService.DownloadDataExport(req.UserId, req.ExportId)
+	if err != nil {
+		return nil, dataExportError(err)
+	}
+
+	log.Printf("📦 Data export downloaded: ID=%s export=%s", req.UserId, req.ExportId)
+
+	return &pb.DownloadDataExportResponse{
+		Archive:  archive,
+		Filename: "data-export-" + req.ExportId + ".zip",
+	}, nil
+}
+
+func dataExportToProto(export *models.DataExport) *pb.DataExport {
+	resp := &pb.DataExport{
+		Id:        export.ID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt.Unix(),
+		Error:     export.Error,
+	}
+	if export.CompletedAt != nil {
+		resp.CompletedAt = export.CompletedAt.Unix()
+	}
+	if export.ExpiresAt != nil {
+		resp.ExpiresAt = export.ExpiresAt.Unix()
+	}
+	return resp
+}
+
+func apiKeyToProto(key *models.APIKey) *pb.APIKey {
+	resp := &pb.APIKey{
+		Id:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Unix(),
+		ExpiresAt: key.ExpiresAt.Unix(),
+	}
+	if key.LastUsedAt != nil {
+		resp.LastUsedAt = key.LastUsedAt.Unix()
+	}
+	return resp
+}
+
+// clientInfo describes the end user's device as forwarded by the gateway.
+// Without forwarded metadata the caller's own address is used.
+func clientInfo(ctx context.Context) service.ClientInfo {
+	var client service.ClientInfo
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-client-ip"); len(values) > 0 {
+			client.IP = values[0]
+		}
+		if values := md.Get("x-user-agent"); len(values) > 0 {
+			client.UserAgent = values[0]
+		}
+	}
+
+	if client.IP == "" {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+				client.IP = host
+			}
+		}
+	}
+
+	return client
+}
+
+// loginError maps Login failures to status codes the gateway can turn into 401/423/429/403.
+// Throttled attempts carry a retry-after trailer in seconds.
+func loginError(ctx context.Context, err error) error {
+	var throttled *service.ThrottleError
+
+	switch {
+	case errors.As(err, &throttled):
+		seconds := int64(throttled.RetryAfter.Seconds() + 0.999)
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10)))
+
+		if throttled.Locked {
+			return status.Error(codes.FailedPrecondition, throttled.Error())
+		}
+		return status.Error(codes.ResourceExhausted, throttled.Error())
+	case errors.Is(err, service.ErrInvalidCredentials),
+		errors.Is(err, service.ErrInvalidMFACode),
+		errors.Is(err, service.ErrInvalidMFAChallenge):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// mfaError maps MFA management failures to status codes; password and throttling failures are
+// handled like a password change
+func mfaError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrMFANotEnabled):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return accountError(ctx, err)
+	}
+}
+
+// oauthError maps OAuth login failures to status codes; anything else is treated like a Login failure
+func oauthError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownProvider):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidOAuthState),
+		errors.Is(err, service.ErrOAuthExchangeFailed):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrOAuthEmailMissing):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrOAuthEmailUnverified):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrProfileCreationFailed):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return loginError(ctx, err)
+	}
+}
+
+// accountError maps password and email change failures to status codes; throttling is handled like Login
+func accountError(ctx context.Context, err error) error {
+	var invalid *service.ValidationError
+
+	switch {
+	case errors.As(err, &invalid):
+		return validationError(err)
+	case errors.Is(err, service.ErrInvalidEmail),
+		errors.Is(err, service.ErrSameEmail),
+		errors.Is(err, service.ErrInvalidEmailChangeToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrIncorrectPassword),
+		errors.Is(err, service.ErrNoPassword):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrEmailInUse):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return loginError(ctx, err)
+	}
+}
+
+// deletionError maps DeleteAccount and UndeleteAccount failures; profile failures changed nothing and can be retried
+func deletionError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrAccountNotDeleted):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrProfileUpdateFailed):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func dataExportError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrDataExportNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrDataExportNotReady):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// registerError maps Register failures; a failed profile creation was rolled back and can be retried
+func registerError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrProfileCreationFailed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, service.ErrEmailRegistered):
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return validationError(err)
+}
+
+// tokenError maps failures of calls that redeem a token: a bad or replayed token is the caller's
+// problem, a bad new password comes back field by field, anything else is internal
+func tokenError(err error) error {
+	var invalid *service.ValidationError
+
+	switch {
+	case errors.As(err, &invalid):
+		return validationError(err)
+	case errors.Is(err, service.ErrInvalidAccessToken),
+		errors.Is(err, service.ErrInvalidRefreshToken),
+		errors.Is(err, service.ErrRefreshTokenReused):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrInvalidResetToken),
+		errors.Is(err, service.ErrInvalidVerificationToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// validationError turns a ValidationError into INVALID_ARGUMENT with a BadRequest detail listing
+// each field, so the gateway can render them one by one. Other errors are returned unchanged.
+func validationError(err error) error {
+	var invalid *service.ValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, f := range invalid.Fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       f.Field,
+			Reason:      f.Code,
+			Description: f.Message,
+		})
+	}
+
+	st, detailErr := status.New(codes.InvalidArgument, invalid.Error()).WithDetails(badRequest)
+	if detailErr != nil {
+		return status.Error(codes.InvalidArgument, invalid.Error())
+	}
+	return st.Err()
+}
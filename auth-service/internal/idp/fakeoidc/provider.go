@@ -0,0 +1,247 @@
+// Package fakeoidc is a minimal OpenID Connect provider for local development and tests.
+// It signs in anyone without a password: the identity comes from the authorize request
+// (login_hint is the email; name, email_verified=false and deny=1 are optional).
+package fakeoidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "fake-oidc-1"
+
+// Config describes the provider and the one client it accepts
+type Config struct {
+	Issuer       string // Used by the relying party's server: discovery, token and keys
+	PublicURL    string // Used by the browser: the authorize endpoint; defaults to Issuer
+	ClientID     string
+	ClientSecret string
+}
+
+// authCode is an issued authorization code waiting to be exchanged
+type authCode struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+	emailVerified bool
+	name          string
+	expiresAt     time.Time
+}
+
+// Provider is the fake identity provider; serve it with Handler
+type Provider struct {
+	cfg Config
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+// New creates a provider with a fresh RSA signing key
+func New(cfg Config) (*Provider, error) {
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = cfg.Issuer
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{cfg: cfg, key: key, codes: make(map[string]authCode)}, nil
+}
+
+// Handler serves discovery, authorize, token and JWKS endpoints
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	return mux
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.cfg.Issuer,
+		"authorization_endpoint":                p.cfg.PublicURL + "/authorize",
+		"token_endpoint":                        p.cfg.Issuer + "/token",
+		"jwks_uri":                              p.cfg.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize approves the login immediately and redirects back with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != p.cfg.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	params := redirectURI.Query()
+	params.Set("state", q.Get("state"))
+
+	switch {
+	case q.Get("deny") == "1":
+		params.Set("error", "access_denied")
+		params.Set("error_description", "The user declined the login")
+	case q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "response_type=code and an S256 code_challenge are required")
+	case q.Get("login_hint") == "":
+		params.Set("error", "login_required")
+		params.Set("error_description", "Pass the email to sign in as in login_hint")
+	default:
+		code := randomString()
+
+		p.mu.Lock()
+		p.codes[code] = authCode{
+			redirectURI:   q.Get("redirect_uri"),
+			codeChallenge: q.Get("code_challenge"),
+			nonce:         q.Get("nonce"),
+			email:         q.Get("login_hint"),
+			emailVerified: q.Get("email_verified") != "false",
+			name:          q.Get("name"),
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+
+		params.Set("code", code)
+	}
+
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token, checking the client, redirect URI and PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.cfg.ClientID || clientSecret != p.cfg.ClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	// Codes are single-use
+	p.mu.Lock()
+	code, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !found || time.Now().After(code.expiresAt) || code.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	if pkceChallenge(r.PostForm.Get("code_verifier")) != code.codeChallenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	sum := sha256.Sum256([]byte(code.email))
+	claims := jwt.MapClaims{
+		"iss":            p.cfg.Issuer,
+		"sub":            "fake-" + hex.EncodeToString(sum[:8]),
+		"aud":            p.cfg.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          code.email,
+		"email_verified": code.emailVerified,
+		"name":           code.name,
+	}
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, "failed to sign id_token", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": keyID,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
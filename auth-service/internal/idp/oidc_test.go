@@ -0,0 +1,205 @@
+package idp
+
+import (
+	"auth-service/internal/idp/fakeoidc"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	testClientID     = "gocommerce"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://localhost:8080/api/v1/auth/oauth/fake/callback"
+)
+
+// newFakeProvider starts a fake OIDC provider and returns a relying party configured for it.
+// issuer overrides the issuer the fake puts in its discovery document and tokens.
+func newFakeProvider(t *testing.T, issuer string) *OIDCProvider {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	if issuer == "" {
+		issuer = srv.URL
+	}
+	fake, err := fakeoidc.New(fakeoidc.Config{
+		Issuer:       issuer,
+		PublicURL:    srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+	})
+	if err != nil {
+		t.Fatalf("fakeoidc.New: %v", err)
+	}
+	srv.Config.Handler = fake.Handler()
+
+	return NewOIDCProvider(OIDCConfig{
+		Name:         "fake",
+		IssuerURL:    srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+}
+
+// authorize plays the browser: it follows the authorize URL with extra query parameters and
+// returns the code the provider redirected back with
+func authorize(t *testing.T, p *OIDCProvider, state, nonce, challenge string, extra url.Values) string {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth URL: %v", err)
+	}
+	q := u.Query()
+	for k, v := range extra {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, want 302", resp.StatusCode)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parse callback: %v", err)
+	}
+	if !strings.HasPrefix(callback.String(), testRedirectURL) {
+		t.Fatalf("redirected to %s, want %s", callback, testRedirectURL)
+	}
+	if got := callback.Query().Get("state"); got != state {
+		t.Fatalf("state = %q, want %q", got, state)
+	}
+	if errCode := callback.Query().Get("error"); errCode != "" {
+		t.Fatalf("authorize error: %s", errCode)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	p := newFakeProvider(t, "")
+	verifier, challenge, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatalf("NewPKCEVerifier: %v", err)
+	}
+
+	code := authorize(t, p, "state-1", "nonce-1", challenge, url.Values{
+		"login_hint": {"Jane@Example.com"},
+		"name":       {"Jane"},
+	})
+
+	identity, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Provider != "fake" || identity.Subject == "" {
+		t.Errorf("identity = %+v, want provider fake and a subject", identity)
+	}
+	if identity.Email != "jane@example.com" {
+		t.Errorf("Email = %q, want it lowercased", identity.Email)
+	}
+	if !identity.EmailVerified || identity.Name != "Jane" {
+		t.Errorf("identity = %+v, want a verified email and the name", identity)
+	}
+}
+
+func TestOIDCProviderExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuer   string // Issuer the fake claims to be; empty means its own URL
+		verifier func(real string) string
+		nonce    string
+	}{
+		{
+			name:     "wrong PKCE verifier",
+			verifier: func(string) string { return "not-the-verifier-that-made-the-challenge" },
+			nonce:    "nonce-1",
+		},
+		{
+			name:     "nonce from another login",
+			verifier: func(real string) string { return real },
+			nonce:    "nonce-2",
+		},
+		{
+			name:     "issuer differs from the configured one",
+			issuer:   "https://accounts.example.com",
+			verifier: func(real string) string { return real },
+			nonce:    "nonce-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeProvider(t, tt.issuer)
+			verifier, challenge, err := NewPKCEVerifier()
+			if err != nil {
+				t.Fatalf("NewPKCEVerifier: %v", err)
+			}
+
+			if tt.issuer != "" {
+				// Discovery already fails, so no login can even start
+				if _, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", challenge); err == nil {
+					t.Fatal("AuthCodeURL succeeded against a provider with a foreign issuer")
+				}
+				return
+			}
+
+			code := authorize(t, p, "state-1", "nonce-1", challenge, url.Values{"login_hint": {"jane@example.com"}})
+			if _, err := p.Exchange(context.Background(), code, tt.verifier(verifier), tt.nonce); err == nil {
+				t.Fatal("Exchange succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestOIDCProviderCodeIsSingleUse(t *testing.T) {
+	p := newFakeProvider(t, "")
+	verifier, challenge, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatalf("NewPKCEVerifier: %v", err)
+	}
+
+	code := authorize(t, p, "state-1", "nonce-1", challenge, url.Values{"login_hint": {"jane@example.com"}})
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); err == nil {
+		t.Fatal("second Exchange with the same code succeeded")
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	// Test vector from RFC 7636 appendix B
+	got := PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("PKCEChallenge = %q, want %q", got, want)
+	}
+
+	verifier, challenge, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatalf("NewPKCEVerifier: %v", err)
+	}
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("verifier length %d, RFC 7636 wants 43-128", len(verifier))
+	}
+	if PKCEChallenge(verifier) != challenge {
+		t.Error("challenge does not match the verifier")
+	}
+}
@@ -0,0 +1,306 @@
+package keys
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Supported signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a decoded signing key
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Method returns the jwt signing method matching the key's algorithm
+func (k *Key) Method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// Public returns the public half of the key
+func (k *Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// Keyring holds every key that may currently verify a token and the one key that signs new tokens.
+//
+// Lifecycle of a key:
+//
+//	created ──(rotation interval)──> replaced as signer ──(overlap)──> expired
+//
+// The overlap must be at least the access token TTL so tokens signed just
+// before a rotation keep verifying until they expire on their own.
+type Keyring struct {
+	store     repository.SigningKeyRepository
+	algorithm string
+	interval  time.Duration
+	overlap   time.Duration
+
+	mu   sync.RWMutex
+	keys []*Key // newest first
+}
+
+// NewKeyring loads the persisted keys and makes sure there is a signing key that is not due for rotation
+func NewKeyring(store repository.SigningKeyRepository, algorithm string, interval, overlap time.Duration) (*Keyring, error) {
+	if algorithm != AlgRS256 && algorithm != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	k := &Keyring{
+		store:     store,
+		algorithm: algorithm,
+		interval:  interval,
+		overlap:   overlap,
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	if err := k.RotateIfDue(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// SigningKey returns the newest key, used to sign all new tokens
+func (k *Keyring) SigningKey() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[0]
+}
+
+// VerificationKey returns the key with the given kid if it is still valid.
+// An unknown kid triggers one reload in case another instance rotated in the meantime.
+func (k *Keyring) VerificationKey(kid string) (*Key, error) {
+	if key := k.find(kid); key != nil {
+		return key, nil
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	if key := k.find(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// Keys returns every key that is currently valid for verification, newest first
+func (k *Keyring) Keys() []*Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		if now.Before(key.ExpiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RotateIfDue creates a new signing key once the current one has signed for a full interval
+func (k *Keyring) RotateIfDue() error {
+	k.mu.RLock()
+	due := len(k.keys) == 0 || time.Since(k.keys[0].CreatedAt) >= k.interval
+	k.mu.RUnlock()
+
+	if !due {
+		return nil
+	}
+	return k.Rotate()
+}
+
+// Rotate generates and persists a new signing key.
+// Previous keys stay valid for verification until their expiry.
+func (k *Keyring) Rotate() error {
+	key, err := generateKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+
+	key.CreatedAt = time.Now()
+	key.ExpiresAt = key.CreatedAt.Add(k.interval + k.overlap)
+
+	encoded, err := encodePrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+
+	err = k.store.CreateSigningKey(&models.SigningKey{
+		KID:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: encoded,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("🔑 Rotated JWT signing key: kid=%s alg=%s", key.ID, key.Algorithm)
+
+	return k.Reload()
+}
+
+// Reload replaces the in-memory keys with the ones currently valid in the store
+func (k *Keyring) Reload() error {
+	stored, err := k.store.GetValidSigningKeys(time.Now())
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*Key, 0, len(stored))
+	for _, s := range stored {
+		key, err := decodeKey(s)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", s.KID, err)
+		}
+		keys = append(keys, key)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Keep serving the old keys rather than ending up with none
+	if len(keys) > 0 {
+		k.keys = keys
+	}
+	return nil
+}
+
+// Run rotates the signing key on schedule and picks up keys rotated by other instances.
+// It blocks until ctx is cancelled.
+func (k *Keyring) Run(ctx context.Context, checkEvery time.Duration) {
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				log.Printf("Failed to reload signing keys: %v", err)
+				continue
+			}
+			if err := k.RotateIfDue(); err != nil {
+				log.Printf("Failed to rotate signing key: %v", err)
+			}
+		}
+	}
+}
+
+func (k *Keyring) find(kid string) *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.ID == kid && now.Before(key.ExpiresAt) {
+			return key
+		}
+	}
+	return nil
+}
+
+func generateKey(algorithm string) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:        uuid.New().String(),
+		Algorithm: algorithm,
+		Private:   signer,
+	}, nil
+}
+
+func encodePrivateKey(signer crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func decodeKey(stored *models.SigningKey) (*Key, error) {
+	block, _ := pem.Decode([]byte(stored.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer crypto.Signer
+	switch priv := parsed.(type) {
+	case *rsa.PrivateKey:
+		if stored.Algorithm != AlgRS256 {
+			return nil, errors.New("RSA key stored with algorithm " + stored.Algorithm)
+		}
+		signer = priv
+	case ed25519.PrivateKey:
+		if stored.Algorithm != AlgEdDSA {
+			return nil, errors.New("Ed25519 key stored with algorithm " + stored.Algorithm)
+		}
+		signer = priv
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return &Key{
+		ID:        stored.KID,
+		Algorithm: stored.Algorithm,
+		Private:   signer,
+		CreatedAt: stored.CreatedAt,
+		ExpiresAt: stored.ExpiresAt,
+	}, nil
+}
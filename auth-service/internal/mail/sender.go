@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails
+// Using an interface lets local development log mails instead of sending them
+type Sender interface {
+	Send(msg Message) error
+}
+
+// ============================================
+// LogSender: prints mails to the service log (local development)
+// ============================================
+
+type LogSender struct{}
+
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+func (s *LogSender) Send(msg Message) error {
+	log.Printf("📧 Mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// ============================================
+// FileSender: writes each mail as a .eml file (local development, manual testing)
+// ============================================
+
+type FileSender struct {
+	dir string
+}
+
+func NewFileSender(dir string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSender{dir: dir}, nil
+}
+
+func (s *FileSender) Send(msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.New().String()[:8])
+
+	return os.WriteFile(filepath.Join(s.dir, name), formatMessage("noreply@localhost", msg), 0o644)
+}
+
+// ============================================
+// SMTPSender: delivers mails through an SMTP relay (production)
+// ============================================
+
+type SMTPSender struct {
+	addr string // host:port
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPSender creates a sender using PLAIN auth; username may be empty for unauthenticated relays
+func NewSMTPSender(addr, username, password, from string) *SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		host := strings.Split(addr, ":")[0]
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPSender{addr: addr, auth: auth, from: from}
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, formatMessage(s.from, msg))
+}
+
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// APIKey lets a script act as its owner, limited to the key's scopes.
+// Only the SHA-256 hash of the key is stored; the raw value is handed out once.
+type APIKey struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	KeyHash    string     `db:"key_hash"`
+	Scopes     []string   `db:"scopes"`
+	CreatedAt  time.Time  `db:"created_at"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
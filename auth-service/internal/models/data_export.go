@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DataExport is a user's request for a copy of their data. The zip archive itself is only
+// loaded when it is downloaded.
+type DataExport struct {
+	ID          string     `db:"id"`
+	UserID      string     `db:"user_id"`
+	Status      string     `db:"status"`
+	Error       string     `db:"error"` // Why the export failed
+	CreatedAt   time.Time  `db:"created_at"`
+	CompletedAt *time.Time `db:"completed_at"`
+	ExpiresAt   *time.Time `db:"expires_at"` // The archive is deleted after this
+}
+
+// States of a data export (see DataExport.Status)
+const (
+	DataExportPending = "pending"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// EmailChangeToken proves ownership of the address a user wants to switch to.
+// Only the SHA-256 hash of the token is stored.
+type EmailChangeToken struct {
+	ID        string     `db:"id"`
+	UserID    string     `db:"user_id"`
+	NewEmail  string     `db:"new_email"`
+	TokenHash string     `db:"token_hash"`
+	SessionID string     `db:"session_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// EmailVerificationToken proves ownership of the email address a user registered with.
+// Only the SHA-256 hash of the token is stored.
+type EmailVerificationToken struct {
+	ID        string     `db:"id"`
+	UserID    string     `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
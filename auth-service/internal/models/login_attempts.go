@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempts counts consecutive failed logins for an account or a client IP
+type LoginAttempts struct {
+	Key            string
+	Failures       int
+	FirstFailureAt time.Time
+	LastFailureAt  time.Time
+	LockedUntil    *time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// MFASecret is a user's TOTP secret. It only protects logins once ConfirmedAt is set.
+type MFASecret struct {
+	UserID       string     `db:"user_id"`
+	Secret       string     `db:"secret"` // Base32, as shown to the authenticator app
+	ConfirmedAt  *time.Time `db:"confirmed_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+// MFAChallenge is handed out by Login when the password was right but a second factor is still due.
+// Only the SHA-256 hash of the token is stored.
+type MFAChallenge struct {
+	ID        string     `db:"id"`
+	UserID    string     `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	Attempts  int        `db:"attempts"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
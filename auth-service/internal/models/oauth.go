@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an external identity provider to a local user
+type UserIdentity struct {
+	Provider  string    `db:"provider"`
+	Subject   string    `db:"subject"`
+	UserID    string    `db:"user_id"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// OAuthState is an OAuth login waiting for the provider to redirect back
+type OAuthState struct {
+	ID           string     `db:"id"`
+	StateHash    string     `db:"state_hash"`
+	Provider     string     `db:"provider"`
+	CodeVerifier string     `db:"code_verifier"`
+	Nonce        string     `db:"nonce"`
+	CreatedAt    time.Time  `db:"created_at"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	UsedAt       *time.Time `db:"used_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RefreshToken is a persisted, opaque refresh token.
+// Only the SHA-256 hash of the token is stored; the raw value is handed to the client once.
+// Tokens issued from the same login share a FamilyID so a reused token can revoke the whole chain.
+type RefreshToken struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	FamilyID   string     `db:"family_id"`
+	TokenHash  string     `db:"token_hash"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`  // Set when rotated or revoked
+	ReplacedBy string     `db:"replaced_by"` // ID of the token issued when this one was rotated
+}
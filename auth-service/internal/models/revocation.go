@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RevokedToken is a single access token revoked before its expiry
+type RevokedToken struct {
+	JTI       string
+	ExpiresAt time.Time
+}
+
+// UserRevocation rejects every access token of a user issued before RevokedBefore
+type UserRevocation struct {
+	UserID        string
+	RevokedBefore time.Time
+}
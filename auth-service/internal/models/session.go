@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is one login on one device. Its ID is also the FamilyID of the refresh tokens
+// rotated from that login and the sid claim of its access tokens.
+type Session struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	UserAgent  string     `db:"user_agent"`
+	IPAddress  string     `db:"ip_address"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastSeenAt time.Time  `db:"last_seen_at"` // Last login or refresh
+	ExpiresAt  time.Time  `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
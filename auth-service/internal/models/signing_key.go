@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// SigningKey is a persisted JWT signing key
+type SigningKey struct {
+	KID        string    `db:"kid"`
+	Algorithm  string    `db:"algorithm"`
+	PrivateKey string    `db:"private_key"` // PKCS#8 PEM
+	CreatedAt  time.Time `db:"created_at"`
+	ExpiresAt  time.Time `db:"expires_at"` // After this the key is no longer accepted for verification
+}
@@ -9,4 +9,17 @@ type User struct {
 	Name      string    `json:"name" db:"name"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	LastLogin time.Time `json:"last_login" db:"last_login"`
+
+	EmailVerified   bool       `json:"email_verified" db:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+
+	ProfileStatus string `json:"profile_status" db:"profile_status"` // ProfileStatusPending until the user-service profile exists
+
+	DeletedAt *time.Time `json:"deleted_at" db:"deleted_at"` // Set when the account was deleted; it is purged after the grace period
 }
+
+// Registration states of a user (see User.ProfileStatus)
+const (
+	ProfileStatusPending = "pending"
+	ProfileStatusActive  = "active"
+)
@@ -0,0 +1,108 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefixLength is how many hex characters of the SHA-1 form a range, as in the Pwned Passwords API
+const prefixLength = 5
+
+// BreachedList is an offline copy of breached password hashes, grouped by SHA-1 prefix the way
+// k-anonymity range queries return them. Passwords are only ever looked up by hash.
+type BreachedList struct {
+	ranges map[string]map[string]struct{} // prefix -> hash suffixes
+	size   int
+}
+
+// LoadBreachedList reads a file of uppercase or lowercase SHA-1 hashes, one per line.
+// Both the full "HASH:COUNT" download format and range files with "PREFIX" headers are accepted:
+//
+//	5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493
+//
+//	# range 5BAA6
+//	1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493
+//
+// Blank lines and lines starting with # (other than range headers) are skipped.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachedList{ranges: make(map[string]map[string]struct{})}
+	currentRange := ""
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			if prefix, ok := strings.CutPrefix(text, "# range "); ok {
+				currentRange = strings.ToUpper(strings.TrimSpace(prefix))
+				if len(currentRange) != prefixLength {
+					return nil, fmt.Errorf("%s:%d: range prefix must be %d characters", path, line, prefixLength)
+				}
+			}
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(strings.TrimSpace(hash))
+		if len(hash) == sha1.Size*2-prefixLength {
+			hash = currentRange + hash
+		}
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: expected a SHA-1 hash", path, line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: expected a SHA-1 hash", path, line)
+		}
+
+		list.add(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Size is the number of hashes loaded
+func (l *BreachedList) Size() int {
+	return l.size
+}
+
+// IsBreached hashes the password and checks the suffixes of its range
+func (l *BreachedList) IsBreached(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, ok := l.ranges[hash[:prefixLength]]
+	if !ok {
+		return false
+	}
+	_, found := suffixes[hash[prefixLength:]]
+	return found
+}
+
+func (l *BreachedList) add(hash string) {
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	suffixes, ok := l.ranges[prefix]
+	if !ok {
+		suffixes = make(map[string]struct{})
+		l.ranges[prefix] = suffixes
+	}
+	if _, exists := suffixes[suffix]; !exists {
+		suffixes[suffix] = struct{}{}
+		l.size++
+	}
+}
@@ -0,0 +1,187 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms a Hasher can produce
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+// ErrUnknownHashFormat is returned for stored hashes no supported algorithm can read
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PHC strings encode salts and hashes in unpadded standard base64
+var phcEncoding = base64.RawStdEncoding
+
+// MaxArgon2Memory caps the memory of an Argon2id hash, configured or stored, so a single hash cannot
+// make every login allocate an arbitrary amount (KiB)
+const MaxArgon2Memory = 256 * 1024
+
+// Argon2Params are the tunable costs of Argon2id (RFC 9106)
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Hasher hashes new passwords with the current algorithm and verifies hashes made by any supported one.
+// Argon2id hashes use the PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//
+// bcrypt hashes keep their standard $2a$/$2b$ form, which PHC tooling reads as the bcrypt id.
+type Hasher struct {
+	Algorithm  string // Algorithm for new hashes: AlgArgon2id or AlgBcrypt
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultHasher uses Argon2id with the OWASP-recommended minimum of 19 MiB, 2 passes and 1 lane
+func DefaultHasher() Hasher {
+	return Hasher{
+		Algorithm:  AlgArgon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		Argon2: Argon2Params{
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+}
+
+// Validate reports parameters that cannot produce a usable hash, e.g. from a misconfiguration
+func (h Hasher) Validate() error {
+	switch h.Algorithm {
+	case AlgBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgArgon2id:
+		p := h.Argon2
+		if p.Iterations < 1 || p.Parallelism < 1 {
+			return errors.New("argon2id needs at least 1 iteration and 1 lane")
+		}
+		// RFC 9106 requires at least 8 KiB per lane
+		if p.Memory < 8*uint32(p.Parallelism) || p.Memory > MaxArgon2Memory {
+			return fmt.Errorf("argon2id memory must be between %d and %d KiB", 8*uint32(p.Parallelism), MaxArgon2Memory)
+		}
+		if p.SaltLength < 8 || p.KeyLength < 16 {
+			return errors.New("argon2id needs a salt of at least 8 bytes and a key of at least 16")
+		}
+	default:
+		return fmt.Errorf("unsupported password hash algorithm %q", h.Algorithm)
+	}
+	return nil
+}
+
+// Hash encodes a new password with the current algorithm and parameters
+func (h Hasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case AlgBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hash), err
+	case AlgArgon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Iterations, h.Argon2.Memory, h.Argon2.Parallelism, h.Argon2.KeyLength)
+
+		return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", AlgArgon2id, argon2.Version,
+			h.Argon2.Memory, h.Argon2.Iterations, h.Argon2.Parallelism,
+			phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm %q", h.Algorithm)
+	}
+}
+
+// Verify checks a password against a stored hash. needsRehash is true when the password matched but
+// the hash was made with another algorithm or weaker parameters than the current ones.
+func (h Hasher) Verify(password, encoded string) (ok, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.Algorithm != AlgBcrypt || cost < h.BcryptCost, nil
+
+	case strings.HasPrefix(encoded, "$"+AlgArgon2id+"$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false, err
+		}
+
+		candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false, nil
+		}
+
+		current := h.Argon2
+		weaker := params.Memory < current.Memory || params.Iterations < current.Iterations ||
+			params.Parallelism != current.Parallelism || params.KeyLength < current.KeyLength ||
+			params.SaltLength < current.SaltLength
+		return true, h.Algorithm != AlgArgon2id || weaker, nil
+
+	default:
+		return false, false, ErrUnknownHashFormat
+	}
+}
+
+// decodeArgon2id parses "$argon2id$v=19$m=...,t=...,p=...$salt$hash"
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	// argon2.IDKey panics without passes or lanes, and the memory is allocated on every login
+	if params.Iterations < 1 || params.Parallelism < 1 || params.Memory > MaxArgon2Memory {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := phcEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	// An empty key would match every password
+	key, err := phcEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,171 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Costs small enough to keep the tests fast
+func testArgon2(memory, iterations uint32, parallelism uint8) Hasher {
+	return Hasher{
+		Algorithm: AlgArgon2id,
+		Argon2:    Argon2Params{Memory: memory, Iterations: iterations, Parallelism: parallelism, SaltLength: 16, KeyLength: 32},
+	}
+}
+
+func testBcrypt(cost int) Hasher {
+	return Hasher{Algorithm: AlgBcrypt, BcryptCost: cost}
+}
+
+func TestHasherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		hasher     Hasher
+		wantPrefix string
+	}{
+		{name: "argon2id", hasher: testArgon2(64, 1, 1), wantPrefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{name: "bcrypt", hasher: testBcrypt(4), wantPrefix: "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("correct horse battery")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !strings.HasPrefix(encoded, tt.wantPrefix) {
+				t.Errorf("Hash = %q, want prefix %q", encoded, tt.wantPrefix)
+			}
+
+			again, _ := tt.hasher.Hash("correct horse battery")
+			if again == encoded {
+				t.Error("two hashes of the same password are equal; salt missing")
+			}
+
+			ok, needsRehash, err := tt.hasher.Verify("correct horse battery", encoded)
+			if err != nil || !ok || needsRehash {
+				t.Errorf("Verify(right password) = %v, %v, %v; want true, false, nil", ok, needsRehash, err)
+			}
+			ok, needsRehash, err = tt.hasher.Verify("wrong password", encoded)
+			if err != nil || ok || needsRehash {
+				t.Errorf("Verify(wrong password) = %v, %v, %v; want false, false, nil", ok, needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  Hasher // Made the stored hash
+		current Hasher // Verifies it
+		want    bool
+	}{
+		{name: "bcrypt to argon2id", stored: testBcrypt(4), current: testArgon2(64, 1, 1), want: true},
+		{name: "argon2id to bcrypt", stored: testArgon2(64, 1, 1), current: testBcrypt(4), want: true},
+		{name: "bcrypt cost raised", stored: testBcrypt(4), current: testBcrypt(5), want: true},
+		{name: "bcrypt cost lowered", stored: testBcrypt(5), current: testBcrypt(4)},
+		{name: "argon2id memory raised", stored: testArgon2(64, 1, 1), current: testArgon2(128, 1, 1), want: true},
+		{name: "argon2id iterations raised", stored: testArgon2(64, 1, 1), current: testArgon2(64, 2, 1), want: true},
+		{name: "argon2id lanes changed", stored: testArgon2(64, 1, 1), current: testArgon2(64, 1, 2), want: true},
+		{name: "argon2id costs lowered", stored: testArgon2(128, 2, 1), current: testArgon2(64, 1, 1)},
+		{name: "same argon2id costs", stored: testArgon2(64, 1, 1), current: testArgon2(64, 1, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.stored.Hash("correct horse battery")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+
+			ok, needsRehash, err := tt.current.Verify("correct horse battery", encoded)
+			if err != nil || !ok {
+				t.Fatalf("Verify = %v, %v; want a match", ok, err)
+			}
+			if needsRehash != tt.want {
+				t.Errorf("needsRehash = %v, want %v", needsRehash, tt.want)
+			}
+		})
+	}
+}
+
+// A bcrypt hash flagged for rehash is replaced by one the current hasher accepts as is
+func TestRehashBcryptToArgon2id(t *testing.T) {
+	current := testArgon2(64, 1, 1)
+	old, _ := testBcrypt(4).Hash("correct horse battery")
+
+	if _, needsRehash, _ := current.Verify("correct horse battery", old); !needsRehash {
+		t.Fatal("bcrypt hash not flagged for rehash")
+	}
+
+	upgraded, err := current.Hash("correct horse battery")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	ok, needsRehash, err := current.Verify("correct horse battery", upgraded)
+	if err != nil || !ok || needsRehash {
+		t.Errorf("Verify(upgraded) = %v, %v, %v; want true, false, nil", ok, needsRehash, err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	const salt, key = "c29tZXNhbHRzb21lc2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "empty", encoded: ""},
+		{name: "plain text", encoded: "correct horse battery"},
+		{name: "unsupported algorithm", encoded: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "missing segment", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "other version", encoded: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "garbled parameters", encoded: "$argon2id$v=19$memory=64$" + salt + "$" + key},
+		{name: "no iterations", encoded: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{name: "no lanes", encoded: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{name: "too many lanes", encoded: "$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key},
+		{name: "memory over the cap", encoded: "$argon2id$v=19$m=4194304,t=1,p=1$" + salt + "$" + key},
+		{name: "empty salt", encoded: "$argon2id$v=19$m=64,t=1,p=1$$" + key},
+		{name: "empty key", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+		{name: "salt not base64", encoded: "$argon2id$v=19$m=64,t=1,p=1$not base64!$" + key},
+		{name: "key not base64", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$not base64!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, _, err := testArgon2(64, 1, 1).Verify("", tt.encoded)
+			if ok || !errors.Is(err, ErrUnknownHashFormat) {
+				t.Errorf("Verify(%q) = %v, %v; want false, %v", tt.encoded, ok, err, ErrUnknownHashFormat)
+			}
+		})
+	}
+}
+
+func TestHasherValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hasher  Hasher
+		wantErr bool
+	}{
+		{name: "default", hasher: DefaultHasher()},
+		{name: "bcrypt", hasher: testBcrypt(12)},
+		{name: "bcrypt cost too low", hasher: testBcrypt(3), wantErr: true},
+		{name: "bcrypt cost too high", hasher: testBcrypt(32), wantErr: true},
+		{name: "argon2id", hasher: testArgon2(64*1024, 3, 4)},
+		{name: "argon2id without iterations", hasher: testArgon2(64, 0, 1), wantErr: true},
+		{name: "argon2id without lanes", hasher: testArgon2(64, 1, 0), wantErr: true},
+		{name: "argon2id memory below 8 KiB per lane", hasher: testArgon2(31, 1, 4), wantErr: true},
+		{name: "argon2id memory over the cap", hasher: testArgon2(MaxArgon2Memory+1, 1, 1), wantErr: true},
+		{name: "unknown algorithm", hasher: Hasher{Algorithm: "scrypt"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.hasher.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// bcryptMaxBytes is the longest input bcrypt uses; anything after it is ignored or rejected
+const bcryptMaxBytes = 72
+
+// Codes identifying why a password was rejected, stable for clients to translate
+const (
+	CodeRequired             = "required"
+	CodeTooShort             = "too_short"
+	CodeTooLong              = "too_long"
+	CodeCharClasses          = "not_enough_character_classes"
+	CodeContainsPersonalInfo = "contains_personal_info"
+	CodeBreached             = "breached"
+)
+
+// Violation is one rule a password breaks
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// BreachChecker tells whether a password is known from data breaches
+type BreachChecker interface {
+	IsBreached(password string) bool
+}
+
+// Policy describes what a new password must look like
+type Policy struct {
+	MinLength          int  // Minimum number of characters
+	MaxBytes           int  // Maximum length in bytes, at most bcrypt's 72
+	MinCharClasses     int  // How many of lowercase, uppercase, digits and symbols must appear
+	RejectPersonalInfo bool // Refuse passwords containing the email or a part of the name
+
+	Breached BreachChecker // Known breached passwords; nil skips the check
+}
+
+// DefaultPolicy asks for 8 characters from at least 3 classes, without personal info
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:          8,
+		MaxBytes:           bcryptMaxBytes,
+		MinCharClasses:     3,
+		RejectPersonalInfo: true,
+	}
+}
+
+// Check returns every rule the password breaks, or nil if it is acceptable.
+// email and name belong to the account and may be empty.
+func (p Policy) Check(password, email, name string) []Violation {
+	if password == "" {
+		return []Violation{{Code: CodeRequired, Message: "password is required"}}
+	}
+
+	var violations []Violation
+
+	if n := len([]rune(password)); n < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	maxBytes := p.MaxBytes
+	if maxBytes <= 0 || maxBytes > bcryptMaxBytes {
+		maxBytes = bcryptMaxBytes
+	}
+	if len(password) > maxBytes {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("password must be at most %d bytes long", maxBytes),
+		})
+	}
+
+	if charClasses(password) < p.MinCharClasses {
+		violations = append(violations, Violation{
+			Code:    CodeCharClasses,
+			Message: fmt.Sprintf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharClasses),
+		})
+	}
+
+	if p.RejectPersonalInfo && containsPersonalInfo(password, email, name) {
+		violations = append(violations, Violation{
+			Code:    CodeContainsPersonalInfo,
+			Message: "password must not contain your email address or name",
+		})
+	}
+
+	// Only worth asking once the password is otherwise acceptable
+	if len(violations) == 0 && p.Breached != nil && p.Breached.IsBreached(password) {
+		violations = append(violations, Violation{
+			Code:    CodeBreached,
+			Message: "password has appeared in a data breach, please choose another one",
+		})
+	}
+
+	return violations
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// containsPersonalInfo looks for the email, its local part or any name part of 3+ characters
+func containsPersonalInfo(password, email, name string) bool {
+	password = strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(name))
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		parts = append(parts, email)
+		if local, _, found := strings.Cut(email, "@"); found {
+			parts = append(parts, local)
+		}
+	}
+
+	for _, part := range parts {
+		if len([]rune(part)) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
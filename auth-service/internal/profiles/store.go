@@ -0,0 +1,137 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+
+	userpb "go-project/proto/user"
+)
+
+// Store is the part of user-service that auth-service keeps in step with its own users
+type Store interface {
+	// CreateProfile is idempotent: creating the same user again succeeds
+	CreateProfile(ctx context.Context, userID, email, name string) error
+	// DeleteProfile removes a profile for good; a missing profile is not an error
+	DeleteProfile(ctx context.Context, userID string) error
+	// SoftDeleteProfile hides a profile until RestoreProfile or DeleteProfile
+	SoftDeleteProfile(ctx context.Context, userID string) error
+	RestoreProfile(ctx context.Context, userID string) error
+	UpdateEmail(ctx context.Context, userID, email string) error
+	// ListProfileIDs pages through every profile ID in byte order
+	ListProfileIDs(ctx context.Context, afterID string, limit int) ([]string, error)
+	// ExportProfile returns the profile, addresses and preferences as a JSON document
+	ExportProfile(ctx context.Context, userID string) ([]byte, error)
+}
+
+// GRPCStore talks to user-service over gRPC
+type GRPCStore struct {
+	client userpb.UserServiceClient
+}
+
+func NewGRPCStore(client userpb.UserServiceClient) Store {
+	return &GRPCStore{client: client}
+}
+
+func (s *GRPCStore) CreateProfile(ctx context.Context, userID, email, name string) error {
+	resp, err := s.client.CreateUser(ctx, &userpb.CreateUserRequest{
+		UserId: userID,
+		Email:  email,
+		Name:   name,
+		Phone:  "",
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+func (s *GRPCStore) DeleteProfile(ctx context.Context, userID string) error {
+	resp, err := s.client.DeleteUser(ctx, &userpb.DeleteUserRequest{
+		UserId: userID,
+		Purge:  true,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+func (s *GRPCStore) SoftDeleteProfile(ctx context.Context, userID string) error {
+	resp, err := s.client.DeleteUser(ctx, &userpb.DeleteUserRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+func (s *GRPCStore) RestoreProfile(ctx context.Context, userID string) error {
+	resp, err := s.client.UndeleteUser(ctx, &userpb.UndeleteUserRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+func (s *GRPCStore) UpdateEmail(ctx context.Context, userID, email string) error {
+	resp, err := s.client.UpdateEmail(ctx, &userpb.UpdateEmailRequest{
+		UserId: userID,
+		Email:  email,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+func (s *GRPCStore) ListProfileIDs(ctx context.Context, afterID string, limit int) ([]string, error) {
+	resp, err := s.client.ListUserIDs(ctx, &userpb.ListUserIDsRequest{
+		AfterId: afterID,
+		Limit:   int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.UserIds, nil
+}
+
+func (s *GRPCStore) ExportProfile(ctx context.Context, userID string) ([]byte, error) {
+	resp, err := s.client.ExportUserData(ctx, &userpb.ExportUserDataRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Data, nil
+}
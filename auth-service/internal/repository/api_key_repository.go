@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(key *models.APIKey) error
+	GetAPIKeyByHash(keyHash string) (*models.APIKey, error)
+	// ListAPIKeys returns the user's keys that are not revoked, newest first (expired ones included)
+	ListAPIKeys(userID string) ([]models.APIKey, error)
+	// RevokeAPIKey revokes one of the user's keys; false means the user has no such active key
+	RevokeAPIKey(userID, id string) (bool, error)
+	RevokeUserAPIKeys(userID string) error
+	TouchAPIKey(id string, usedAt time.Time) error
+}
+
+type PostgresAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &PostgresAPIKeyRepository{db: db}
+}
+
+// apiKeyColumns is the column list matching scanAPIKey
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func (r *PostgresAPIKeyRepository) CreateAPIKey(key *models.APIKey) error {
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+
+	query := `INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := r.db.Exec(query, key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes),
+		key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+func (r *PostgresAPIKeyRepository) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(r.db.QueryRow(query, keyHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+func (r *PostgresAPIKeyRepository) ListAPIKeys(userID string) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *PostgresAPIKeyRepository) RevokeAPIKey(userID, id string) (bool, error) {
+	query := `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, time.Now(), id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *PostgresAPIKeyRepository) RevokeUserAPIKeys(userID string) error {
+	_, err := r.db.Exec(`UPDATE api_keys SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, time.Now(), userID)
+	return err
+}
+
+func (r *PostgresAPIKeyRepository) TouchAPIKey(id string, usedAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, usedAt, id)
+	return err
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	k := &models.APIKey{}
+
+	err := row.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.Name,
+		&k.Prefix,
+		&k.KeyHash,
+		pq.Array(&k.Scopes),
+		&k.CreatedAt,
+		&k.ExpiresAt,
+		&k.LastUsedAt,
+		&k.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
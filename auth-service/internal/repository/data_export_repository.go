@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DataExportRepository interface {
+	CreateDataExport(export *models.DataExport) error
+	// GetDataExport returns one of the user's exports, without the archive; nil if there is none
+	GetDataExport(userID, id string) (*models.DataExport, error)
+	// GetUnfinishedDataExport returns the user's pending or running export, if any
+	GetUnfinishedDataExport(userID string) (*models.DataExport, error)
+	// ClaimDataExport marks the oldest pending export as running and returns it; exports claimed before
+	// staleBefore are handed out again, as their worker is assumed dead. nil means there is nothing to do.
+	ClaimDataExport(staleBefore time.Time) (*models.DataExport, error)
+	CompleteDataExport(id string, archive []byte, expiresAt time.Time) error
+	FailDataExport(id, reason string, expiresAt time.Time) error
+	// GetDataExportArchive returns the archive of one of the user's ready exports; nil if it is not ready or expired
+	GetDataExportArchive(userID, id string) ([]byte, error)
+	DeleteExpiredDataExports(now time.Time) (int64, error)
+}
+
+type PostgresDataExportRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresDataExportRepository(db *sql.DB) DataExportRepository {
+	return &PostgresDataExportRepository{db: db}
+}
+
+// dataExportColumns is the column list matching scanDataExport
+const dataExportColumns = `id, user_id, status, error, created_at, completed_at, expires_at`
+
+func (r *PostgresDataExportRepository) CreateDataExport(export *models.DataExport) error {
+	export.ID = uuid.New().String()
+	export.Status = models.DataExportPending
+	export.CreatedAt = time.Now()
+
+	query := `INSERT INTO data_exports (id, user_id, status, created_at) VALUES ($1, $2, $3, $4)`
+
+	_, err := r.db.Exec(query, export.ID, export.UserID, export.Status, export.CreatedAt)
+	return err
+}
+
+func (r *PostgresDataExportRepository) GetDataExport(userID, id string) (*models.DataExport, error) {
+	query := `SELECT ` + dataExportColumns + ` FROM data_exports WHERE id = $1 AND user_id = $2`
+
+	export, err := scanDataExport(r.db.QueryRow(query, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return export, err
+}
+
+func (r *PostgresDataExportRepository) GetUnfinishedDataExport(userID string) (*models.DataExport, error) {
+	query := `SELECT ` + dataExportColumns + ` FROM data_exports
+		WHERE user_id = $1 AND status IN ($2, $3)
+		ORDER BY created_at DESC LIMIT 1`
+
+	export, err := scanDataExport(r.db.QueryRow(query, userID, models.DataExportPending, models.DataExportRunning))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return export, err
+}
+
+func (r *PostgresDataExportRepository) ClaimDataExport(staleBefore time.Time) (*models.DataExport, error) {
+	// SKIP LOCKED lets several auth-service instances work through the queue side by side
+	query := `UPDATE data_exports SET status = $1, claimed_at = $2
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = $3 OR (status = $1 AND claimed_at < $4)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + dataExportColumns
+
+	export, err := scanDataExport(r.db.QueryRow(query, models.DataExportRunning, time.Now(),
+		models.DataExportPending, staleBefore))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return export, err
+}
+
+func (r *PostgresDataExportRepository) CompleteDataExport(id string, archive []byte, expiresAt time.Time) error {
+	query := `UPDATE data_exports SET status = $1, archive = $2, completed_at = $3, expires_at = $4 WHERE id = $5`
+
+	_, err := r.db.Exec(query, models.DataExportReady, archive, time.Now(), expiresAt, id)
+	return err
+}
+
+func (r *PostgresDataExportRepository) FailDataExport(id, reason string, expiresAt time.Time) error {
+	query := `UPDATE data_exports SET status = $1, error = $2, completed_at = $3, expires_at = $4 WHERE id = $5`
+
+	_, err := r.db.Exec(query, models.DataExportFailed, reason, time.Now(), expiresAt, id)
+	return err
+}
+
+func (r *PostgresDataExportRepository) GetDataExportArchive(userID, id string) ([]byte, error) {
+	var archive []byte
+
+	query := `SELECT archive FROM data_exports
+		WHERE id = $1 AND user_id = $2 AND status = $3 AND expires_at > $4`
+
+	err := r.db.QueryRow(query, id, userID, models.DataExportReady, time.Now()).Scan(&archive)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func (r *PostgresDataExportRepository) DeleteExpiredDataExports(now time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM data_exports WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanDataExport(row rowScanner) (*models.DataExport, error) {
+	e := &models.DataExport{}
+
+	err := row.Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Status,
+		&e.Error,
+		&e.CreatedAt,
+		&e.CompletedAt,
+		&e.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IdentityRepository interface {
+	CreateOAuthState(state *models.OAuthState) error
+	// ConsumeOAuthState marks an unused state as used and returns it; nil if it is unknown or was used already
+	ConsumeOAuthState(stateHash string) (*models.OAuthState, error)
+
+	GetIdentity(provider, subject string) (*models.UserIdentity, error)
+	// LinkIdentity is a no-op if the identity is already linked
+	LinkIdentity(identity *models.UserIdentity) error
+	// ListIdentities returns the identities linked to a user, oldest first
+	ListIdentities(userID string) ([]models.UserIdentity, error)
+}
+
+type PostgresIdentityRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityRepository(db *sql.DB) IdentityRepository {
+	return &PostgresIdentityRepository{db: db}
+}
+
+func (r *PostgresIdentityRepository) CreateOAuthState(state *models.OAuthState) error {
+	state.ID = uuid.New().String()
+	state.CreatedAt = time.Now()
+
+	query := `INSERT INTO oauth_states (id, state_hash, provider, code_verifier, nonce, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := r.db.Exec(query, state.ID, state.StateHash, state.Provider, state.CodeVerifier, state.Nonce,
+		state.CreatedAt, state.ExpiresAt)
+	return err
+}
+
+func (r *PostgresIdentityRepository) ConsumeOAuthState(stateHash string) (*models.OAuthState, error) {
+	state := &models.OAuthState{}
+
+	// A single UPDATE so a replayed callback can never use the same state twice
+	query := `UPDATE oauth_states SET used_at = $1 WHERE state_hash = $2 AND used_at IS NULL
+		RETURNING id, state_hash, provider, code_verifier, nonce, created_at, expires_at, used_at`
+
+	err := r.db.QueryRow(query, time.Now(), stateHash).Scan(&state.ID, &state.StateHash, &state.Provider,
+		&state.CodeVerifier, &state.Nonce, &state.CreatedAt, &state.ExpiresAt, &state.UsedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (r *PostgresIdentityRepository) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+	identity := &models.UserIdentity{}
+
+	query := `SELECT provider, subject, user_id, email, created_at FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	err := r.db.QueryRow(query, provider, subject).Scan(&identity.Provider, &identity.Subject, &identity.UserID,
+		&identity.Email, &identity.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (r *PostgresIdentityRepository) LinkIdentity(identity *models.UserIdentity) error {
+	identity.CreatedAt = time.Now()
+
+	query := `INSERT INTO user_identities (provider, subject, user_id, email, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider, subject) DO NOTHING`
+
+	_, err := r.db.Exec(query, identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt)
+	return err
+}
+
+func (r *PostgresIdentityRepository) ListIdentities(userID string) ([]models.UserIdentity, error) {
+	query := `SELECT provider, subject, user_id, email, created_at FROM user_identities
+		WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.UserIdentity
+	for rows.Next() {
+		var identity models.UserIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email,
+			&identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// LoginAttemptStore tracks failed logins per key (account or client IP)
+type LoginAttemptStore interface {
+	GetAttempts(key string) (*models.LoginAttempts, error)
+	// RecordFailure increments the failure count, starting over if the last failure is older than window
+	RecordFailure(key string, now time.Time, window time.Duration) (*models.LoginAttempts, error)
+	LockUntil(key string, until time.Time) error
+	Reset(key string) error
+}
+
+// ============================================
+// PostgreSQL implementation (production)
+// ============================================
+
+type PostgresLoginAttemptStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB) LoginAttemptStore {
+	return &PostgresLoginAttemptStore{db: db}
+}
+
+func (r *PostgresLoginAttemptStore) GetAttempts(key string) (*models.LoginAttempts, error) {
+	a := &models.LoginAttempts{}
+
+	query := `SELECT key, failures, first_failure_at, last_failure_at, locked_until FROM login_attempts WHERE key = $1`
+
+	err := r.db.QueryRow(query, key).Scan(&a.Key, &a.Failures, &a.FirstFailureAt, &a.LastFailureAt, &a.LockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return a, err
+}
+
+func (r *PostgresLoginAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) (*models.LoginAttempts, error) {
+	a := &models.LoginAttempts{}
+
+	// Upsert in one statement so concurrent failures are all counted
+	query := `INSERT INTO login_attempts (key, failures, first_failure_at, last_failure_at)
+		VALUES ($1, 1, $2, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			first_failure_at = CASE WHEN login_attempts.last_failure_at < $3 THEN $2 ELSE login_attempts.first_failure_at END,
+			last_failure_at = $2
+		RETURNING key, failures, first_failure_at, last_failure_at, locked_until`
+
+	err := r.db.QueryRow(query, key, now, now.Add(-window)).Scan(
+		&a.Key, &a.Failures, &a.FirstFailureAt, &a.LastFailureAt, &a.LockedUntil,
+	)
+
+	return a, err
+}
+
+func (r *PostgresLoginAttemptStore) LockUntil(key string, until time.Time) error {
+	_, err := r.db.Exec(`UPDATE login_attempts SET locked_until = $1 WHERE key = $2`, until, key)
+	return err
+}
+
+func (r *PostgresLoginAttemptStore) Reset(key string) error {
+	_, err := r.db.Exec(`DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
+
+// ============================================
+// In-memory implementation (tests, local development)
+// ============================================
+
+type InMemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+}
+
+func NewInMemoryLoginAttemptStore() *InMemoryLoginAttemptStore {
+	return &InMemoryLoginAttemptStore{attempts: make(map[string]models.LoginAttempts)}
+}
+
+func (m *InMemoryLoginAttemptStore) GetAttempts(key string) (*models.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (m *InMemoryLoginAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) (*models.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok || a.LastFailureAt.Before(now.Add(-window)) {
+		a = models.LoginAttempts{Key: key, FirstFailureAt: now, LockedUntil: a.LockedUntil}
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	m.attempts[key] = a
+
+	return &a, nil
+}
+
+func (m *InMemoryLoginAttemptStore) LockUntil(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok {
+		a.LockedUntil = &until
+		m.attempts[key] = a
+	}
+	return nil
+}
+
+func (m *InMemoryLoginAttemptStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrMFAChallengeUsed is returned when an MFA challenge was consumed concurrently
+var ErrMFAChallengeUsed = errors.New("mfa challenge already used")
+
+type MFARepository interface {
+	// SaveMFASecret starts (or restarts) an enrollment with a new, unconfirmed secret
+	SaveMFASecret(userID, secret string) error
+	GetMFASecret(userID string) (*models.MFASecret, error)
+	// ConfirmMFA enables MFA and replaces the recovery codes in one transaction
+	ConfirmMFA(userID string, step int64, recoveryCodeHashes []string) error
+	// UseTOTPStep records a TOTP time step as used; false means it (or a later one) was used already
+	UseTOTPStep(userID string, step int64) (bool, error)
+	DeleteMFA(userID string) error
+
+	ReplaceRecoveryCodes(userID string, codeHashes []string) error
+	// UseRecoveryCode consumes an unused recovery code; false means there was none
+	UseRecoveryCode(userID, codeHash string) (bool, error)
+
+	CreateMFAChallenge(challenge *models.MFAChallenge) error
+	GetMFAChallengeByHash(tokenHash string) (*models.MFAChallenge, error)
+	// ConsumeMFAChallenge claims an unused challenge; ErrMFAChallengeUsed means someone else has it
+	ConsumeMFAChallenge(id string) error
+	// ReleaseMFAChallenge hands a claimed challenge back after a wrong code and counts the attempt
+	ReleaseMFAChallenge(id string) error
+}
+
+type PostgresMFARepository struct {
+	db *sql.DB
+}
+
+func NewPostgresMFARepository(db *sql.DB) MFARepository {
+	return &PostgresMFARepository{db: db}
+}
+
+func (r *PostgresMFARepository) SaveMFASecret(userID, secret string) error {
+	query := `INSERT INTO user_mfa (user_id, secret, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, confirmed_at = NULL, last_used_step = 0, created_at = EXCLUDED.created_at`
+
+	_, err := r.db.Exec(query, userID, secret, time.Now())
+	return err
+}
+
+func (r *PostgresMFARepository) GetMFASecret(userID string) (*models.MFASecret, error) {
+	m := &models.MFASecret{}
+
+	query := `SELECT user_id, secret, confirmed_at, last_used_step, created_at FROM user_mfa WHERE user_id = $1`
+
+	err := r.db.QueryRow(query, userID).Scan(&m.UserID, &m.Secret, &m.ConfirmedAt, &m.LastUsedStep, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return m, err
+}
+
+func (r *PostgresMFARepository) ConfirmMFA(userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE user_mfa SET confirmed_at = $1, last_used_step = $2 WHERE user_id = $3 AND confirmed_at IS NULL`
+
+	res, err := tx.Exec(query, time.Now(), step, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("no pending mfa enrollment")
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresMFARepository) UseTOTPStep(userID string, step int64) (bool, error) {
+	res, err := r.db.Exec(`UPDATE user_mfa SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *PostgresMFARepository) DeleteMFA(userID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresMFARepository) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresMFARepository) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	query := `UPDATE mfa_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+
+	res, err := r.db.Exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *PostgresMFARepository) CreateMFAChallenge(challenge *models.MFAChallenge) error {
+	challenge.ID = uuid.New().String()
+	challenge.CreatedAt = time.Now()
+
+	query := `INSERT INTO mfa_challenges (id, user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := r.db.Exec(query, challenge.ID, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt, challenge.CreatedAt)
+	return err
+}
+
+func (r *PostgresMFARepository) GetMFAChallengeByHash(tokenHash string) (*models.MFAChallenge, error) {
+	c := &models.MFAChallenge{}
+
+	query := `SELECT id, user_id, token_hash, expires_at, attempts, used_at, created_at FROM mfa_challenges WHERE token_hash = $1`
+
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.TokenHash,
+		&c.ExpiresAt,
+		&c.Attempts,
+		&c.UsedAt,
+		&c.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return c, err
+}
+
+func (r *PostgresMFARepository) ConsumeMFAChallenge(id string) error {
+	res, err := r.db.Exec(`UPDATE mfa_challenges SET used_at = $1 WHERE id = $2 AND used_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrMFAChallengeUsed
+	}
+
+	return nil
+}
+
+func (r *PostgresMFARepository) ReleaseMFAChallenge(id string) error {
+	_, err := r.db.Exec(`UPDATE mfa_challenges SET used_at = NULL, attempts = attempts + 1 WHERE id = $1`, id)
+	return err
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, hash := range codeHashes {
+		query := `INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`
+		if _, err := tx.Exec(query, uuid.New().String(), userID, hash, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
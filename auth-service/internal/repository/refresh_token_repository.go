@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRefreshTokenRotated is returned when a token was already rotated or revoked
+// by the time RotateRefreshToken tried to consume it (e.g. two concurrent refreshes)
+var ErrRefreshTokenRotated = errors.New("refresh token already rotated")
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(token *models.RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(oldID string, next *models.RefreshToken) error
+	RevokeTokenFamily(familyID string) error
+	RevokeUserTokens(userID string) error
+}
+
+type PostgresRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRefreshTokenRepository(db *sql.DB) RefreshTokenRepository {
+	return &PostgresRefreshTokenRepository{db: db}
+}
+
+func (r *PostgresRefreshTokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return insertRefreshToken(r.db, token)
+}
+
+func (r *PostgresRefreshTokenRepository) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+
+	query := `SELECT id, user_id, family_id, token_hash, expires_at, created_at, revoked_at, replaced_by
+		FROM refresh_tokens WHERE token_hash = $1`
+
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&token.RevokedAt,
+		&token.ReplacedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return token, err
+}
+
+// RotateRefreshToken marks the old token as replaced and stores the next one in a single transaction.
+// The old token is only consumed if it is still active, so two concurrent refreshes cannot both succeed.
+func (r *PostgresRefreshTokenRepository) RotateRefreshToken(oldID string, next *models.RefreshToken) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if next.ID == "" {
+		next.ID = uuid.New().String()
+	}
+
+	query := `UPDATE refresh_tokens SET revoked_at = $1, replaced_by = $2 WHERE id = $3 AND revoked_at IS NULL`
+
+	res, err := tx.Exec(query, time.Now(), next.ID, oldID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRefreshTokenRotated
+	}
+
+	if err := insertRefreshToken(tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeTokenFamily revokes every still-active token that descends from the same login
+func (r *PostgresRefreshTokenRepository) RevokeTokenFamily(familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+
+	_, err := r.db.Exec(query, time.Now(), familyID)
+	return err
+}
+
+// RevokeUserTokens revokes every still-active refresh token of a user, across all families
+func (r *PostgresRefreshTokenRepository) RevokeUserTokens(userID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+
+	_, err := r.db.Exec(query, time.Now(), userID)
+	return err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertRefreshToken(db execer, token *models.RefreshToken) error {
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	token.CreatedAt = time.Now()
+
+	query := `INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := db.Exec(query, token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
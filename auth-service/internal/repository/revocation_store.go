@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// RevocationStore records access tokens that must be rejected before they expire.
+// Tokens are revoked individually by jti (logout) or all at once per user (revoke all sessions).
+type RevocationStore interface {
+	RevokeToken(jti string, expiresAt time.Time) error
+	RevokeAllForUser(userID string, before time.Time) error
+	IsRevoked(jti, userID string, issuedAt time.Time) (bool, error)
+
+	// ListRevocationsSince feeds services that verify tokens locally.
+	// Only revocations of tokens that have not expired yet are returned.
+	ListRevocationsSince(since time.Time) ([]models.RevokedToken, []models.UserRevocation, error)
+}
+
+// cutoffPrecision is the precision cutoffs are kept in: that of a Postgres TIMESTAMP, and of the iat
+// of issued tokens. Postgres rounds rather than truncates, so cutoffs are truncated before storing.
+const cutoffPrecision = time.Microsecond
+
+// isCutoffHit reports whether a token issued at issuedAt falls under a per-user cutoff:
+// tokens issued before the cutoff are revoked, tokens issued at or after it are not
+func isCutoffHit(issuedAt, cutoff time.Time) bool {
+	return !cutoff.IsZero() && issuedAt.Before(cutoff)
+}
+
+// ============================================
+// PostgreSQL implementation (production)
+// ============================================
+
+type PostgresRevocationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRevocationStore(db *sql.DB) RevocationStore {
+	return &PostgresRevocationStore{db: db}
+}
+
+func (r *PostgresRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	query := `INSERT INTO revoked_tokens (jti, expires_at, revoked_at) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING`
+
+	_, err := r.db.Exec(query, jti, expiresAt, time.Now())
+	return err
+}
+
+func (r *PostgresRevocationStore) RevokeAllForUser(userID string, before time.Time) error {
+	query := `INSERT INTO user_token_revocations (user_id, revoked_before) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = GREATEST(user_token_revocations.revoked_before, EXCLUDED.revoked_before)`
+
+	_, err := r.db.Exec(query, userID, before.Truncate(cutoffPrecision))
+	return err
+}
+
+func (r *PostgresRevocationStore) IsRevoked(jti, userID string, issuedAt time.Time) (bool, error) {
+	var revokedJTI bool
+	var cutoff sql.NullTime
+
+	query := `SELECT
+		EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1),
+		(SELECT revoked_before FROM user_token_revocations WHERE user_id = $2)`
+
+	if err := r.db.QueryRow(query, jti, userID).Scan(&revokedJTI, &cutoff); err != nil {
+		return false, err
+	}
+
+	if revokedJTI {
+		return true, nil
+	}
+
+	return cutoff.Valid && isCutoffHit(issuedAt, cutoff.Time), nil
+}
+
+func (r *PostgresRevocationStore) ListRevocationsSince(since time.Time) ([]models.RevokedToken, []models.UserRevocation, error) {
+	tokenRows, err := r.db.Query(`SELECT jti, expires_at FROM revoked_tokens WHERE revoked_at > $1 AND expires_at > $2`, since, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tokenRows.Close()
+
+	tokens := []models.RevokedToken{}
+	for tokenRows.Next() {
+		var t models.RevokedToken
+		if err := tokenRows.Scan(&t.JTI, &t.ExpiresAt); err != nil {
+			return nil, nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err := tokenRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// revoked_before is the moment of revocation, so it doubles as the change timestamp
+	userRows, err := r.db.Query(`SELECT user_id, revoked_before FROM user_token_revocations WHERE revoked_before > $1`, since)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer userRows.Close()
+
+	users := []models.UserRevocation{}
+	for userRows.Next() {
+		var u models.UserRevocation
+		if err := userRows.Scan(&u.UserID, &u.RevokedBefore); err != nil {
+			return nil, nil, err
+		}
+		users = append(users, u)
+	}
+
+	return tokens, users, userRows.Err()
+}
+
+// ============================================
+// In-memory implementation (tests, local development)
+// ============================================
+
+type InMemoryRevocationStore struct {
+	mu      sync.RWMutex
+	tokens  map[string]revokedEntry // jti -> revocation
+	cutoffs map[string]time.Time    // user_id -> revoked_before
+}
+
+type revokedEntry struct {
+	expiresAt time.Time
+	revokedAt time.Time
+}
+
+func NewInMemoryRevocationStore() *InMemoryRevocationStore {
+	return &InMemoryRevocationStore{
+		tokens:  make(map[string]revokedEntry),
+		cutoffs: make(map[string]time.Time),
+	}
+}
+
+func (m *InMemoryRevocationStore) RevokeToken(jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Opportunistically drop entries for tokens that have expired anyway
+	now := time.Now()
+	for id, entry := range m.tokens {
+		if now.After(entry.expiresAt) {
+			delete(m.tokens, id)
+		}
+	}
+
+	if _, ok := m.tokens[jti]; !ok {
+		m.tokens[jti] = revokedEntry{expiresAt: expiresAt, revokedAt: now}
+	}
+	return nil
+}
+
+func (m *InMemoryRevocationStore) RevokeAllForUser(userID string, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before = before.Truncate(cutoffPrecision)
+	if before.After(m.cutoffs[userID]) {
+		m.cutoffs[userID] = before
+	}
+	return nil
+}
+
+func (m *InMemoryRevocationStore) IsRevoked(jti, userID string, issuedAt time.Time) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.tokens[jti]; ok {
+		return true, nil
+	}
+
+	return isCutoffHit(issuedAt, m.cutoffs[userID]), nil
+}
+
+func (m *InMemoryRevocationStore) ListRevocationsSince(since time.Time) ([]models.RevokedToken, []models.UserRevocation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	tokens := []models.RevokedToken{}
+	for jti, entry := range m.tokens {
+		if entry.revokedAt.After(since) && entry.expiresAt.After(now) {
+			tokens = append(tokens, models.RevokedToken{JTI: jti, ExpiresAt: entry.expiresAt})
+		}
+	}
+
+	users := []models.UserRevocation{}
+	for userID, cutoff := range m.cutoffs {
+		if cutoff.After(since) {
+			users = append(users, models.UserRevocation{UserID: userID, RevokedBefore: cutoff})
+		}
+	}
+
+	return tokens, users, nil
+}
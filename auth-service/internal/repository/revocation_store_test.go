@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsCutoffHit(t *testing.T) {
+	cutoff := time.Date(2026, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		cutoff   time.Time
+		want     bool
+	}{
+		{"no cutoff", cutoff, time.Time{}, false},
+		{"issued a second earlier", cutoff.Add(-time.Second), cutoff, true},
+		{"issued earlier in the same second", cutoff.Add(-time.Millisecond), cutoff, true},
+		{"issued at the cutoff", cutoff, cutoff, false},
+		{"issued later in the same second", cutoff.Add(time.Millisecond), cutoff, false},
+		{"issued a second later", cutoff.Add(time.Second), cutoff, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCutoffHit(tt.issuedAt, tt.cutoff); got != tt.want {
+				t.Errorf("isCutoffHit(%s, %s) = %v, want %v", tt.issuedAt, tt.cutoff, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInMemoryRevocationStoreIsRevoked(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		revoke   func(s *InMemoryRevocationStore)
+		jti      string
+		userID   string
+		issuedAt time.Time
+		want     bool
+	}{
+		{
+			name:     "nothing revoked",
+			revoke:   func(s *InMemoryRevocationStore) {},
+			jti:      "jti-1",
+			userID:   "user-1",
+			issuedAt: now,
+			want:     false,
+		},
+		{
+			name:     "token revoked by jti",
+			revoke:   func(s *InMemoryRevocationStore) { s.RevokeToken("jti-1", now.Add(time.Hour)) },
+			jti:      "jti-1",
+			userID:   "user-1",
+			issuedAt: now,
+			want:     true,
+		},
+		{
+			name:     "other token of the user",
+			revoke:   func(s *InMemoryRevocationStore) { s.RevokeToken("jti-1", now.Add(time.Hour)) },
+			jti:      "jti-2",
+			userID:   "user-1",
+			issuedAt: now,
+			want:     false,
+		},
+		{
+			// Sessions are revoked by their ID, which is checked in place of the jti
+			name:     "session revoked",
+			revoke:   func(s *InMemoryRevocationStore) { s.RevokeToken("session-1", now.Add(time.Hour)) },
+			jti:      "session-1",
+			userID:   "user-1",
+			issuedAt: now,
+			want:     true,
+		},
+		{
+			name:     "issued before the user's cutoff",
+			revoke:   func(s *InMemoryRevocationStore) { s.RevokeAllForUser("user-1", now) },
+			jti:      "jti-1",
+			userID:   "user-1",
+			issuedAt: now.Add(-time.Millisecond),
+			want:     true,
+		},
+		{
+			name:     "issued just after the user's cutoff",
+			revoke:   func(s *InMemoryRevocationStore) { s.RevokeAllForUser("user-1", now) },
+			jti:      "jti-1",
+			userID:   "user-1",
+			issuedAt: now.Add(time.Millisecond),
+			want:     false,
+		},
+		{
+			name:     "cutoff of another user",
+			revoke:   func(s *InMemoryRevocationStore) { s.RevokeAllForUser("user-2", now) },
+			jti:      "jti-1",
+			userID:   "user-1",
+			issuedAt: now.Add(-time.Hour),
+			want:     false,
+		},
+		{
+			name: "an older cutoff does not replace a newer one",
+			revoke: func(s *InMemoryRevocationStore) {
+				s.RevokeAllForUser("user-1", now)
+				s.RevokeAllForUser("user-1", now.Add(-time.Hour))
+			},
+			jti:      "jti-1",
+			userID:   "user-1",
+			issuedAt: now.Add(-time.Minute),
+			want:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewInMemoryRevocationStore()
+			tt.revoke(s)
+
+			got, err := s.IsRevoked(tt.jti, tt.userID, tt.issuedAt)
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRevoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInMemoryRevocationStoreListRevocationsSince(t *testing.T) {
+	s := NewInMemoryRevocationStore()
+	since := time.Now()
+
+	s.RevokeToken("live", time.Now().Add(time.Hour))
+	s.RevokeToken("expired", time.Now().Add(-time.Second))
+	s.RevokeAllForUser("user-1", time.Now())
+	s.RevokeAllForUser("user-2", since.Add(-time.Hour))
+
+	tokens, users, err := s.ListRevocationsSince(since)
+	if err != nil {
+		t.Fatalf("ListRevocationsSince: %v", err)
+	}
+
+	if len(tokens) != 1 || tokens[0].JTI != "live" {
+		t.Errorf("tokens = %+v, want only the unexpired one", tokens)
+	}
+	if len(users) != 1 || users[0].UserID != "user-1" {
+		t.Errorf("users = %+v, want only the cutoff set after since", users)
+	}
+}
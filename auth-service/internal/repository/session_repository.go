@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"time"
+)
+
+type SessionRepository interface {
+	CreateSession(session *models.Session) error
+	GetSession(id string) (*models.Session, error)
+	// ListActiveSessions returns the user's sessions that are neither revoked nor expired, most recent first
+	ListActiveSessions(userID string) ([]models.Session, error)
+	// TouchSession records a refresh: where it came from and until when the session now lasts
+	TouchSession(id, ipAddress, userAgent string, seenAt, expiresAt time.Time) error
+	RevokeSession(id string) error
+	RevokeUserSessions(userID string) error
+}
+
+type PostgresSessionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionRepository(db *sql.DB) SessionRepository {
+	return &PostgresSessionRepository{db: db}
+}
+
+// sessionColumns is the column list matching scanSession
+const sessionColumns = `id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at`
+
+func (r *PostgresSessionRepository) CreateSession(session *models.Session) error {
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := r.db.Exec(query, session.ID, session.UserID, session.UserAgent, session.IPAddress,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+	return err
+}
+
+func (r *PostgresSessionRepository) GetSession(id string) (*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+
+	session, err := scanSession(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return session, err
+}
+
+func (r *PostgresSessionRepository) ListActiveSessions(userID string) ([]models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC`
+
+	rows, err := r.db.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (r *PostgresSessionRepository) TouchSession(id, ipAddress, userAgent string, seenAt, expiresAt time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = $1, expires_at = $2,
+			ip_address = COALESCE(NULLIF($3, ''), ip_address),
+			user_agent = COALESCE(NULLIF($4, ''), user_agent)
+		WHERE id = $5`
+
+	_, err := r.db.Exec(query, seenAt, expiresAt, ipAddress, userAgent, id)
+	return err
+}
+
+func (r *PostgresSessionRepository) RevokeSession(id string) error {
+	_, err := r.db.Exec(`UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, time.Now(), id)
+	return err
+}
+
+func (r *PostgresSessionRepository) RevokeUserSessions(userID string) error {
+	_, err := r.db.Exec(`UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, time.Now(), userID)
+	return err
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	s := &models.Session{}
+
+	err := row.Scan(
+		&s.ID,
+		&s.UserID,
+		&s.UserAgent,
+		&s.IPAddress,
+		&s.CreatedAt,
+		&s.LastSeenAt,
+		&s.ExpiresAt,
+		&s.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"database/sql"
+	"time"
+)
+
+type SigningKeyRepository interface {
+	CreateSigningKey(key *models.SigningKey) error
+	GetValidSigningKeys(now time.Time) ([]*models.SigningKey, error)
+}
+
+type PostgresSigningKeyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSigningKeyRepository(db *sql.DB) SigningKeyRepository {
+	return &PostgresSigningKeyRepository{db: db}
+}
+
+func (r *PostgresSigningKeyRepository) CreateSigningKey(key *models.SigningKey) error {
+	query := `INSERT INTO signing_keys (kid, algorithm, private_key, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := r.db.Exec(query, key.KID, key.Algorithm, key.PrivateKey, key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+// GetValidSigningKeys returns all keys that have not expired yet, newest first
+func (r *PostgresSigningKeyRepository) GetValidSigningKeys(now time.Time) ([]*models.SigningKey, error) {
+	query := `SELECT kid, algorithm, private_key, created_at, expires_at FROM signing_keys
+		WHERE expires_at > $1 ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.SigningKey{}
+	for rows.Next() {
+		key := &models.SigningKey{}
+		if err := rows.Scan(&key.KID, &key.Algorithm, &key.PrivateKey, &key.CreatedAt, &key.ExpiresAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
@@ -3,15 +3,59 @@ package repository
 import (
 	"auth-service/internal/models"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrResetTokenUsed is returned when a password reset token was consumed concurrently
+	ErrResetTokenUsed = errors.New("password reset token already used")
+	// ErrVerificationTokenUsed is returned when an email verification token was consumed concurrently
+	ErrVerificationTokenUsed = errors.New("email verification token already used")
+	// ErrEmailChangeTokenUsed is returned when an email change token was consumed concurrently
+	ErrEmailChangeTokenUsed = errors.New("email change token already used")
+	// ErrEmailTaken is returned when another user already has the email address
+	ErrEmailTaken = errors.New("email address already in use")
 )
 
 type UserRepository interface {
 	CreateUser(user *models.User) error
 	GetUserByEmail(email string) (*models.User, error)
 	GetUserByID(id string) (*models.User, error)
+	UpdateLastLogin(userID string, at time.Time) error
+	SetProfileStatus(userID, status string) error
+	// DeleteUser removes a user and everything that belongs to them
+	DeleteUser(userID string) error
+	// ListUsers pages through all users by ID in byte order
+	ListUsers(afterID string, limit int) ([]models.User, error)
+	MarkUserDeleted(userID string, at time.Time) error
+	RestoreUser(userID string) error
+	// ListDeletedUsers returns up to limit users deleted before the given time, oldest first
+	ListDeletedUsers(before time.Time, limit int) ([]models.User, error)
+	UpdatePassword(userID, passwordHash string) error
+	// TakeOverUnverifiedAccount removes the password, burns every outstanding reset, verification and
+	// email change token and marks the email verified, in one transaction
+	TakeOverUnverifiedAccount(userID string, verifiedAt time.Time) error
+
+	AssignRole(userID, role string) error
+	GetUserRoles(userID string) ([]string, error)
+	GetRolePermissions(roles []string) ([]string, error)
+
+	CreatePasswordResetToken(token *models.PasswordResetToken) error
+	GetPasswordResetTokenByHash(tokenHash string) (*models.PasswordResetToken, error)
+	ResetPassword(tokenID, userID, passwordHash string) error
+
+	CreateEmailVerificationToken(token *models.EmailVerificationToken) error
+	GetEmailVerificationTokenByHash(tokenHash string) (*models.EmailVerificationToken, error)
+	MarkEmailVerified(tokenID, userID string) error
+
+	CreateEmailChangeToken(token *models.EmailChangeToken) error
+	GetEmailChangeTokenByHash(tokenHash string) (*models.EmailChangeToken, error)
+	// ChangeEmail consumes an email change token and sets the new, verified address in one transaction
+	ChangeEmail(tokenID, userID, newEmail string) error
 }
 
 type PostgresUserRepository struct {
@@ -26,25 +70,58 @@ func (r *PostgresUserRepository) CreateUser(user *models.User) error {
 	user.ID = uuid.New().String()
 	user.CreatedAt = time.Now()
 
-	query := `INSERT INTO users (id, email, password, name, created_at, last_login) VALUES ($1, $2, $3, $4, $5, $6)`
+	if user.ProfileStatus == "" {
+		user.ProfileStatus = models.ProfileStatusActive
+	}
+
+	query := `INSERT INTO users (id, email, password, name, created_at, last_login, email_verified, email_verified_at, profile_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 
-	_, err := r.db.Exec(query, user.ID, user.Email, user.Password, user.Name, user.CreatedAt, user.LastLogin)
+	_, err := r.db.Exec(query, user.ID, user.Email, user.Password, user.Name, user.CreatedAt, user.LastLogin,
+		user.EmailVerified, user.EmailVerifiedAt, user.ProfileStatus)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
 
 	return err
 }
 
+// userColumns is the column list matching scanUser
+const userColumns = `id, email, password, name, created_at, last_login, email_verified, email_verified_at, profile_status, deleted_at`
+
+// GetUserByEmail ignores case, as identity providers and users do not agree on it.
+// Emails are unique regardless of case (migration 018).
 func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, error) {
-	user := &models.User{}
+	query := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1)`
 
-	query := `SELECT id, email, password, name, created_at, last_login FROM users WHERE email  = $1`
+	return scanUser(r.db.QueryRow(query, email))
+}
+
+func (r *PostgresUserRepository) GetUserByID(id string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+
+	return scanUser(r.db.QueryRow(query, id))
+}
+
+func (r *PostgresUserRepository) UpdateLastLogin(userID string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE users SET last_login = $1 WHERE id = $2`, at, userID)
+	return err
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
 
-	err := r.db.QueryRow(query, email).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
 		&user.Name,
 		&user.CreatedAt,
 		&user.LastLogin,
+		&user.EmailVerified,
+		&user.EmailVerifiedAt,
+		&user.ProfileStatus,
+		&user.DeletedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -54,23 +131,344 @@ func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, err
 	return user, err
 }
 
-func (r *PostgresUserRepository) GetUserByID(id string) (*models.User, error) {
-	user := &models.User{}
+func (r *PostgresUserRepository) SetProfileStatus(userID, status string) error {
+	_, err := r.db.Exec(`UPDATE users SET profile_status = $1 WHERE id = $2`, status, userID)
+	return err
+}
 
-	query := `SELECT id, email, password, name, created_at, last_login FROM users WHERE id = $1`
+// DeleteUser relies on ON DELETE CASCADE for roles, tokens, sessions and the rest
+func (r *PostgresUserRepository) DeleteUser(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM users WHERE id = $1`, userID)
+	return err
+}
 
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Password,
-		&user.Name,
-		&user.CreatedAt,
-		&user.LastLogin,
+func (r *PostgresUserRepository) ListUsers(afterID string, limit int) ([]models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users
+		WHERE id > $1 COLLATE "C"
+		ORDER BY id COLLATE "C"
+		LIMIT $2`
+
+	return r.queryUsers(query, afterID, limit)
+}
+
+// MarkUserDeleted keeps the first deletion time if the user was already deleted
+func (r *PostgresUserRepository) MarkUserDeleted(userID string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE users SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`, at, userID)
+	return err
+}
+
+func (r *PostgresUserRepository) RestoreUser(userID string) error {
+	_, err := r.db.Exec(`UPDATE users SET deleted_at = NULL WHERE id = $1`, userID)
+	return err
+}
+
+func (r *PostgresUserRepository) ListDeletedUsers(before time.Time, limit int) ([]models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		ORDER BY deleted_at
+		LIMIT $2`
+
+	return r.queryUsers(query, before, limit)
+}
+
+func (r *PostgresUserRepository) queryUsers(query string, args ...any) ([]models.User, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *PostgresUserRepository) AssignRole(userID, role string) error {
+	query := `INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	_, err := r.db.Exec(query, userID, role)
+	return err
+}
+
+func (r *PostgresUserRepository) GetUserRoles(userID string) ([]string, error) {
+	query := `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`
+
+	return r.queryStrings(query, userID)
+}
+
+// GetRolePermissions returns the distinct permissions granted by any of the given roles
+func (r *PostgresUserRepository) GetRolePermissions(roles []string) ([]string, error) {
+	if len(roles) == 0 {
+		return []string{}, nil
+	}
+
+	query := `SELECT DISTINCT permission FROM role_permissions WHERE role = ANY($1) ORDER BY permission`
+
+	return r.queryStrings(query, pq.Array(roles))
+}
+
+// queryStrings runs a query returning a single text column
+func (r *PostgresUserRepository) queryStrings(query string, args ...any) ([]string, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+func (r *PostgresUserRepository) CreatePasswordResetToken(token *models.PasswordResetToken) error {
+	token.ID = uuid.New().String()
+	token.CreatedAt = time.Now()
+
+	query := `INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := r.db.Exec(query, token.ID, token.UserID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (r *PostgresUserRepository) GetPasswordResetTokenByHash(tokenHash string) (*models.PasswordResetToken, error) {
+	token := &models.PasswordResetToken{}
+
+	query := `SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM password_reset_tokens WHERE token_hash = $1`
+
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
 	)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 
-	return user, err
+	return token, err
+}
+
+// ResetPassword consumes a reset token and sets the new password hash in one transaction.
+// Every other outstanding reset token of the user is burned at the same time.
+func (r *PostgresUserRepository) ResetPassword(tokenID, userID, passwordHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	res, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL`, now, tokenID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrResetTokenUsed
+	}
+
+	if _, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`, now, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresUserRepository) CreateEmailVerificationToken(token *models.EmailVerificationToken) error {
+	token.ID = uuid.New().String()
+	token.CreatedAt = time.Now()
+
+	query := `INSERT INTO email_verification_tokens (id, user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := r.db.Exec(query, token.ID, token.UserID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (r *PostgresUserRepository) GetEmailVerificationTokenByHash(tokenHash string) (*models.EmailVerificationToken, error) {
+	token := &models.EmailVerificationToken{}
+
+	query := `SELECT id, user_id, token_hash, expires_at, used_at, created_at FROM email_verification_tokens WHERE token_hash = $1`
+
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return token, err
+}
+
+// MarkEmailVerified consumes a verification token and flags the user as verified in one transaction
+func (r *PostgresUserRepository) MarkEmailVerified(tokenID, userID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	res, err := tx.Exec(`UPDATE email_verification_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL`, now, tokenID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVerificationTokenUsed
+	}
+
+	if _, err := tx.Exec(`UPDATE email_verification_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`, now, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET email_verified = TRUE, email_verified_at = $1 WHERE id = $2`, now, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresUserRepository) UpdatePassword(userID, passwordHash string) error {
+	_, err := r.db.Exec(`UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userID)
+	return err
+}
+
+func (r *PostgresUserRepository) TakeOverUnverifiedAccount(userID string, verifiedAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"password_reset_tokens", "email_verification_tokens", "email_change_tokens"} {
+		query := `UPDATE ` + table + ` SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`
+		if _, err := tx.Exec(query, verifiedAt, userID); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE users SET password = '', email_verified = TRUE, email_verified_at = $1 WHERE id = $2`
+	if _, err := tx.Exec(query, verifiedAt, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresUserRepository) CreateEmailChangeToken(token *models.EmailChangeToken) error {
+	token.ID = uuid.New().String()
+	token.CreatedAt = time.Now()
+
+	query := `INSERT INTO email_change_tokens (id, user_id, new_email, token_hash, session_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := r.db.Exec(query, token.ID, token.UserID, token.NewEmail, token.TokenHash, token.SessionID,
+		token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (r *PostgresUserRepository) GetEmailChangeTokenByHash(tokenHash string) (*models.EmailChangeToken, error) {
+	token := &models.EmailChangeToken{}
+
+	query := `SELECT id, user_id, new_email, token_hash, session_id, expires_at, used_at, created_at
+		FROM email_change_tokens WHERE token_hash = $1`
+
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.NewEmail,
+		&token.TokenHash,
+		&token.SessionID,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return token, err
+}
+
+// ChangeEmail burns every outstanding email change token of the user along with the one used
+func (r *PostgresUserRepository) ChangeEmail(tokenID, userID, newEmail string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	res, err := tx.Exec(`UPDATE email_change_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL`, now, tokenID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrEmailChangeTokenUsed
+	}
+
+	if _, err := tx.Exec(`UPDATE email_change_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`, now, userID); err != nil {
+		return err
+	}
+
+	// Opening the link proved the new address, so it is verified straight away
+	_, err = tx.Exec(`UPDATE users SET email = $1, email_verified = TRUE, email_verified_at = $2 WHERE id = $3`, newEmail, now, userID)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether a statement failed on a unique constraint or index
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"auth-service/internal/mail"
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrIncorrectPassword       = errors.New("current password is incorrect")
+	ErrEmailInUse              = errors.New("email address already in use")
+	ErrSameEmail               = errors.New("new email is the same as the current one")
+	ErrInvalidEmail            = errors.New("invalid email address")
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email change token")
+	ErrNoPassword              = errors.New("account has no password; set one with a password reset first")
+)
+
+// ChangePassword sets a new password after re-checking the current one.
+// Every other session of the user is signed out; the one making the change stays logged in.
+func (s *AuthService) ChangePassword(userID, sessionID, currentPassword, newPassword string, client ClientInfo) error {
+	user, err := s.reauthenticate(userID, currentPassword, client)
+	if err != nil {
+		return err
+	}
+
+	invalid := &ValidationError{}
+	invalid.addPasswordViolations(s.cfg.PasswordPolicy, "new_password", newPassword, user.Email, user.Name)
+	if newPassword == currentPassword {
+		invalid.add("new_password", "unchanged", "new password must differ from the current one")
+	}
+	if err := invalid.err(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.cfg.PasswordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdatePassword(user.ID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := s.revokeOtherSessions(user.ID, sessionID); err != nil {
+		return err
+	}
+
+	s.sendSecurityNotice(user, "Your password was changed",
+		"The password of your account was just changed. If this was not you, reset your password right away.")
+	return nil
+}
+
+// RequestEmailChange re-checks the password and emails a confirmation link to the new address.
+// The email only changes once that link is opened (see ConfirmEmailChange).
+func (s *AuthService) RequestEmailChange(userID, sessionID, currentPassword, newEmail string, client ClientInfo) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if newEmail == "" || !strings.Contains(newEmail, "@") {
+		return ErrInvalidEmail
+	}
+
+	user, err := s.reauthenticate(userID, currentPassword, client)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrSameEmail
+	}
+
+	existing, err := s.repo.GetUserByEmail(newEmail)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrEmailInUse
+	}
+
+	rawToken, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.CreateEmailChangeToken(&models.EmailChangeToken{
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		TokenHash: hashToken(rawToken),
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(s.cfg.EmailChangeTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to use this address for your account. It expires in %s.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Name, s.cfg.EmailChangeTTL, fmt.Sprintf(s.cfg.EmailChangeURL, rawToken),
+		),
+	})
+}
+
+// ConfirmEmailChange switches the user to the new address proven by the token.
+// The user-service profile is updated before anything is committed here, so it is never behind;
+// if the change then fails locally the profile gets the old email back.
+// Every session other than the one that asked for the change is signed out.
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, rawToken string) (*models.User, error) {
+	if rawToken == "" {
+		return nil, ErrInvalidEmailChangeToken
+	}
+
+	token, err := s.repo.GetEmailChangeTokenByHash(hashToken(rawToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidEmailChangeToken
+	}
+
+	user, err := s.repo.GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidEmailChangeToken
+	}
+
+	// The address may have been taken since the change was requested
+	existing, err := s.repo.GetUserByEmail(token.NewEmail)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return nil, ErrEmailInUse
+	}
+
+	oldEmail := user.Email
+	if err := s.profiles.UpdateEmail(ctx, user.ID, token.NewEmail); err != nil {
+		return nil, err
+	}
+
+	err = s.repo.ChangeEmail(token.ID, user.ID, token.NewEmail)
+	if err != nil {
+		if undoErr := s.profiles.UpdateEmail(ctx, user.ID, oldEmail); undoErr != nil {
+			log.Printf("Failed to restore profile email after failed email change: user=%s err=%v", user.ID, undoErr)
+		}
+
+		switch {
+		case errors.Is(err, repository.ErrEmailChangeTokenUsed):
+			return nil, ErrInvalidEmailChangeToken
+		case errors.Is(err, repository.ErrEmailTaken):
+			return nil, ErrEmailInUse
+		default:
+			return nil, err
+		}
+	}
+
+	if err := s.revokeOtherSessions(user.ID, token.SessionID); err != nil {
+		return nil, err
+	}
+
+	// Tell the old address, in case someone else got hold of the account
+	s.sendSecurityNotice(user, "Your email address was changed",
+		fmt.Sprintf("The email address of your account was changed to %s. If this was not you, contact support right away.", token.NewEmail))
+
+	user.Email = token.NewEmail
+	user.EmailVerified = true
+	return user, nil
+}
+
+// reauthenticate checks the current password of a logged-in user.
+// Wrong passwords count as failed logins, so this cannot be used to guess the password either.
+func (s *AuthService) reauthenticate(userID, password string, client ClientInfo) (*models.User, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	now := time.Now()
+	if err := s.checkThrottle(user.Email, client.IP, now); err != nil {
+		return nil, err
+	}
+
+	// Accounts created through an identity provider have no password to check
+	if user.Password == "" {
+		return nil, ErrNoPassword
+	}
+
+	if !s.checkPassword(user, password) {
+		if err := s.recordFailedLogin(user.Email, client.IP, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrIncorrectPassword
+	}
+
+	return user, nil
+}
+
+// revokeOtherSessions signs out every active session of the user except keepSessionID
+func (s *AuthService) revokeOtherSessions(userID, keepSessionID string) error {
+	sessions, err := s.sessions.ListActiveSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == keepSessionID {
+			continue
+		}
+		if err := s.revokeSession(session.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendSecurityNotice tells the user about a change to their account; failures are only logged
+func (s *AuthService) sendSecurityNotice(user *models.User, subject, text string) {
+	err := s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hi %s,\n\n%s\n", user.Name, text),
+	})
+	if err != nil {
+		log.Printf("Failed to send security notice: user=%s err=%v", user.ID, err)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrAccountNotDeleted   = errors.New("no deleted account with this ID can be restored")
+	ErrProfileUpdateFailed = errors.New("could not update the user profile, please try again")
+)
+
+// purgePageSize is how many expired accounts are purged per query
+const purgePageSize = 100
+
+// DeleteAccount deletes a user's account in both services. Login stops working and every session,
+// access and refresh token is revoked at once; the profile is hidden in user-service. Personal data
+// is only erased by PurgeDeletedAccounts once the grace period is over, until then UndeleteAccount
+// restores everything. Deleting an account again only repeats the revocation.
+func (s *AuthService) DeleteAccount(ctx context.Context, userID string) (time.Time, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user == nil {
+		return time.Time{}, ErrUserNotFound
+	}
+
+	deletedNow := user.DeletedAt == nil
+	if deletedNow {
+		// The profile goes first: if user-service is down nothing has changed and the user can retry
+		if err := s.profiles.SoftDeleteProfile(ctx, user.ID); err != nil {
+			return time.Time{}, fmt.Errorf("%w: %v", ErrProfileUpdateFailed, err)
+		}
+
+		now := time.Now()
+		if err := s.repo.MarkUserDeleted(user.ID, now); err != nil {
+			if undoErr := s.profiles.RestoreProfile(ctx, user.ID); undoErr != nil {
+				log.Printf("Failed to restore profile after failed account deletion: user=%s err=%v", user.ID, undoErr)
+			}
+			return time.Time{}, err
+		}
+		user.DeletedAt = &now
+	}
+
+	if err := s.RevokeAllSessions(user.ID); err != nil {
+		return time.Time{}, err
+	}
+
+	purgeAfter := user.DeletedAt.Add(s.cfg.AccountDeletionGracePeriod)
+	if deletedNow {
+		s.sendSecurityNotice(user, "Your account has been deleted",
+			fmt.Sprintf("Your account has been deleted and you can no longer log in. Your personal data will be erased on %s; until then, contact support if you want your account back.",
+				purgeAfter.UTC().Format("January 2, 2006")))
+	}
+
+	return purgeAfter, nil
+}
+
+// UndeleteAccount restores an account deleted less than the grace period ago. Sessions revoked by the
+// deletion stay revoked; the user simply logs in again.
+func (s *AuthService) UndeleteAccount(ctx context.Context, userID string) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.DeletedAt == nil || time.Now().After(user.DeletedAt.Add(s.cfg.AccountDeletionGracePeriod)) {
+		return ErrAccountNotDeleted
+	}
+
+	if err := s.profiles.RestoreProfile(ctx, user.ID); err != nil {
+		return fmt.Errorf("%w: %v", ErrProfileUpdateFailed, err)
+	}
+
+	if err := s.repo.RestoreUser(user.ID); err != nil {
+		if undoErr := s.profiles.SoftDeleteProfile(ctx, user.ID); undoErr != nil {
+			log.Printf("Failed to hide profile again after failed account restore: user=%s err=%v", user.ID, undoErr)
+		}
+		return err
+	}
+
+	s.sendSecurityNotice(user, "Your account has been restored",
+		"Your account has been restored and you can log in again. If you did not ask for this, reset your password right away.")
+
+	return nil
+}
+
+// PurgeDeletedAccounts erases every account deleted longer than the grace period ago, profile first.
+// A failure stops the pass; whatever is left is picked up by the next one.
+func (s *AuthService) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		users, err := s.repo.ListDeletedUsers(time.Now().Add(-s.cfg.AccountDeletionGracePeriod), purgePageSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, user := range users {
+			if err := s.profiles.DeleteProfile(ctx, user.ID); err != nil {
+				return purged, err
+			}
+			if err := s.repo.DeleteUser(user.ID); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(users) < purgePageSize {
+			return purged, nil
+		}
+	}
+}
+
+// RunAccountPurge calls PurgeDeletedAccounts every interval until ctx is cancelled
+func (s *AuthService) RunAccountPurge(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeDeletedAccounts(ctx)
+			if err != nil {
+				log.Printf("Failed to purge deleted accounts: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d deleted accounts", purged)
+			}
+		}
+	}
+}
@@ -1,40 +1,163 @@
 package service
 
 import (
+	"auth-service/internal/idp"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
 	"auth-service/internal/models"
+	"auth-service/internal/password"
+	"auth-service/internal/profiles"
 	"auth-service/internal/repository"
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// DefaultRole is granted to every newly registered user
+const DefaultRole = "customer"
+
+// Config holds the tunable settings of the AuthService
+type Config struct {
+	Issuer          string        // iss claim of every token; checked by ValidateToken
+	Audience        string        // aud claim of every token; checked by ValidateToken
+	AccessTokenTTL  time.Duration // Lifetime of the signed JWT access token
+	RefreshTokenTTL time.Duration // Lifetime of an opaque refresh token (reset on every rotation)
+
+	PasswordResetTTL time.Duration // How long an emailed reset link stays usable
+	PasswordResetURL string        // Link sent by email; %s is replaced with the reset token
+
+	EmailVerificationTTL         time.Duration // How long an emailed verification link stays usable
+	EmailVerificationURL         string        // Link sent by email; %s is replaced with the verification token
+	RequireVerifiedEmailForLogin bool          // Refuse to log in users who have not verified their email yet
+
+	EmailChangeTTL time.Duration // How long the link confirming a new email address stays usable
+	EmailChangeURL string        // Link sent to the new address; %s is replaced with the change token
+
+	Lockout LockoutPolicy // Back-off and lockout after failed logins
+
+	PasswordPolicy password.Policy // Rules for new passwords, including the breached password list
+	PasswordHasher password.Hasher // Algorithm and costs for new hashes; older hashes are upgraded on login
+
+	MFAIssuer       string        // Account issuer shown by authenticator apps
+	MFAChallengeTTL time.Duration // How long the second step of a login may take
+	MFAMaxAttempts  int           // Wrong codes allowed per challenge before the user must log in again
+
+	OAuthStateTTL time.Duration // How long the user has to sign in at an identity provider
+
+	APIKeyDefaultTTL time.Duration // Lifetime of an API key created without an explicit expiry
+	APIKeyMaxTTL     time.Duration // Longest lifetime an API key may be given
+
+	RegistrationGracePeriod time.Duration // Pending registrations older than this are rolled back by ReconcileProfiles
+
+	AccountDeletionGracePeriod time.Duration // How long a deleted account can be restored before it is purged
+
+	DataExportTTL time.Duration // How long a finished data export can be downloaded before it is deleted
+}
+
+// DefaultConfig returns short-lived access tokens backed by long-lived refresh tokens
+func DefaultConfig() Config {
+	return Config{
+		Issuer:          "auth-service",
+		Audience:        "gocommerce",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 30 * 24 * time.Hour,
+
+		PasswordResetTTL: time.Hour,
+		PasswordResetURL: "http://localhost:3000/reset-password?token=%s",
+
+		EmailVerificationTTL: 48 * time.Hour,
+		EmailVerificationURL: "http://localhost:3000/verify-email?token=%s",
+
+		EmailChangeTTL: 24 * time.Hour,
+		EmailChangeURL: "http://localhost:3000/confirm-email-change?token=%s",
+
+		Lockout: DefaultLockoutPolicy(),
+
+		PasswordPolicy: password.DefaultPolicy(),
+		PasswordHasher: password.DefaultHasher(),
+
+		MFAIssuer:       "GoCommerce",
+		MFAChallengeTTL: 5 * time.Minute,
+		MFAMaxAttempts:  5,
+
+		OAuthStateTTL: 10 * time.Minute,
+
+		APIKeyDefaultTTL: 90 * 24 * time.Hour,
+		APIKeyMaxTTL:     365 * 24 * time.Hour,
+
+		RegistrationGracePeriod: 5 * time.Minute,
+
+		AccountDeletionGracePeriod: 30 * 24 * time.Hour,
+
+		DataExportTTL: 7 * 24 * time.Hour,
+	}
+}
+
 type AuthService struct {
-	repo      repository.UserRepository
-	jwtSecret string
+	repo          repository.UserRepository
+	refreshTokens repository.RefreshTokenRepository
+	revocations   repository.RevocationStore
+	attempts      repository.LoginAttemptStore
+	sessions      repository.SessionRepository
+	mfa           repository.MFARepository
+	identities    repository.IdentityRepository
+	providers     map[string]idp.Provider
+	apiKeys       repository.APIKeyRepository
+	dataExports   repository.DataExportRepository
+	profiles      profiles.Store
+	keyring       *keys.Keyring
+	mailer        mail.Sender
+	cfg           Config
 }
 
-func NewAuthService(repo repository.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(repo repository.UserRepository, refreshTokens repository.RefreshTokenRepository, revocations repository.RevocationStore, attempts repository.LoginAttemptStore, sessions repository.SessionRepository, mfa repository.MFARepository, identities repository.IdentityRepository, providers map[string]idp.Provider, apiKeys repository.APIKeyRepository, dataExports repository.DataExportRepository, profileStore profiles.Store, keyring *keys.Keyring, mailer mail.Sender, cfg Config) *AuthService {
 	return &AuthService{
-		repo:      repo,
-		jwtSecret: jwtSecret,
+		repo:          repo,
+		refreshTokens: refreshTokens,
+		revocations:   revocations,
+		attempts:      attempts,
+		sessions:      sessions,
+		mfa:           mfa,
+		identities:    identities,
+		providers:     providers,
+		apiKeys:       apiKeys,
+		dataExports:   dataExports,
+		profiles:      profileStore,
+		keyring:       keyring,
+		mailer:        mailer,
+		cfg:           cfg,
 	}
 }
 
-// Register creates a new user account
-func (s *AuthService) Register(email, password, name string) (string, error) {
+// Register creates a new user account together with its user-service profile; if the profile
+// cannot be created nothing is kept and ErrProfileCreationFailed is returned
+func (s *AuthService) Register(ctx context.Context, email, password, name string) (string, error) {
 	// TODO(human): Implement registration logic
+	invalid := &ValidationError{}
+	if email = strings.TrimSpace(email); email == "" || !strings.Contains(email, "@") {
+		invalid.add("email", "invalid", "a valid email address is required")
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		invalid.add("name", "required", "name is required")
+	}
+	invalid.addPasswordViolations(s.cfg.PasswordPolicy, "password", password, email, name)
+	if err := invalid.err(); err != nil {
+		return "", err
+	}
+
 	existingUser, err := s.repo.GetUserByEmail(email)
 
 	if err != nil {
 		return "", err
 	}
 	if existingUser != nil {
-		return "", errors.New("email already registered")
+		return "", ErrEmailRegistered
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.cfg.PasswordHasher.Hash(password)
 
 	if err != nil {
 		return "", err
@@ -42,74 +165,255 @@ func (s *AuthService) Register(email, password, name string) (string, error) {
 
 	newUser := &models.User{
 		Email:    email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Name:     name,
 	}
-	err = s.repo.CreateUser(newUser)
-
+	// The unique index catches a concurrent registration of the same email that passed the check above
+	err = s.createUserWithProfile(ctx, newUser)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return "", ErrEmailRegistered
+	}
 	if err != nil {
 		return "", err
 	}
 
+	// A failed mail must not fail the registration; the user can ask for a new link
+	_ = s.sendVerificationEmail(newUser)
+
 	return newUser.ID, nil
 
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(email, password string) (string, error) {
+// Login authenticates a user and returns an access/refresh token pair, or an MFA challenge if the
+// account has two-factor authentication enabled.
+// Repeated failures for an account or from a client IP are throttled and eventually locked out (see LockoutPolicy).
+func (s *AuthService) Login(email, password string, client ClientInfo) (*LoginResult, error) {
 	// TODO(human): Implement login logic
+	now := time.Now()
+
+	if err := s.checkThrottle(email, client.IP, now); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
 
-	if err != nil || user == nil {
-		return "", errors.New("invalid credentials")
+	// Unknown emails count as failures too, so probing for accounts is throttled the same way
+	// Pending users are still being registered (or failed to be) and cannot log in yet, deleted ones no more
+	if user == nil || user.ProfileStatus == models.ProfileStatusPending || user.DeletedAt != nil || !s.checkPassword(user, password) {
+		if err := s.recordFailedLogin(email, client.IP, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 
-	// verify pwd
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if !user.EmailVerified && s.cfg.RequireVerifiedEmailForLogin {
+		return nil, ErrEmailNotVerified
+	}
 
+	mfaEnabled, err := s.mfaEnabled(user.ID)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		return nil, err
+	}
+	if mfaEnabled {
+		// Failed attempts are only cleared once the second factor is passed as well
+		mfaToken, err := s.createMFAChallenge(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
 	}
 
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+	return s.completeLogin(user, client)
+}
+
+// checkPassword verifies the user's password. After a match, a hash made with an older algorithm or
+// weaker costs is replaced by one following the current PasswordHasher; failing that is only logged.
+func (s *AuthService) checkPassword(user *models.User, password string) bool {
+	ok, needsRehash, err := s.cfg.PasswordHasher.Verify(password, user.Password)
+	if err != nil {
+		// Accounts created through an identity provider have no hash at all
+		if user.Password != "" {
+			log.Printf("Failed to verify password hash: user=%s err=%v", user.ID, err)
+		}
+		return false
+	}
+	if !ok || !needsRehash {
+		return ok
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hashedPassword, err := s.cfg.PasswordHasher.Hash(password)
+	if err == nil {
+		err = s.repo.UpdatePassword(user.ID, hashedPassword)
+	}
+	if err != nil {
+		log.Printf("Failed to upgrade password hash: user=%s err=%v", user.ID, err)
+		return true
+	}
 
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+	user.Password = hashedPassword
+	return true
+}
+
+// completeLogin clears failed attempts, records the login and starts a session once every factor has passed
+func (s *AuthService) completeLogin(user *models.User, client ClientInfo) (*LoginResult, error) {
+	// Social logins and MFA challenges started before a deletion end here too. Pending users have no
+	// profile yet and are deleted by ReconcileProfiles if registration never finishes.
+	if user.DeletedAt != nil || user.ProfileStatus == models.ProfileStatusPending {
+		return nil, ErrInvalidCredentials
+	}
 
+	if err := s.attempts.Reset(accountKey(user.Email)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.repo.UpdateLastLogin(user.ID, now); err != nil {
+		return nil, err
+	}
+	user.LastLogin = now
+
+	roles, err := s.repo.GetUserRoles(user.ID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// Every login starts a new session, which is also a new refresh token family
+	sessionID, err := s.startSession(user.ID, client)
+	if err != nil {
+		return nil, err
 	}
 
-	return tokenString, nil
+	tokens, err := s.issueTokenPair(user.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
 
+	return &LoginResult{User: user, Roles: roles, Tokens: tokens}, nil
 }
 
-// ValidateToken checks if a JWT token is valid and returns the user ID
-func (s *AuthService) ValidateToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.jwtSecret), nil
-	})
+// ValidateToken checks if a JWT token is valid and not revoked, and returns its claims
+func (s *AuthService) ValidateToken(tokenString string) (*AccessClaims, error) {
+	claims, err := s.parseAccessToken(tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
 
+	revoked, err := s.revocations.IsRevoked(claims.ID, claims.UserID, claims.IssuedAt.Time)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("%w: token has been revoked", ErrInvalidAccessToken)
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	// A revoked session shares the revocation list with individual tokens
+	if claims.SessionID != "" {
+		revoked, err := s.revocations.IsRevoked(claims.SessionID, claims.UserID, claims.IssuedAt.Time)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, fmt.Errorf("%w: session has been revoked", ErrInvalidAccessToken)
+		}
+	}
+
+	return claims, nil
+}
 
-	if !ok || !token.Valid {
-		return "", errors.New("Invalid token")
+// Me describes the caller behind an access token
+type Me struct {
+	User       *models.User
+	Claims     *AccessClaims
+	MFAEnabled bool
+}
+
+// GetMe validates an access token and returns the account it belongs to along with the token's claims
+func (s *AuthService) GetMe(accessToken string) (*Me, error) {
+	claims, err := s.ValidateToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	mfaEnabled, err := s.mfaEnabled(user.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	userID := claims["user_id"]
-	userIDStr, ok := userID.(string)
+	return &Me{User: user, Claims: claims, MFAEnabled: mfaEnabled}, nil
+}
+
+// Revocations returns the revocations made after since, along with the time the
+// snapshot was taken so callers can resume from it
+func (s *AuthService) Revocations(since time.Time) ([]models.RevokedToken, []models.UserRevocation, time.Time, error) {
+	asOf := time.Now()
+
+	tokens, users, err := s.revocations.ListRevocationsSince(since)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	return tokens, users, asOf, nil
+}
+
+// Logout ends the session the presented access token belongs to.
+// Tokens minted before sessions existed carry no sid; for those the access token and,
+// if given, the refresh token family are revoked instead.
+func (s *AuthService) Logout(accessToken, refreshToken string) error {
+	claims, err := s.ValidateToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.revocations.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	if claims.SessionID != "" {
+		if err := s.revokeSession(claims.SessionID); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := s.refreshTokens.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	// Never let one user revoke another user's refresh tokens
+	if stored == nil || stored.UserID != claims.UserID {
+		return ErrInvalidRefreshToken
+	}
+
+	return s.revokeSession(stored.FamilyID)
+}
+
+// RevokeAllSessions invalidates every session, access and refresh token issued to a user so far
+func (s *AuthService) RevokeAllSessions(userID string) error {
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	if err := s.revocations.RevokeAllForUser(userID, time.Now()); err != nil {
+		return err
+	}
 
-	if !ok {
-		return "", errors.New("Invalid token claims")
+	if err := s.sessions.RevokeUserSessions(userID); err != nil {
+		return err
 	}
 
-	return userIDStr, nil
+	return s.refreshTokens.RevokeUserTokens(userID)
 }
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"archive/zip"
+	"auth-service/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrDataExportNotFound = errors.New("data export not found")
+	ErrDataExportNotReady = errors.New("data export is not ready for download")
+)
+
+// dataExportStaleAfter is how long a running export may take before another worker picks it up again
+const dataExportStaleAfter = 15 * time.Minute
+
+// dataExportReadme explains the files of an export archive to the user
+const dataExportReadme = `This archive contains the personal data GoCommerce stores about your account.
+
+account.json  Your login details: account, roles, two-factor authentication, active sessions,
+              API keys and linked sign-in providers. Passwords, secrets and keys themselves
+              are only stored as hashes and are not included.
+profile.json  Your profile, saved addresses and preferences.
+
+All times are in UTC.
+`
+
+// RequestDataExport queues an export of everything stored about the user. The archive is built in the
+// background by ProcessDataExports; while an export is still pending or running it is returned instead
+// of queueing another one.
+func (s *AuthService) RequestDataExport(userID string) (*models.DataExport, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	export, err := s.dataExports.GetUnfinishedDataExport(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if export != nil {
+		return export, nil
+	}
+
+	export = &models.DataExport{UserID: user.ID}
+	if err := s.dataExports.CreateDataExport(export); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Data export requested: user=%s export=%s", user.ID, export.ID)
+	return export, nil
+}
+
+// GetDataExport returns one of the user's exports
+func (s *AuthService) GetDataExport(userID, exportID string) (*models.DataExport, error) {
+	export, err := s.dataExports.GetDataExport(userID, exportID)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil {
+		return nil, ErrDataExportNotFound
+	}
+
+	return export, nil
+}
+
+// DownloadDataExport returns the zip archive of a ready export
+func (s *AuthService) DownloadDataExport(userID, exportID string) ([]byte, error) {
+	export, err := s.GetDataExport(userID, exportID)
+	if err != nil {
+		return nil, err
+	}
+	if export.Status != models.DataExportReady {
+		return nil, ErrDataExportNotReady
+	}
+
+	archive, err := s.dataExports.GetDataExportArchive(userID, exportID)
+	if err != nil {
+		return nil, err
+	}
+	if archive == nil {
+		// Expired since it was read above; the cleanup just has not caught up yet
+		return nil, ErrDataExportNotFound
+	}
+
+	return archive, nil
+}
+
+// ProcessDataExports builds every queued export, one at a time, and emails each user once theirs is
+// ready. A failed export is kept as failed so the user can see it and ask for a new one.
+func (s *AuthService) ProcessDataExports(ctx context.Context) (int, error) {
+	processed := 0
+	for ctx.Err() == nil {
+		export, err := s.dataExports.ClaimDataExport(time.Now().Add(-dataExportStaleAfter))
+		if err != nil {
+			return processed, err
+		}
+		if export == nil {
+			return processed, nil
+		}
+
+		expiresAt := time.Now().Add(s.cfg.DataExportTTL)
+		user, archive, err := s.buildDataExport(ctx, export.UserID)
+		if err != nil {
+			log.Printf("Failed to build data export: user=%s export=%s err=%v", export.UserID, export.ID, err)
+			if err := s.dataExports.FailDataExport(export.ID, "the export could not be created, please request a new one", expiresAt); err != nil {
+				return processed, err
+			}
+			processed++
+			continue
+		}
+
+		if err := s.dataExports.CompleteDataExport(export.ID, archive, expiresAt); err != nil {
+			return processed, err
+		}
+		processed++
+
+		s.sendSecurityNotice(user, "Your data export is ready",
+			fmt.Sprintf("The copy of your data you asked for is ready. You can download it from your account settings until %s.",
+				expiresAt.UTC().Format("January 2, 2006")))
+	}
+
+	return processed, ctx.Err()
+}
+
+// RunDataExports calls ProcessDataExports every interval until ctx is cancelled,
+// and deletes expired exports along the way
+func (s *AuthService) RunDataExports(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			processed, err := s.ProcessDataExports(ctx)
+			if err != nil {
+				log.Printf("Failed to process data exports: %v", err)
+			}
+			if processed > 0 {
+				log.Printf("Processed %d data exports", processed)
+			}
+
+			if _, err := s.dataExports.DeleteExpiredDataExports(time.Now()); err != nil {
+				log.Printf("Failed to delete expired data exports: %v", err)
+			}
+		}
+	}
+}
+
+// accountExport is what auth-service stores about a user, as written to account.json.
+// The JSON names are part of the export format, so fields are only ever added.
+type accountExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Account    struct {
+		ID              string     `json:"id"`
+		Email           string     `json:"email"`
+		Name            string     `json:"name"`
+		CreatedAt       time.Time  `json:"created_at"`
+		LastLogin       time.Time  `json:"last_login"`
+		EmailVerified   bool       `json:"email_verified"`
+		EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	} `json:"account"`
+	Roles []string `json:"roles"`
+	MFA   struct {
+		Enabled     bool       `json:"enabled"`
+		ConfirmedAt *time.Time `json:"confirmed_at"`
+	} `json:"mfa"`
+	Sessions   []sessionExport  `json:"sessions"`
+	APIKeys    []apiKeyExport   `json:"api_keys"`
+	Identities []identityExport `json:"identities"`
+}
+
+type sessionExport struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type apiKeyExport struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type identityExport struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// buildDataExport collects the user's data from both services into a zip archive
+func (s *AuthService) buildDataExport(ctx context.Context, userID string) (*models.User, []byte, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return nil, nil, ErrUserNotFound
+	}
+
+	account, err := s.exportAccount(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile, err := s.profiles.ExportProfile(ctx, user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("export profile: %w", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"README.txt", []byte(dataExportReadme)},
+		{"account.json", account},
+		{"profile.json", profile},
+	}
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(file.data); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return user, buf.Bytes(), nil
+}
+
+// exportAccount renders account.json. Password hashes, TOTP secrets, recovery codes and API key
+// hashes are credentials, not personal data, and are left out.
+func (s *AuthService) exportAccount(user *models.User) ([]byte, error) {
+	export := accountExport{ExportedAt: time.Now().UTC()}
+	export.Account.ID = user.ID
+	export.Account.Email = user.Email
+	export.Account.Name = user.Name
+	export.Account.CreatedAt = user.CreatedAt
+	export.Account.LastLogin = user.LastLogin
+	export.Account.EmailVerified = user.EmailVerified
+	export.Account.EmailVerifiedAt = user.EmailVerifiedAt
+
+	roles, err := s.repo.GetUserRoles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Roles = append([]string{}, roles...)
+
+	secret, err := s.mfa.GetMFASecret(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if secret != nil && secret.ConfirmedAt != nil {
+		export.MFA.Enabled = true
+		export.MFA.ConfirmedAt = secret.ConfirmedAt
+	}
+
+	sessions, err := s.sessions.ListActiveSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Sessions = make([]sessionExport, 0, len(sessions))
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, sessionExport{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+		})
+	}
+
+	keys, err := s.apiKeys.ListAPIKeys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.APIKeys = make([]apiKeyExport, 0, len(keys))
+	for _, key := range keys {
+		export.APIKeys = append(export.APIKeys, apiKeyExport{
+			ID:         key.ID,
+			Name:       key.Name,
+			Prefix:     key.Prefix,
+			Scopes:     append([]string{}, key.Scopes...),
+			CreatedAt:  key.CreatedAt,
+			ExpiresAt:  key.ExpiresAt,
+			LastUsedAt: key.LastUsedAt,
+		})
+	}
+
+	identities, err := s.identities.ListIdentities(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Identities = make([]identityExport, 0, len(identities))
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, identityExport{
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	return json.MarshalIndent(export, "", "  ")
+}
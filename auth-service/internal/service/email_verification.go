@@ -0,0 +1,88 @@
+package service
+
+import (
+	"auth-service/internal/mail"
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrEmailNotVerified         = errors.New("email address has not been verified")
+)
+
+// VerifyEmail marks the account owning the token as verified
+func (s *AuthService) VerifyEmail(rawToken string) (string, error) {
+	if rawToken == "" {
+		return "", ErrInvalidVerificationToken
+	}
+
+	token, err := s.repo.GetEmailVerificationTokenByHash(hashToken(rawToken))
+	if err != nil {
+		return "", err
+	}
+	if token == nil || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return "", ErrInvalidVerificationToken
+	}
+
+	err = s.repo.MarkEmailVerified(token.ID, token.UserID)
+	if errors.Is(err, repository.ErrVerificationTokenUsed) {
+		return "", ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return token.UserID, nil
+}
+
+// ResendVerificationEmail sends a fresh verification link.
+// Like RequestPasswordReset it does not reveal whether the email is registered.
+func (s *AuthService) ResendVerificationEmail(email string) error {
+	if email == "" {
+		return errors.New("email is required")
+	}
+
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.EmailVerified {
+		return nil
+	}
+
+	return s.sendVerificationEmail(user)
+}
+
+func (s *AuthService) sendVerificationEmail(user *models.User) error {
+	rawToken, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.CreateEmailVerificationToken(&models.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(s.cfg.EmailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Name, s.cfg.EmailVerificationTTL, fmt.Sprintf(s.cfg.EmailVerificationURL, rawToken),
+		),
+	})
+	if err != nil {
+		log.Printf("Failed to send verification email: user=%s err=%v", user.ID, err)
+	}
+	return err
+}
@@ -0,0 +1,679 @@
+package service
+
+import (
+	"auth-service/internal/idp"
+	"auth-service/internal/keys"
+	"auth-service/internal/mail"
+	"auth-service/internal/models"
+	"auth-service/internal/profiles"
+	"auth-service/internal/repository"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The fakes below keep everything in memory. Each embeds the interface it stands in for, so a test
+// that reaches a method nobody implemented fails loudly with a nil pointer panic.
+
+type fakeUserRepo struct {
+	repository.UserRepository
+
+	mu    sync.Mutex
+	users map[string]*models.User
+	roles map[string][]string
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: make(map[string]*models.User), roles: make(map[string][]string)}
+}
+
+// CreateUser refuses emails taken in any case, like the unique index on lower(email)
+func (r *fakeUserRepo) CreateUser(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if strings.EqualFold(existing.Email, user.Email) {
+			return repository.ErrEmailTaken
+		}
+	}
+	user.ID = uuid.New().String()
+	user.CreatedAt = time.Now()
+	if user.ProfileStatus == "" {
+		user.ProfileStatus = models.ProfileStatusActive
+	}
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) GetUserByEmail(email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeUserRepo) GetUserByID(id string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[id]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeUserRepo) update(id string, fn func(*models.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[id]; ok {
+		fn(user)
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateLastLogin(userID string, at time.Time) error {
+	return r.update(userID, func(u *models.User) { u.LastLogin = at })
+}
+
+func (r *fakeUserRepo) SetProfileStatus(userID, status string) error {
+	return r.update(userID, func(u *models.User) { u.ProfileStatus = status })
+}
+
+func (r *fakeUserRepo) UpdatePassword(userID, passwordHash string) error {
+	return r.update(userID, func(u *models.User) { u.Password = passwordHash })
+}
+
+func (r *fakeUserRepo) TakeOverUnverifiedAccount(userID string, verifiedAt time.Time) error {
+	return r.update(userID, func(u *models.User) {
+		u.Password = ""
+		u.EmailVerified = true
+		u.EmailVerifiedAt = &verifiedAt
+	})
+}
+
+func (r *fakeUserRepo) CreateEmailVerificationToken(token *models.EmailVerificationToken) error {
+	return nil
+}
+
+func (r *fakeUserRepo) AssignRole(userID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.roles[userID] = append(r.roles[userID], role)
+	return nil
+}
+
+func (r *fakeUserRepo) GetUserRoles(userID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.roles[userID]...), nil
+}
+
+func (r *fakeUserRepo) GetRolePermissions(roles []string) ([]string, error) {
+	var permissions []string
+	for _, role := range roles {
+		switch role {
+		case DefaultRole:
+			permissions = append(permissions, "users:read:self", "users:write:self")
+		case "support":
+			permissions = append(permissions, "users:read:any")
+		}
+	}
+	return permissions, nil
+}
+
+type fakeRefreshTokenRepo struct {
+	mu     sync.Mutex
+	tokens map[string]*models.RefreshToken // by hash
+}
+
+func newFakeRefreshTokenRepo() *fakeRefreshTokenRepo {
+	return &fakeRefreshTokenRepo{tokens: make(map[string]*models.RefreshToken)}
+}
+
+func (r *fakeRefreshTokenRepo) CreateRefreshToken(token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = uuid.New().String()
+	token.CreatedAt = time.Now()
+	stored := *token
+	r.tokens[token.TokenHash] = &stored
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token, ok := r.tokens[tokenHash]; ok {
+		copied := *token
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeRefreshTokenRepo) RotateRefreshToken(oldID string, next *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.ID != oldID {
+			continue
+		}
+		if token.RevokedAt != nil {
+			return repository.ErrRefreshTokenRotated
+		}
+
+		next.ID = uuid.New().String()
+		next.CreatedAt = time.Now()
+		stored := *next
+		r.tokens[next.TokenHash] = &stored
+
+		now := time.Now()
+		token.RevokedAt = &now
+		token.ReplacedBy = next.ID
+		return nil
+	}
+	return repository.ErrRefreshTokenRotated
+}
+
+func (r *fakeRefreshTokenRepo) revokeWhere(match func(*models.RefreshToken) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.tokens {
+		if match(token) && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) RevokeTokenFamily(familyID string) error {
+	return r.revokeWhere(func(t *models.RefreshToken) bool { return t.FamilyID == familyID })
+}
+
+func (r *fakeRefreshTokenRepo) RevokeUserTokens(userID string) error {
+	return r.revokeWhere(func(t *models.RefreshToken) bool { return t.UserID == userID })
+}
+
+type fakeSessionRepo struct {
+	mu       sync.Mutex
+	sessions map[string]*models.Session
+}
+
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{sessions: make(map[string]*models.Session)}
+}
+
+func (r *fakeSessionRepo) CreateSession(session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *fakeSessionRepo) GetSession(id string) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		copied := *session
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeSessionRepo) ListActiveSessions(userID string) ([]models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var active []models.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(time.Now()) {
+			active = append(active, *session)
+		}
+	}
+	return active, nil
+}
+
+func (r *fakeSessionRepo) TouchSession(id, ipAddress, userAgent string, seenAt, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		session.LastSeenAt = seenAt
+		session.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) RevokeSession(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeSessionRepo) RevokeUserSessions(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type fakeMFARepo struct {
+	repository.MFARepository
+
+	mu            sync.Mutex
+	secrets       map[string]*models.MFASecret
+	recoveryCodes map[string]map[string]bool // user -> hash -> used
+	challenges    map[string]*models.MFAChallenge
+}
+
+func newFakeMFARepo() *fakeMFARepo {
+	return &fakeMFARepo{
+		secrets:       make(map[string]*models.MFASecret),
+		recoveryCodes: make(map[string]map[string]bool),
+		challenges:    make(map[string]*models.MFAChallenge),
+	}
+}
+
+func (r *fakeMFARepo) SaveMFASecret(userID, secret string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.secrets[userID] = &models.MFASecret{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (r *fakeMFARepo) GetMFASecret(userID string) (*models.MFASecret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if secret, ok := r.secrets[userID]; ok {
+		copied := *secret
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeMFARepo) ConfirmMFA(userID string, step int64, recoveryCodeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.secrets[userID].ConfirmedAt = &now
+	r.secrets[userID].LastUsedStep = step
+	r.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+func (r *fakeMFARepo) UseTOTPStep(userID string, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	secret := r.secrets[userID]
+	if step <= secret.LastUsedStep {
+		return false, nil
+	}
+	secret.LastUsedStep = step
+	return true, nil
+}
+
+func (r *fakeMFARepo) DeleteMFA(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.secrets, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+func (r *fakeMFARepo) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (r *fakeMFARepo) replaceRecoveryCodes(userID string, codeHashes []string) {
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	r.recoveryCodes[userID] = codes
+}
+
+func (r *fakeMFARepo) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used, ok := r.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.recoveryCodes[userID][codeHash] = true
+	return true, nil
+}
+
+func (r *fakeMFARepo) CreateMFAChallenge(challenge *models.MFAChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge.ID = uuid.New().String()
+	challenge.CreatedAt = time.Now()
+	stored := *challenge
+	r.challenges[challenge.TokenHash] = &stored
+	return nil
+}
+
+func (r *fakeMFARepo) GetMFAChallengeByHash(tokenHash string) (*models.MFAChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if challenge, ok := r.challenges[tokenHash]; ok {
+		copied := *challenge
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeMFARepo) ConsumeMFAChallenge(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge := r.challengeByID(id)
+	if challenge == nil || challenge.UsedAt != nil {
+		return repository.ErrMFAChallengeUsed
+	}
+	now := time.Now()
+	challenge.UsedAt = &now
+	return nil
+}
+
+func (r *fakeMFARepo) ReleaseMFAChallenge(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if challenge := r.challengeByID(id); challenge != nil {
+		challenge.UsedAt = nil
+		challenge.Attempts++
+	}
+	return nil
+}
+
+func (r *fakeMFARepo) challengeByID(id string) *models.MFAChallenge {
+	for _, challenge := range r.challenges {
+		if challenge.ID == id {
+			return challenge
+		}
+	}
+	return nil
+}
+
+type fakeIdentityRepo struct {
+	mu         sync.Mutex
+	states     map[string]*models.OAuthState
+	identities []models.UserIdentity
+}
+
+func newFakeIdentityRepo() *fakeIdentityRepo {
+	return &fakeIdentityRepo{states: make(map[string]*models.OAuthState)}
+}
+
+func (r *fakeIdentityRepo) CreateOAuthState(state *models.OAuthState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state.ID = uuid.New().String()
+	state.CreatedAt = time.Now()
+	stored := *state
+	r.states[state.StateHash] = &stored
+	return nil
+}
+
+func (r *fakeIdentityRepo) ConsumeOAuthState(stateHash string) (*models.OAuthState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[stateHash]
+	if !ok || state.UsedAt != nil {
+		return nil, nil
+	}
+	now := time.Now()
+	state.UsedAt = &now
+	copied := *state
+	return &copied, nil
+}
+
+func (r *fakeIdentityRepo) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			copied := identity
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeIdentityRepo) LinkIdentity(identity *models.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return nil
+		}
+	}
+	identity.CreatedAt = time.Now()
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) ListIdentities(userID string) ([]models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var identities []models.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+type fakeAPIKeyRepo struct {
+	repository.APIKeyRepository
+
+	mu   sync.Mutex
+	keys []*models.APIKey
+}
+
+func (r *fakeAPIKeyRepo) CreateAPIKey(key *models.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+	stored := *key
+	r.keys = append(r.keys, &stored)
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeAPIKeyRepo) RevokeUserAPIKeys(userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range r.keys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			key.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeAPIKeyRepo) TouchAPIKey(id string, usedAt time.Time) error {
+	return nil
+}
+
+type fakeSigningKeyRepo struct {
+	mu   sync.Mutex
+	keys []*models.SigningKey
+}
+
+func (r *fakeSigningKeyRepo) CreateSigningKey(key *models.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append([]*models.SigningKey{key}, r.keys...)
+	return nil
+}
+
+func (r *fakeSigningKeyRepo) GetValidSigningKeys(now time.Time) ([]*models.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var valid []*models.SigningKey
+	for _, key := range r.keys {
+		if key.ExpiresAt.After(now) {
+			valid = append(valid, key)
+		}
+	}
+	return valid, nil
+}
+
+// fakeProfiles accepts every profile change, as a healthy user-service would
+type fakeProfiles struct {
+	profiles.Store
+}
+
+func (fakeProfiles) CreateProfile(ctx context.Context, userID, email, name string) error {
+	return nil
+}
+
+// fakeMailer keeps the mails it was asked to send
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *fakeMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// testEnv is an AuthService wired to in-memory fakes, with the fakes at hand for assertions
+type testEnv struct {
+	svc           *AuthService
+	users         *fakeUserRepo
+	refreshTokens *fakeRefreshTokenRepo
+	revocations   *repository.InMemoryRevocationStore
+	attempts      *repository.InMemoryLoginAttemptStore
+	sessions      *fakeSessionRepo
+	mfa           *fakeMFARepo
+	identities    *fakeIdentityRepo
+	apiKeys       *fakeAPIKeyRepo
+	mailer        *fakeMailer
+}
+
+func newTestEnv(t *testing.T, providers map[string]idp.Provider, configure ...func(*Config)) *testEnv {
+	t.Helper()
+
+	keyring, err := keys.NewKeyring(&fakeSigningKeyRepo{}, keys.AlgEdDSA, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+
+	env := &testEnv{
+		users:         newFakeUserRepo(),
+		refreshTokens: newFakeRefreshTokenRepo(),
+		revocations:   repository.NewInMemoryRevocationStore(),
+		attempts:      repository.NewInMemoryLoginAttemptStore(),
+		sessions:      newFakeSessionRepo(),
+		mfa:           newFakeMFARepo(),
+		identities:    newFakeIdentityRepo(),
+		apiKeys:       &fakeAPIKeyRepo{},
+		mailer:        &fakeMailer{},
+	}
+	env.svc = NewAuthService(env.users, env.refreshTokens, env.revocations, env.attempts, env.sessions, env.mfa,
+		env.identities, providers, env.apiKeys, nil, fakeProfiles{}, keyring, env.mailer, cfg)
+	return env
+}
+
+// addUser stores a user with the given password and the default role
+func (e *testEnv) addUser(t *testing.T, email, password string, verified bool) *models.User {
+	t.Helper()
+
+	hash, err := e.svc.cfg.PasswordHasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	user := &models.User{Email: email, Name: "Test User", Password: hash, EmailVerified: verified}
+	if err := e.users.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := e.users.AssignRole(user.ID, DefaultRole); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	return user
+}
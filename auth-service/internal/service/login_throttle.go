@@ -0,0 +1,159 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LockoutPolicy configures brute-force protection for Login
+type LockoutPolicy struct {
+	Window time.Duration // Failures older than this are forgotten
+
+	BackoffAfter int           // Failures before each further attempt must wait
+	BaseDelay    time.Duration // First back-off delay; doubles with every further failure
+	MaxDelay     time.Duration // Upper bound of the back-off delay
+
+	LockAfter    int           // Failures before the account is locked outright
+	LockDuration time.Duration // How long a locked account stays locked (or until an admin unlocks it)
+
+	IPMaxFailures   int           // Failures from one client IP, across all accounts, before it is blocked
+	IPBlockDuration time.Duration // How long a blocked IP stays blocked
+}
+
+// DefaultLockoutPolicy is lenient enough for people and slow enough for scripts
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		Window:          time.Hour,
+		BackoffAfter:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockAfter:       10,
+		LockDuration:    30 * time.Minute,
+		IPMaxFailures:   50,
+		IPBlockDuration: 15 * time.Minute,
+	}
+}
+
+// ThrottleError is returned by Login while an account or client IP has to wait before trying again
+type ThrottleError struct {
+	Locked     bool // The account is locked, as opposed to merely backing off
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account is temporarily locked, retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// UnlockAccount clears the failed attempts and any lock of an account
+func (s *AuthService) UnlockAccount(userID string) error {
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	return s.attempts.Reset(accountKey(user.Email))
+}
+
+// checkThrottle refuses the attempt early if the account or the client IP is waiting out a back-off or lock
+func (s *AuthService) checkThrottle(email, clientIP string, now time.Time) error {
+	if clientIP != "" {
+		ipAttempts, err := s.attempts.GetAttempts(ipKey(clientIP))
+		if err != nil {
+			return err
+		}
+		if wait := lockRemaining(ipAttempts, now); wait > 0 {
+			return &ThrottleError{RetryAfter: wait}
+		}
+	}
+
+	account, err := s.attempts.GetAttempts(accountKey(email))
+	if err != nil {
+		return err
+	}
+	if wait := lockRemaining(account, now); wait > 0 {
+		return &ThrottleError{Locked: account.Failures >= s.cfg.Lockout.LockAfter, RetryAfter: wait}
+	}
+
+	return nil
+}
+
+// recordFailedLogin counts a failure against the account and the IP and applies back-off or lockout
+func (s *AuthService) recordFailedLogin(email, clientIP string, now time.Time) error {
+	p := s.cfg.Lockout
+
+	account, err := s.attempts.RecordFailure(accountKey(email), now, p.Window)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case account.Failures >= p.LockAfter:
+		log.Printf("🔒 Account locked after %d failed logins", account.Failures)
+		if err := s.attempts.LockUntil(account.Key, now.Add(p.LockDuration)); err != nil {
+			return err
+		}
+	case account.Failures >= p.BackoffAfter:
+		if err := s.attempts.LockUntil(account.Key, now.Add(backoffDelay(p, account.Failures))); err != nil {
+			return err
+		}
+	}
+
+	if clientIP == "" {
+		return nil
+	}
+
+	ip, err := s.attempts.RecordFailure(ipKey(clientIP), now, p.Window)
+	if err != nil {
+		return err
+	}
+	if ip.Failures >= p.IPMaxFailures {
+		log.Printf("🚫 Blocking client IP %s after %d failed logins", clientIP, ip.Failures)
+		return s.attempts.LockUntil(ip.Key, now.Add(p.IPBlockDuration))
+	}
+
+	return nil
+}
+
+// backoffDelay doubles for every failure past BackoffAfter, up to MaxDelay
+func backoffDelay(p LockoutPolicy, failures int) time.Duration {
+	delay := p.BaseDelay
+	for i := p.BackoffAfter; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func lockRemaining(a *models.LoginAttempts, now time.Time) time.Duration {
+	if a == nil || a.LockedUntil == nil || !a.LockedUntil.After(now) {
+		return 0
+	}
+	return a.LockedUntil.Sub(now)
+}
+
+// Emails are normalized so "Bob@x.com" and "bob@x.com" share one counter
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	p := DefaultLockoutPolicy()
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 5, want: 4 * time.Second},
+		{failures: 10, want: 128 * time.Second},
+		{failures: 11, want: 256 * time.Second},
+		{failures: 12, want: 5 * time.Minute}, // 512s, capped
+		{failures: 1000, want: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := backoffDelay(p, tt.failures); got != tt.want {
+			t.Errorf("backoffDelay(%d failures) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockRemaining(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Second), now.Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		attempts *models.LoginAttempts
+		want     time.Duration
+	}{
+		{name: "no attempts", attempts: nil},
+		{name: "never locked", attempts: &models.LoginAttempts{Failures: 2}},
+		{name: "lock expired", attempts: &models.LoginAttempts{LockedUntil: &past}},
+		{name: "locked", attempts: &models.LoginAttempts{LockedUntil: &future}, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockRemaining(tt.attempts, now); got != tt.want {
+				t.Errorf("lockRemaining = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy LockoutPolicy
+		// Clients of the failed logins made before the final attempt
+		failures []ClientInfo
+		emails   []string // Email used for each failure; the account's own if empty
+		// Final attempt with the right password
+		client     ClientInfo
+		wantLocked bool
+		wantWait   time.Duration // Expected RetryAfter, rounded to the minute; zero if the login succeeds
+	}{
+		{
+			name:     "below the back-off threshold",
+			policy:   LockoutPolicy{Window: time.Hour, BackoffAfter: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 10, LockDuration: time.Hour, IPMaxFailures: 50, IPBlockDuration: time.Hour},
+			failures: []ClientInfo{{IP: "198.51.100.1"}, {IP: "198.51.100.1"}},
+			client:   ClientInfo{IP: "198.51.100.1"},
+		},
+		{
+			name:     "backing off",
+			policy:   LockoutPolicy{Window: time.Hour, BackoffAfter: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 10, LockDuration: time.Hour, IPMaxFailures: 50, IPBlockDuration: time.Hour},
+			failures: []ClientInfo{{IP: "198.51.100.1"}, {IP: "198.51.100.1"}},
+			client:   ClientInfo{IP: "198.51.100.1"},
+			wantWait: time.Minute,
+		},
+		{
+			name:     "back-off follows the account to another IP",
+			policy:   LockoutPolicy{Window: time.Hour, BackoffAfter: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 10, LockDuration: time.Hour, IPMaxFailures: 50, IPBlockDuration: time.Hour},
+			failures: []ClientInfo{{IP: "198.51.100.1"}, {IP: "198.51.100.2"}},
+			client:   ClientInfo{IP: "198.51.100.3"},
+			wantWait: time.Minute,
+		},
+		{
+			name:     "email spellings share a counter",
+			policy:   LockoutPolicy{Window: time.Hour, BackoffAfter: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 10, LockDuration: time.Hour, IPMaxFailures: 50, IPBlockDuration: time.Hour},
+			failures: []ClientInfo{{}, {}},
+			emails:   []string{"JANE@example.com", " jane@Example.com "},
+			wantWait: time.Minute,
+		},
+		{
+			name:       "locked",
+			policy:     LockoutPolicy{Window: time.Hour, BackoffAfter: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 3, LockDuration: 30 * time.Minute, IPMaxFailures: 50, IPBlockDuration: time.Hour},
+			failures:   []ClientInfo{{}, {}, {}},
+			wantLocked: true,
+			wantWait:   30 * time.Minute,
+		},
+		{
+			name:     "IP blocked across accounts",
+			policy:   LockoutPolicy{Window: time.Hour, BackoffAfter: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 10, LockDuration: time.Hour, IPMaxFailures: 3, IPBlockDuration: 15 * time.Minute},
+			failures: []ClientInfo{{IP: "198.51.100.1"}, {IP: "198.51.100.1"}, {IP: "198.51.100.1"}},
+			emails:   []string{"a@example.com", "b@example.com", "c@example.com"},
+			client:   ClientInfo{IP: "198.51.100.1"},
+			wantWait: 15 * time.Minute,
+		},
+		{
+			name:     "blocked IP does not lock out other IPs",
+			policy:   LockoutPolicy{Window: time.Hour, BackoffAfter: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 10, LockDuration: time.Hour, IPMaxFailures: 3, IPBlockDuration: 15 * time.Minute},
+			failures: []ClientInfo{{IP: "198.51.100.1"}, {IP: "198.51.100.1"}, {IP: "198.51.100.1"}},
+			emails:   []string{"a@example.com", "b@example.com", "c@example.com"},
+			client:   ClientInfo{IP: "198.51.100.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, nil, func(cfg *Config) { cfg.Lockout = tt.policy })
+			user := env.addUser(t, "jane@example.com", testPassword, true)
+
+			for i, client := range tt.failures {
+				email := user.Email
+				if tt.emails != nil {
+					email = tt.emails[i]
+				}
+				if _, err := env.svc.Login(email, "wrong password", client); !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("failure %d: error = %v, want %v", i+1, err, ErrInvalidCredentials)
+				}
+			}
+
+			_, err := env.svc.Login(user.Email, testPassword, tt.client)
+			if tt.wantWait == 0 {
+				if err != nil {
+					t.Fatalf("Login: %v", err)
+				}
+				// A successful login starts the account's count over
+				if a, _ := env.attempts.GetAttempts(accountKey(user.Email)); a != nil {
+					t.Errorf("failed attempts kept after a successful login: %+v", a)
+				}
+				return
+			}
+
+			var throttled *ThrottleError
+			if !errors.As(err, &throttled) {
+				t.Fatalf("Login error = %v, want a ThrottleError", err)
+			}
+			if throttled.Locked != tt.wantLocked {
+				t.Errorf("Locked = %v, want %v", throttled.Locked, tt.wantLocked)
+			}
+			if got := throttled.RetryAfter.Round(time.Minute); got != tt.wantWait {
+				t.Errorf("RetryAfter = %s, want about %s", throttled.RetryAfter, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestUnlockAccount(t *testing.T) {
+	env := newTestEnv(t, nil, func(cfg *Config) {
+		cfg.Lockout.LockAfter = 2
+		cfg.Lockout.BackoffAfter = 10
+	})
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+
+	for range 2 {
+		env.svc.Login(user.Email, "wrong password", ClientInfo{})
+	}
+	var throttled *ThrottleError
+	if _, err := env.svc.Login(user.Email, testPassword, ClientInfo{}); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("Login error = %v, want a locked account", err)
+	}
+
+	if err := env.svc.UnlockAccount(user.ID); err != nil {
+		t.Fatalf("UnlockAccount: %v", err)
+	}
+	if _, err := env.svc.Login(user.Email, testPassword, ClientInfo{}); err != nil {
+		t.Errorf("Login after UnlockAccount: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"auth-service/internal/totp"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor challenge")
+)
+
+// LoginResult is either the authenticated user with a token pair or, for accounts with MFA,
+// a challenge token for VerifyMFA
+type LoginResult struct {
+	User     *models.User
+	Roles    []string
+	Tokens   *TokenPair
+	MFAToken string
+	Created  bool // The login created the account (OAuth sign-up)
+}
+
+// BeginMFAEnrollment generates a new TOTP secret and the otpauth:// URI to show as a QR code.
+// MFA is not enforced until ConfirmMFAEnrollment proves the authenticator app works.
+func (s *AuthService) BeginMFAEnrollment(userID string) (string, string, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user == nil {
+		return "", "", errors.New("user not found")
+	}
+
+	existing, err := s.mfa.GetMFASecret(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.mfa.SaveMFASecret(userID, secret); err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(s.cfg.MFAIssuer, user.Email, secret), nil
+}
+
+// ConfirmMFAEnrollment enables MFA once the user enters a valid code, and returns the recovery codes.
+// The plain recovery codes are only ever shown here.
+func (s *AuthService) ConfirmMFAEnrollment(userID, code string) ([]string, error) {
+	pending, err := s.mfa.GetMFASecret(userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil {
+		return nil, ErrMFANotEnabled
+	}
+	if pending.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(pending.Secret, code, time.Now(), 1)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfa.ConfirmMFA(userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableMFA turns MFA off. Like a password change it needs the current password, and also a current
+// code (or a recovery code); wrong ones count as failed logins.
+func (s *AuthService) DisableMFA(userID, currentPassword, code string, client ClientInfo) error {
+	user, err := s.reauthenticate(userID, currentPassword, client)
+	if err != nil {
+		return err
+	}
+	if err := s.requireSecondFactor(user, code, client); err != nil {
+		return err
+	}
+
+	return s.mfa.DeleteMFA(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes; the current password and a current code
+// (or a recovery code) are required, as for DisableMFA
+func (s *AuthService) RegenerateRecoveryCodes(userID, currentPassword, code string, client ClientInfo) ([]string, error) {
+	user, err := s.reauthenticate(userID, currentPassword, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireSecondFactor(user, code, client); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfa.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyMFA exchanges the challenge token returned by Login and a TOTP or recovery code for a token pair.
+// Wrong codes count as failed logins, so the lockout policy applies to the second factor too.
+func (s *AuthService) VerifyMFA(mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	if mfaToken == "" || code == "" {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	challenge, err := s.mfa.GetMFAChallengeByHash(hashToken(mfaToken))
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) ||
+		challenge.Attempts >= s.cfg.MFAMaxAttempts {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	user, err := s.repo.GetUserByID(challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	now := time.Now()
+	if err := s.checkThrottle(user.Email, client.IP, now); err != nil {
+		return nil, err
+	}
+
+	// Claim the challenge before the code: of two requests racing with it, the loser must not
+	// spend a recovery code or TOTP step on a login that cannot happen
+	err = s.mfa.ConsumeMFAChallenge(challenge.ID)
+	if errors.Is(err, repository.ErrMFAChallengeUsed) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.checkSecondFactor(user.ID, code, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.mfa.ReleaseMFAChallenge(challenge.ID); err != nil {
+			return nil, err
+		}
+		if err := s.recordFailedLogin(user.Email, client.IP, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidMFACode
+	}
+
+	return s.completeLogin(user, client)
+}
+
+// mfaEnabled reports whether logins of the user need a second factor
+func (s *AuthService) mfaEnabled(userID string) (bool, error) {
+	secret, err := s.mfa.GetMFASecret(userID)
+	if err != nil {
+		return false, err
+	}
+	return secret != nil && secret.ConfirmedAt != nil, nil
+}
+
+func (s *AuthService) createMFAChallenge(userID string) (string, error) {
+	rawToken, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.mfa.CreateMFAChallenge(&models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(s.cfg.MFAChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return rawToken, nil
+}
+
+// requireSecondFactor checks a code of a user with MFA enabled. It is throttled like VerifyMFA, so
+// guessing codes here locks the account just as guessing them at login does.
+func (s *AuthService) requireSecondFactor(user *models.User, code string, client ClientInfo) error {
+	enabled, err := s.mfaEnabled(user.ID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrMFANotEnabled
+	}
+
+	now := time.Now()
+	if err := s.checkThrottle(user.Email, client.IP, now); err != nil {
+		return err
+	}
+
+	ok, err := s.checkSecondFactor(user.ID, code, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := s.recordFailedLogin(user.Email, client.IP, now); err != nil {
+			return err
+		}
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// checkSecondFactor accepts a TOTP code not used before, or consumes an unused recovery code
+func (s *AuthService) checkSecondFactor(userID, code string, now time.Time) (bool, error) {
+	secret, err := s.mfa.GetMFASecret(userID)
+	if err != nil {
+		return false, err
+	}
+	if secret == nil || secret.ConfirmedAt == nil {
+		return false, nil
+	}
+
+	if step, ok := totp.Validate(secret.Secret, code, now, 1); ok {
+		// A code seen once (e.g. by someone looking over a shoulder) must not work again
+		return s.mfa.UseTOTPStep(userID, step)
+	}
+
+	return s.mfa.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)))
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes like "k3x9q-7mzpa" along with the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode makes "K3X9Q-7MZPA" and "k3x9q 7mzpa" match the stored hash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
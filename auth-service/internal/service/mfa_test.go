@@ -0,0 +1,366 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/totp"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery"
+
+// enableMFA enrolls the user and returns the TOTP secret and the recovery codes.
+// The code used to confirm is spent, so tests use the next step's code (accepted through the skew).
+func enableMFA(t *testing.T, env *testEnv, user *models.User) (string, []string) {
+	t.Helper()
+
+	secret, _, err := env.svc.BeginMFAEnrollment(user.ID)
+	if err != nil {
+		t.Fatalf("BeginMFAEnrollment: %v", err)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("totp.Code: %v", err)
+	}
+	recoveryCodes, err := env.svc.ConfirmMFAEnrollment(user.ID, code)
+	if err != nil {
+		t.Fatalf("ConfirmMFAEnrollment: %v", err)
+	}
+	return secret, recoveryCodes
+}
+
+func nextTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Step(time.Now())+1)
+	if err != nil {
+		t.Fatalf("totp.Code: %v", err)
+	}
+	return code
+}
+
+func TestDisableMFA(t *testing.T) {
+	tests := []struct {
+		name        string
+		noMFA       bool
+		password    string
+		code        func(secret string, recoveryCodes []string) string
+		wantErr     error
+		wantFailure bool // Counted as a failed login
+	}{
+		{
+			name:     "password and TOTP code",
+			password: testPassword,
+			code:     func(secret string, _ []string) string { return nextTOTPCode(t, secret) },
+		},
+		{
+			name:     "password and recovery code",
+			password: testPassword,
+			code:     func(_ string, recoveryCodes []string) string { return recoveryCodes[0] },
+		},
+		{
+			name:        "wrong password",
+			password:    "not the password",
+			code:        func(secret string, _ []string) string { return nextTOTPCode(t, secret) },
+			wantErr:     ErrIncorrectPassword,
+			wantFailure: true,
+		},
+		{
+			name:        "wrong code",
+			password:    testPassword,
+			code:        func(string, []string) string { return "000000" },
+			wantErr:     ErrInvalidMFACode,
+			wantFailure: true,
+		},
+		{
+			name:     "code already used for enrollment",
+			password: testPassword,
+			code: func(secret string, _ []string) string {
+				code, _ := totp.Code(secret, totp.Step(time.Now()))
+				return code
+			},
+			wantErr:     ErrInvalidMFACode,
+			wantFailure: true,
+		},
+		{
+			name:     "MFA not enabled",
+			noMFA:    true,
+			password: testPassword,
+			code:     func(string, []string) string { return "123456" },
+			wantErr:  ErrMFANotEnabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, nil)
+			user := env.addUser(t, "jane@example.com", testPassword, true)
+
+			var secret string
+			var recoveryCodes []string
+			if !tt.noMFA {
+				secret, recoveryCodes = enableMFA(t, env, user)
+			}
+
+			err := env.svc.DisableMFA(user.ID, tt.password, tt.code(secret, recoveryCodes), ClientInfo{IP: "203.0.113.7"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DisableMFA error = %v, want %v", err, tt.wantErr)
+			}
+
+			enabled, _ := env.svc.mfaEnabled(user.ID)
+			if enabled != (tt.wantErr != nil && !tt.noMFA) {
+				t.Errorf("MFA enabled = %v after DisableMFA returned %v", enabled, err)
+			}
+
+			attempts, _ := env.attempts.GetAttempts(accountKey(user.Email))
+			if failed := attempts != nil && attempts.Failures > 0; failed != tt.wantFailure {
+				t.Errorf("failed login recorded = %v, want %v", failed, tt.wantFailure)
+			}
+		})
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	env := newTestEnv(t, nil)
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+	_, oldCodes := enableMFA(t, env, user)
+
+	newCodes, err := env.svc.RegenerateRecoveryCodes(user.ID, testPassword, oldCodes[0], ClientInfo{})
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if len(newCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(newCodes), recoveryCodeCount)
+	}
+
+	if _, err := env.svc.RegenerateRecoveryCodes(user.ID, testPassword, oldCodes[1], ClientInfo{}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("old recovery code: error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if err := env.svc.DisableMFA(user.ID, testPassword, newCodes[0], ClientInfo{}); err != nil {
+		t.Errorf("new recovery code rejected: %v", err)
+	}
+}
+
+// Guessing codes through MFA management must run into the same lockout as guessing them at login
+func TestMFAManagementIsThrottled(t *testing.T) {
+	env := newTestEnv(t, nil, func(cfg *Config) {
+		cfg.Lockout.BackoffAfter = 3
+		cfg.Lockout.BaseDelay = time.Minute
+	})
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+	secret, _ := enableMFA(t, env, user)
+
+	for i := 0; i < 3; i++ {
+		_, err := env.svc.RegenerateRecoveryCodes(user.ID, testPassword, "000000", ClientInfo{})
+		if !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: error = %v, want %v", i+1, err, ErrInvalidMFACode)
+		}
+	}
+
+	// Even the right code waits out the back-off
+	var throttled *ThrottleError
+	err := env.svc.DisableMFA(user.ID, testPassword, nextTOTPCode(t, secret), ClientInfo{})
+	if !errors.As(err, &throttled) {
+		t.Fatalf("error = %v, want a ThrottleError", err)
+	}
+	if enabled, _ := env.svc.mfaEnabled(user.ID); !enabled {
+		t.Error("MFA disabled while throttled")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"k3x9q-7mzpa", "k3x9q7mzpa"},
+		{"K3X9Q-7MZPA", "k3x9q7mzpa"},
+		{"k3x9q 7mzpa", "k3x9q7mzpa"},
+		{"k3x9q7mzpa", "k3x9q7mzpa"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not formatted like xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+
+		if hashToken(normalizeRecoveryCode(code)) != hashes[i] {
+			t.Errorf("hash of code %q does not match", code)
+		}
+	}
+}
+
+func TestVerifyMFA(t *testing.T) {
+	tests := []struct {
+		name string
+		// code returns the code to present, given the secret and recovery codes; it may use up codes first
+		code    func(t *testing.T, env *testEnv, user *models.User, secret string, recoveryCodes []string) string
+		wantErr error
+	}{
+		{
+			name: "TOTP code",
+			code: func(t *testing.T, env *testEnv, user *models.User, secret string, recoveryCodes []string) string {
+				return nextTOTPCode(t, secret)
+			},
+		},
+		{
+			name: "recovery code",
+			code: func(t *testing.T, env *testEnv, user *models.User, secret string, recoveryCodes []string) string {
+				return recoveryCodes[0]
+			},
+		},
+		{
+			name: "recovery code typed in capitals",
+			code: func(t *testing.T, env *testEnv, user *models.User, secret string, recoveryCodes []string) string {
+				return strings.ToUpper(recoveryCodes[0])
+			},
+		},
+		{
+			name: "replayed TOTP code",
+			code: func(t *testing.T, env *testEnv, user *models.User, secret string, recoveryCodes []string) string {
+				code := nextTOTPCode(t, secret)
+				login(t, env, user, code)
+				return code
+			},
+			wantErr: ErrInvalidMFACode,
+		},
+		{
+			name: "used recovery code",
+			code: func(t *testing.T, env *testEnv, user *models.User, secret string, recoveryCodes []string) string {
+				login(t, env, user, recoveryCodes[0])
+				return recoveryCodes[0]
+			},
+			wantErr: ErrInvalidMFACode,
+		},
+		{
+			name: "wrong code",
+			code: func(t *testing.T, env *testEnv, user *models.User, secret string, recoveryCodes []string) string {
+				return "000000"
+			},
+			wantErr: ErrInvalidMFACode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, nil)
+			user := env.addUser(t, "jane@example.com", testPassword, true)
+			secret, recoveryCodes := enableMFA(t, env, user)
+			code := tt.code(t, env, user, secret, recoveryCodes)
+
+			result, err := env.svc.Login(user.Email, testPassword, ClientInfo{})
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			if result.MFAToken == "" || result.Tokens != nil {
+				t.Fatalf("Login with MFA enabled returned %+v, want only a challenge", result)
+			}
+
+			result, err = env.svc.VerifyMFA(result.MFAToken, code, ClientInfo{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyMFA error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if _, err := env.svc.ValidateToken(result.Tokens.AccessToken); err != nil {
+					t.Errorf("access token rejected: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyMFAChallenge(t *testing.T) {
+	env := newTestEnv(t, nil, func(cfg *Config) { cfg.MFAMaxAttempts = 2 })
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+	_, recoveryCodes := enableMFA(t, env, user)
+
+	if _, err := env.svc.VerifyMFA("not-a-challenge", recoveryCodes[0], ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("unknown challenge: error = %v, want %v", err, ErrInvalidMFAChallenge)
+	}
+
+	// A challenge is good for one login
+	result, _ := env.svc.Login(user.Email, testPassword, ClientInfo{})
+	if _, err := env.svc.VerifyMFA(result.MFAToken, recoveryCodes[0], ClientInfo{}); err != nil {
+		t.Fatalf("VerifyMFA: %v", err)
+	}
+	if _, err := env.svc.VerifyMFA(result.MFAToken, recoveryCodes[1], ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("used challenge: error = %v, want %v", err, ErrInvalidMFAChallenge)
+	}
+
+	// And for MFAMaxAttempts guesses
+	result, _ = env.svc.Login(user.Email, testPassword, ClientInfo{})
+	for range 2 {
+		env.svc.VerifyMFA(result.MFAToken, "000000", ClientInfo{})
+	}
+	if _, err := env.svc.VerifyMFA(result.MFAToken, recoveryCodes[1], ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Errorf("challenge out of attempts: error = %v, want %v", err, ErrInvalidMFAChallenge)
+	}
+}
+
+// racingMFARepo still shows challenges as unused when a concurrent VerifyMFA has already claimed them
+type racingMFARepo struct {
+	*fakeMFARepo
+}
+
+func (r racingMFARepo) GetMFAChallengeByHash(tokenHash string) (*models.MFAChallenge, error) {
+	challenge, err := r.fakeMFARepo.GetMFAChallengeByHash(tokenHash)
+	if challenge != nil {
+		challenge.UsedAt = nil
+	}
+	return challenge, err
+}
+
+func TestVerifyMFALosingRaceSpendsNothing(t *testing.T) {
+	env := newTestEnv(t, nil)
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+	_, recoveryCodes := enableMFA(t, env, user)
+
+	result, _ := env.svc.Login(user.Email, testPassword, ClientInfo{})
+	if _, err := env.svc.VerifyMFA(result.MFAToken, recoveryCodes[0], ClientInfo{}); err != nil {
+		t.Fatalf("VerifyMFA: %v", err)
+	}
+
+	env.svc.mfa = racingMFARepo{env.mfa}
+	if _, err := env.svc.VerifyMFA(result.MFAToken, recoveryCodes[1], ClientInfo{}); !errors.Is(err, ErrInvalidMFAChallenge) {
+		t.Fatalf("losing VerifyMFA error = %v, want %v", err, ErrInvalidMFAChallenge)
+	}
+
+	env.svc.mfa = env.mfa
+	login(t, env, user, recoveryCodes[1])
+}
+
+// login passes both factors, spending code
+func login(t *testing.T, env *testEnv, user *models.User, code string) {
+	t.Helper()
+
+	result, err := env.svc.Login(user.Email, testPassword, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := env.svc.VerifyMFA(result.MFAToken, code, ClientInfo{}); err != nil {
+		t.Fatalf("VerifyMFA: %v", err)
+	}
+}
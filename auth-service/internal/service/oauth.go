@@ -0,0 +1,238 @@
+package service
+
+import (
+	"auth-service/internal/idp"
+	"auth-service/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+var (
+	ErrUnknownProvider      = errors.New("unknown identity provider")
+	ErrInvalidOAuthState    = errors.New("invalid or expired login attempt, please start again")
+	ErrOAuthExchangeFailed  = errors.New("the identity provider did not confirm the login")
+	ErrOAuthEmailMissing    = errors.New("the identity provider did not share an email address")
+	ErrOAuthEmailUnverified = errors.New("an account with this email already exists; log in with your password to link it")
+)
+
+// OAuthProviders returns the names of the configured identity providers
+func (s *AuthService) OAuthProviders() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartOAuthLogin returns the provider URL to send the browser to.
+// The state, PKCE verifier and nonce stay server-side until the provider redirects back.
+func (s *AuthService) StartOAuthLogin(ctx context.Context, providerName string) (string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	state, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := idp.NewPKCEVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.identities.CreateOAuthState(&models.OAuthState{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(s.cfg.OAuthStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return authURL, nil
+}
+
+// CompleteOAuthLogin handles the provider's redirect back: it redeems the code, finds or creates the
+// local user and logs them in (or returns an MFA challenge). LoginResult.Created is set for new accounts.
+func (s *AuthService) CompleteOAuthLogin(ctx context.Context, providerName, state, code string, client ClientInfo) (*LoginResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	if state == "" || code == "" {
+		return nil, ErrInvalidOAuthState
+	}
+
+	stored, err := s.identities.ConsumeOAuthState(hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.Provider != providerName || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidOAuthState
+	}
+
+	identity, err := provider.Exchange(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuthExchangeFailed, err)
+	}
+
+	user, created, err := s.resolveIdentity(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider replaces the password, not the second factor
+	enabled, err := s.mfaEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		mfaToken, err := s.createMFAChallenge(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
+	}
+
+	result, err := s.completeLogin(user, client)
+	if err != nil {
+		return nil, err
+	}
+	result.Created = created
+	return result, nil
+}
+
+// resolveIdentity maps a provider identity to a local user: an already linked user, an existing user
+// with the same email (only when the provider verified it), or a new user without a password.
+// An existing user who never verified their email is taken over (see takeOverUnverifiedAccount).
+func (s *AuthService) resolveIdentity(ctx context.Context, identity *idp.Identity) (*models.User, bool, error) {
+	linked, err := s.identities.GetIdentity(identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, false, err
+	}
+	if linked != nil {
+		user, err := s.repo.GetUserByID(linked.UserID)
+		if err != nil {
+			return nil, false, err
+		}
+		if user == nil {
+			return nil, false, errors.New("linked user not found")
+		}
+		return user, false, nil
+	}
+
+	if identity.Email == "" {
+		return nil, false, ErrOAuthEmailMissing
+	}
+
+	user, err := s.repo.GetUserByEmail(identity.Email)
+	if err != nil {
+		return nil, false, err
+	}
+
+	created := false
+	if user != nil {
+		// Linking on an unverified email would let anyone who can make a provider account
+		// with someone else's address take over that user's account
+		if !identity.EmailVerified {
+			return nil, false, ErrOAuthEmailUnverified
+		}
+		if !user.EmailVerified {
+			if err := s.takeOverUnverifiedAccount(user); err != nil {
+				return nil, false, err
+			}
+		}
+	} else {
+		user, err = s.createOAuthUser(ctx, identity)
+		if err != nil {
+			return nil, false, err
+		}
+		created = true
+	}
+
+	err = s.identities.LinkIdentity(&models.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		UserID:   user.ID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, created, nil
+}
+
+// takeOverUnverifiedAccount hands an account whose email was never verified to the identity that just
+// proved it owns the address. Whoever registered it may have been someone else pre-registering the
+// victim's email (account pre-hijacking), so everything they could still sign in with is removed:
+// the password, sessions, API keys, MFA and any pending reset, verification or email change links.
+// Credentials go first so that a retry after a failure still finds the account unverified.
+func (s *AuthService) takeOverUnverifiedAccount(user *models.User) error {
+	if err := s.RevokeAllSessions(user.ID); err != nil {
+		return err
+	}
+	if err := s.apiKeys.RevokeUserAPIKeys(user.ID); err != nil {
+		return err
+	}
+	if err := s.mfa.DeleteMFA(user.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := s.repo.TakeOverUnverifiedAccount(user.ID, now); err != nil {
+		return err
+	}
+	user.Password = ""
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+
+	log.Printf("Unverified account taken over by a verified identity provider login: user=%s", user.ID)
+	return nil
+}
+
+// createOAuthUser registers a user who signed up through a provider. The empty password hash never
+// matches, so password login stays impossible until the user sets one through a password reset.
+func (s *AuthService) createOAuthUser(ctx context.Context, identity *idp.Identity) (*models.User, error) {
+	name := identity.Name
+	if name == "" {
+		name = identity.Email
+	}
+
+	user := &models.User{
+		Email:         identity.Email,
+		Name:          name,
+		EmailVerified: identity.EmailVerified,
+	}
+	if identity.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := s.createUserWithProfile(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if !user.EmailVerified {
+		_ = s.sendVerificationEmail(user)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"auth-service/internal/idp"
+	"auth-service/internal/models"
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// stubProvider asserts whatever identity the test sets, after checking the PKCE verifier and nonce
+// belong to the login StartOAuthLogin began
+type stubProvider struct {
+	identity  idp.Identity
+	state     string
+	nonce     string
+	challenge string
+}
+
+func (p *stubProvider) Name() string { return p.identity.Provider }
+
+func (p *stubProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	p.state, p.nonce, p.challenge = state, nonce, codeChallenge
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p *stubProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*idp.Identity, error) {
+	if code != "good-code" || idp.PKCEChallenge(codeVerifier) != p.challenge || nonce != p.nonce {
+		return nil, errors.New("invalid_grant")
+	}
+	identity := p.identity
+	return &identity, nil
+}
+
+// oauthLogin runs a whole OAuth login through the service
+func oauthLogin(t *testing.T, env *testEnv, provider *stubProvider) (*LoginResult, error) {
+	t.Helper()
+
+	if _, err := env.svc.StartOAuthLogin(context.Background(), provider.Name()); err != nil {
+		t.Fatalf("StartOAuthLogin: %v", err)
+	}
+	return env.svc.CompleteOAuthLogin(context.Background(), provider.Name(), provider.state, "good-code", ClientInfo{IP: "203.0.113.7"})
+}
+
+func TestCompleteOAuthLoginResolvesIdentity(t *testing.T) {
+	tests := []struct {
+		name          string
+		existing      *models.User // Registered with a password before the OAuth login
+		identity      idp.Identity
+		wantErr       error
+		wantCreated   bool
+		wantLinked    bool // Logged into the existing user rather than a new one
+		wantTakenOver bool // The existing user's credentials were wiped
+	}{
+		{
+			name:        "new email signs up",
+			identity:    idp.Identity{Provider: "fake", Subject: "s-1", Email: "new@example.com", EmailVerified: true},
+			wantCreated: true,
+		},
+		{
+			name:       "verified account is linked",
+			existing:   &models.User{Email: "jane@example.com", EmailVerified: true},
+			identity:   idp.Identity{Provider: "fake", Subject: "s-1", Email: "jane@example.com", EmailVerified: true},
+			wantLinked: true,
+		},
+		{
+			name:       "email differing in case is the same account",
+			existing:   &models.User{Email: "Jane@Example.com", EmailVerified: true},
+			identity:   idp.Identity{Provider: "fake", Subject: "s-1", Email: "jane@example.com", EmailVerified: true},
+			wantLinked: true,
+		},
+		{
+			name:          "unverified account is taken over",
+			existing:      &models.User{Email: "jane@example.com"},
+			identity:      idp.Identity{Provider: "fake", Subject: "s-1", Email: "jane@example.com", EmailVerified: true},
+			wantLinked:    true,
+			wantTakenOver: true,
+		},
+		{
+			name:     "provider did not verify the email",
+			existing: &models.User{Email: "jane@example.com", EmailVerified: true},
+			identity: idp.Identity{Provider: "fake", Subject: "s-1", Email: "jane@example.com"},
+			wantErr:  ErrOAuthEmailUnverified,
+		},
+		{
+			name:     "provider shared no email",
+			identity: idp.Identity{Provider: "fake", Subject: "s-1", EmailVerified: true},
+			wantErr:  ErrOAuthEmailMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubProvider{identity: tt.identity}
+			env := newTestEnv(t, map[string]idp.Provider{"fake": provider})
+
+			var existing *models.User
+			var existingSession *LoginResult
+			if tt.existing != nil {
+				existing = env.addUser(t, tt.existing.Email, "correct horse battery", tt.existing.EmailVerified)
+				// Whoever registered the account is logged in and holds an API key
+				var err error
+				existingSession, err = env.svc.Login(tt.existing.Email, "correct horse battery", ClientInfo{})
+				if err != nil {
+					t.Fatalf("Login: %v", err)
+				}
+				env.apiKeys.CreateAPIKey(&models.APIKey{UserID: existing.ID, KeyHash: "key-hash", ExpiresAt: time.Now().Add(time.Hour)})
+			}
+
+			result, err := oauthLogin(t, env, provider)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CompleteOAuthLogin error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompleteOAuthLogin: %v", err)
+			}
+			if result.Tokens == nil {
+				t.Fatal("no tokens issued")
+			}
+			if result.Created != tt.wantCreated {
+				t.Errorf("Created = %v, want %v", result.Created, tt.wantCreated)
+			}
+			if tt.wantLinked && result.User.ID != existing.ID {
+				t.Errorf("logged into user %s, want the existing user %s", result.User.ID, existing.ID)
+			}
+			if len(env.users.users) != 1 {
+				t.Errorf("%d users stored, want 1", len(env.users.users))
+			}
+
+			linked, _ := env.identities.GetIdentity("fake", "s-1")
+			if linked == nil || linked.UserID != result.User.ID {
+				t.Errorf("identity linked to %+v, want user %s", linked, result.User.ID)
+			}
+
+			if existing == nil {
+				return
+			}
+			stored, _ := env.users.GetUserByID(existing.ID)
+			if !stored.EmailVerified {
+				t.Error("email not verified after the provider proved it")
+			}
+
+			_, oldSessionErr := env.svc.ValidateToken(existingSession.Tokens.AccessToken)
+			key, _ := env.apiKeys.GetAPIKeyByHash("key-hash")
+			if tt.wantTakenOver {
+				if stored.Password != "" {
+					t.Error("password of the taken over account still set")
+				}
+				if oldSessionErr == nil {
+					t.Error("access token issued before the takeover still valid")
+				}
+				if key.RevokedAt == nil {
+					t.Error("API key issued before the takeover not revoked")
+				}
+			} else {
+				if stored.Password == "" {
+					t.Error("password of a verified account was cleared")
+				}
+				if oldSessionErr != nil {
+					t.Errorf("existing session revoked: %v", oldSessionErr)
+				}
+				if key.RevokedAt != nil {
+					t.Error("API key of a verified account revoked")
+				}
+			}
+		})
+	}
+}
+
+// A registration still creating its profile must not be logged into from another path
+func TestCompleteOAuthLoginRefusesPendingUser(t *testing.T) {
+	provider := &stubProvider{identity: idp.Identity{Provider: "fake", Subject: "s-1", Email: "jane@example.com", EmailVerified: true}}
+	env := newTestEnv(t, map[string]idp.Provider{"fake": provider})
+
+	user := env.addUser(t, "jane@example.com", "correct horse battery", true)
+	if err := env.users.SetProfileStatus(user.ID, models.ProfileStatusPending); err != nil {
+		t.Fatalf("SetProfileStatus: %v", err)
+	}
+
+	result, err := oauthLogin(t, env, provider)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("CompleteOAuthLogin = %+v, %v; want %v", result, err, ErrInvalidCredentials)
+	}
+	if sessions, _ := env.sessions.ListActiveSessions(user.ID); len(sessions) != 0 {
+		t.Errorf("%d sessions started for a pending user", len(sessions))
+	}
+}
+
+func TestCompleteOAuthLoginState(t *testing.T) {
+	provider := &stubProvider{identity: idp.Identity{Provider: "fake", Subject: "s-1", Email: "jane@example.com", EmailVerified: true}}
+
+	t.Run("state is single-use", func(t *testing.T) {
+		env := newTestEnv(t, map[string]idp.Provider{"fake": provider})
+		if _, err := oauthLogin(t, env, provider); err != nil {
+			t.Fatalf("first login: %v", err)
+		}
+		_, err := env.svc.CompleteOAuthLogin(context.Background(), "fake", provider.state, "good-code", ClientInfo{})
+		if !errors.Is(err, ErrInvalidOAuthState) {
+			t.Fatalf("replayed state error = %v, want %v", err, ErrInvalidOAuthState)
+		}
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		env := newTestEnv(t, map[string]idp.Provider{"fake": provider})
+		_, err := env.svc.CompleteOAuthLogin(context.Background(), "fake", "made-up", "good-code", ClientInfo{})
+		if !errors.Is(err, ErrInvalidOAuthState) {
+			t.Fatalf("error = %v, want %v", err, ErrInvalidOAuthState)
+		}
+	})
+
+	t.Run("expired state", func(t *testing.T) {
+		env := newTestEnv(t, map[string]idp.Provider{"fake": provider}, func(cfg *Config) { cfg.OAuthStateTTL = -time.Second })
+		_, err := oauthLogin(t, env, provider)
+		if !errors.Is(err, ErrInvalidOAuthState) {
+			t.Fatalf("error = %v, want %v", err, ErrInvalidOAuthState)
+		}
+	})
+
+	t.Run("state of another provider", func(t *testing.T) {
+		other := &stubProvider{identity: idp.Identity{Provider: "other"}}
+		env := newTestEnv(t, map[string]idp.Provider{"fake": provider, "other": other})
+		if _, err := env.svc.StartOAuthLogin(context.Background(), "other"); err != nil {
+			t.Fatalf("StartOAuthLogin: %v", err)
+		}
+		_, err := env.svc.CompleteOAuthLogin(context.Background(), "fake", other.state, "good-code", ClientInfo{})
+		if !errors.Is(err, ErrInvalidOAuthState) {
+			t.Fatalf("error = %v, want %v", err, ErrInvalidOAuthState)
+		}
+	})
+
+	t.Run("code the provider rejects", func(t *testing.T) {
+		env := newTestEnv(t, map[string]idp.Provider{"fake": provider})
+		if _, err := env.svc.StartOAuthLogin(context.Background(), "fake"); err != nil {
+			t.Fatalf("StartOAuthLogin: %v", err)
+		}
+		_, err := env.svc.CompleteOAuthLogin(context.Background(), "fake", provider.state, "bad-code", ClientInfo{})
+		if !errors.Is(err, ErrOAuthExchangeFailed) {
+			t.Fatalf("error = %v, want %v", err, ErrOAuthExchangeFailed)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"auth-service/internal/mail"
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// RequestPasswordReset emails a single-use reset link to the user.
+// It succeeds silently for unknown emails so the endpoint cannot be used to discover accounts.
+func (s *AuthService) RequestPasswordReset(email string) error {
+	if email == "" {
+		return errors.New("email is required")
+	}
+
+	user, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.DeletedAt != nil {
+		log.Printf("Password reset requested for unknown email")
+		return nil
+	}
+
+	rawToken, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.CreatePasswordResetToken(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(s.cfg.PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Name, s.cfg.PasswordResetTTL, fmt.Sprintf(s.cfg.PasswordResetURL, rawToken),
+		),
+	})
+}
+
+// ResetPassword sets a new password using a reset token, then signs the user out everywhere
+func (s *AuthService) ResetPassword(rawToken, newPassword string) error {
+	if rawToken == "" {
+		return ErrInvalidResetToken
+	}
+
+	token, err := s.repo.GetPasswordResetTokenByHash(hashToken(rawToken))
+	if err != nil {
+		return err
+	}
+	if token == nil || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.repo.GetUserByID(token.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidResetToken
+	}
+
+	invalid := &ValidationError{}
+	invalid.addPasswordViolations(s.cfg.PasswordPolicy, "new_password", newPassword, user.Email, user.Name)
+	if err := invalid.err(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.cfg.PasswordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.ResetPassword(token.ID, token.UserID, hashedPassword)
+	if errors.Is(err, repository.ErrResetTokenUsed) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	// Whoever knew the old password must not keep a session
+	return s.RevokeAllSessions(token.UserID)
+}
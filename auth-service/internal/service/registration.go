@@ -0,0 +1,194 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrProfileCreationFailed is returned when a new user's profile could not be created in user-service.
+// The registration is rolled back, so the same email can be registered again.
+var ErrProfileCreationFailed = errors.New("could not create the user profile, please try again")
+
+// ErrEmailRegistered is returned when an account with the email exists already, in any case
+var ErrEmailRegistered = errors.New("email already registered")
+
+// compensationTimeout bounds the clean-up after a failed registration, which must run even if
+// the caller has given up on the request
+const compensationTimeout = 10 * time.Second
+
+// reconcilePageSize is how many users are compared with user-service at a time
+const reconcilePageSize = 500
+
+// createUserWithProfile is the registration saga: the user is stored as pending, its profile is
+// created in user-service, then the user is activated. If any step fails the steps before it are
+// undone; whatever the undo itself cannot remove is left pending for ReconcileProfiles.
+func (s *AuthService) createUserWithProfile(ctx context.Context, user *models.User) error {
+	user.ProfileStatus = models.ProfileStatusPending
+	if err := s.repo.CreateUser(user); err != nil {
+		return err
+	}
+
+	err := s.repo.AssignRole(user.ID, DefaultRole)
+	if err == nil {
+		err = s.profiles.CreateProfile(ctx, user.ID, user.Email, user.Name)
+		if err != nil {
+			err = fmt.Errorf("%w: %v", ErrProfileCreationFailed, err)
+		}
+	}
+	if err == nil {
+		err = s.repo.SetProfileStatus(user.ID, models.ProfileStatusActive)
+	}
+	if err != nil {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), compensationTimeout)
+		defer cancel()
+
+		if undoErr := s.abandonRegistration(cleanupCtx, user.ID); undoErr != nil {
+			log.Printf("Failed to roll back registration, left for reconciliation: user=%s err=%v", user.ID, undoErr)
+		}
+		return err
+	}
+
+	user.ProfileStatus = models.ProfileStatusActive
+	return nil
+}
+
+// abandonRegistration removes a user whose registration did not complete, in both services.
+// The profile goes first: a leftover pending user is found again by ReconcileProfiles, a leftover
+// profile without its user would only be found by a full scan.
+func (s *AuthService) abandonRegistration(ctx context.Context, userID string) error {
+	if err := s.profiles.DeleteProfile(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.DeleteUser(userID)
+}
+
+// ReconcileReport counts what one ReconcileProfiles pass repaired
+type ReconcileReport struct {
+	AbandonedRegistrations int // Pending users older than the grace period, removed with their profile
+	ProfilesCreated        int // Active users that had no profile
+	OrphanProfilesDeleted  int // Profiles whose user no longer exists here
+}
+
+// ReconcileProfiles walks the users of both services side by side (both sorted by ID) and repairs
+// what failed registrations and crashes left behind:
+//   - pending users older than RegistrationGracePeriod are rolled back, profile included
+//   - active users without a profile get one (CreateProfile is idempotent), unless they were deleted
+//   - profiles without a user here are deleted
+func (s *AuthService) ReconcileProfiles(ctx context.Context) (ReconcileReport, error) {
+	var report ReconcileReport
+	abandonBefore := time.Now().Add(-s.cfg.RegistrationGracePeriod)
+
+	var users []models.User
+	var profileIDs []string
+	usersDone, profilesDone := false, false
+	afterUser, afterProfile := "", ""
+
+	for {
+		if len(users) == 0 && !usersDone {
+			page, err := s.repo.ListUsers(afterUser, reconcilePageSize)
+			if err != nil {
+				return report, err
+			}
+			users, usersDone = page, len(page) < reconcilePageSize
+			if len(page) > 0 {
+				afterUser = page[len(page)-1].ID
+			}
+		}
+		if len(profileIDs) == 0 && !profilesDone {
+			page, err := s.profiles.ListProfileIDs(ctx, afterProfile, reconcilePageSize)
+			if err != nil {
+				return report, err
+			}
+			profileIDs, profilesDone = page, len(page) < reconcilePageSize
+			if len(page) > 0 {
+				afterProfile = page[len(page)-1]
+			}
+		}
+		if len(users) == 0 && len(profileIDs) == 0 {
+			return report, nil
+		}
+
+		switch {
+		case len(profileIDs) == 0 || (len(users) > 0 && users[0].ID < profileIDs[0]):
+			// User without a profile
+			user := users[0]
+			users = users[1:]
+
+			if user.ProfileStatus == models.ProfileStatusPending {
+				if user.CreatedAt.Before(abandonBefore) {
+					if err := s.abandonRegistration(ctx, user.ID); err != nil {
+						return report, err
+					}
+					report.AbandonedRegistrations++
+				}
+				continue
+			}
+			// A deleted account whose profile is already purged is about to be purged itself
+			if user.DeletedAt != nil {
+				continue
+			}
+
+			if err := s.profiles.CreateProfile(ctx, user.ID, user.Email, user.Name); err != nil {
+				return report, err
+			}
+			report.ProfilesCreated++
+
+		case len(users) == 0 || profileIDs[0] < users[0].ID:
+			// Profile without a user; the user may have been created since its page was read
+			id := profileIDs[0]
+			profileIDs = profileIDs[1:]
+
+			user, err := s.repo.GetUserByID(id)
+			if err != nil {
+				return report, err
+			}
+			if user != nil {
+				continue
+			}
+
+			if err := s.profiles.DeleteProfile(ctx, id); err != nil {
+				return report, err
+			}
+			report.OrphanProfilesDeleted++
+
+		default:
+			// Both exist; a pending user here crashed before activation and never heard back
+			user := users[0]
+			users, profileIDs = users[1:], profileIDs[1:]
+
+			if user.ProfileStatus == models.ProfileStatusPending && user.CreatedAt.Before(abandonBefore) {
+				if err := s.abandonRegistration(ctx, user.ID); err != nil {
+					return report, err
+				}
+				report.AbandonedRegistrations++
+			}
+		}
+	}
+}
+
+// RunProfileReconciliation calls ReconcileProfiles every interval until ctx is cancelled
+func (s *AuthService) RunProfileReconciliation(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.ReconcileProfiles(ctx)
+			if err != nil {
+				log.Printf("Failed to reconcile user profiles: %v", err)
+				continue
+			}
+			if report != (ReconcileReport{}) {
+				log.Printf("Reconciled user profiles: abandoned=%d created=%d orphans_deleted=%d",
+					report.AbandonedRegistrations, report.ProfilesCreated, report.OrphanProfilesDeleted)
+			}
+		}
+	}
+}
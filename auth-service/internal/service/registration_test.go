@@ -0,0 +1,47 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+// racingUserRepo does not see users registered by a concurrent request that has not committed yet
+type racingUserRepo struct {
+	*fakeUserRepo
+}
+
+func (racingUserRepo) GetUserByEmail(email string) (*models.User, error) {
+	return nil, nil
+}
+
+func TestRegisterEmailTakenInAnyCase(t *testing.T) {
+	tests := []struct {
+		name   string
+		racing bool // The other registration is not visible to the pre-check
+	}{
+		{name: "registered before"},
+		{name: "registered concurrently", racing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, nil)
+			if _, err := env.svc.Register(context.Background(), "Alice@Example.com", "Correct-Horse-9", "Alice"); err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			if tt.racing {
+				env.svc.repo = racingUserRepo{env.users}
+			}
+
+			_, err := env.svc.Register(context.Background(), "alice@example.com", "Correct-Horse-9", "Alice")
+			if !errors.Is(err, ErrEmailRegistered) {
+				t.Errorf("Register error = %v, want %v", err, ErrEmailRegistered)
+			}
+			if len(env.users.users) != 1 {
+				t.Errorf("%d users stored, want 1", len(env.users.users))
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// ClientInfo describes the device a request comes from, as forwarded by the gateway
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *AuthService) ListSessions(userID string) ([]models.Session, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	return s.sessions.ListActiveSessions(userID)
+}
+
+// RevokeSession signs one device out: its refresh tokens stop working and its access tokens are revoked
+func (s *AuthService) RevokeSession(userID, sessionID string) error {
+	session, err := s.sessions.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	// Never let one user end another user's session
+	if session == nil || session.UserID != userID || session.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+
+	return s.revokeSession(sessionID)
+}
+
+// startSession records a new login; the session ID becomes the refresh token family
+func (s *AuthService) startSession(userID string, client ClientInfo) (string, error) {
+	session := &models.Session{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IP,
+		ExpiresAt: time.Now().Add(s.cfg.RefreshTokenTTL),
+	}
+
+	if err := s.sessions.CreateSession(session); err != nil {
+		return "", err
+	}
+
+	return session.ID, nil
+}
+
+// revokeSession ends a session everywhere. Access tokens carry the session ID as their sid claim,
+// so it goes on the revocation list until the last access token of the session has expired.
+func (s *AuthService) revokeSession(sessionID string) error {
+	if err := s.refreshTokens.RevokeTokenFamily(sessionID); err != nil {
+		return err
+	}
+
+	if err := s.sessions.RevokeSession(sessionID); err != nil {
+		return err
+	}
+
+	return s.revocations.RevokeToken(sessionID, time.Now().Add(s.cfg.AccessTokenTTL))
+}
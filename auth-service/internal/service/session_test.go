@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRevokeAllSessions(t *testing.T) {
+	env := newTestEnv(t, nil)
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+
+	before, err := env.svc.Login(user.Email, testPassword, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := env.svc.RevokeAllSessions(user.ID); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	// Logging in again right away lands in the same second as the cutoff
+	after, err := env.svc.Login(user.Email, testPassword, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	if _, err := env.svc.ValidateToken(before.Tokens.AccessToken); err == nil {
+		t.Error("access token issued before RevokeAllSessions still valid")
+	}
+	if _, err := env.svc.RefreshToken(before.Tokens.RefreshToken, ClientInfo{}); err == nil {
+		t.Error("refresh token issued before RevokeAllSessions still works")
+	}
+	if _, err := env.svc.ValidateToken(after.Tokens.AccessToken); err != nil {
+		t.Errorf("access token issued after RevokeAllSessions rejected: %v", err)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	env := newTestEnv(t, nil)
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+	other := env.addUser(t, "john@example.com", testPassword, true)
+
+	phone, _ := env.svc.Login(user.Email, testPassword, ClientInfo{UserAgent: "phone"})
+	laptop, _ := env.svc.Login(user.Email, testPassword, ClientInfo{UserAgent: "laptop"})
+	claims, err := env.svc.ValidateToken(phone.Tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+
+	if err := env.svc.RevokeSession(other.ID, claims.SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking another user's session: error = %v, want %v", err, ErrSessionNotFound)
+	}
+	if err := env.svc.RevokeSession(user.ID, claims.SessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if err := env.svc.RevokeSession(user.ID, claims.SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking twice: error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if _, err := env.svc.ValidateToken(phone.Tokens.AccessToken); err == nil {
+		t.Error("access token of the revoked session still valid")
+	}
+	if _, err := env.svc.ValidateToken(laptop.Tokens.AccessToken); err != nil {
+		t.Errorf("access token of the other session rejected: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"auth-service/internal/keys"
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrInvalidAccessToken  = errors.New("invalid access token")
+)
+
+func init() {
+	// iat carries microseconds so that a token issued right after "revoke all sessions" (e.g. the
+	// login that follows it) is not caught by the cutoff just because both fall in the same second.
+	// RFC 7519 allows fractional NumericDates; verifiers that keep whole seconds just truncate them.
+	jwt.TimePrecision = time.Microsecond
+}
+
+// AccessClaims are the claims carried by every access token.
+// RegisteredClaims.ID holds the jti used for revocation.
+type AccessClaims struct {
+	UserID        string   `json:"user_id"`
+	Roles         []string `json:"roles"`
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+	SessionID     string   `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is what a client receives after logging in or refreshing
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration // Lifetime of AccessToken
+}
+
+// RefreshToken exchanges a refresh token for a new token pair.
+// The presented token is rotated: it becomes unusable and a new one is returned.
+// Presenting a token that was already rotated means it leaked, so the whole family is revoked.
+func (s *AuthService) RefreshToken(rawToken string, client ClientInfo) (*TokenPair, error) {
+	if rawToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	stored, err := s.refreshTokens.GetRefreshTokenByHash(hashToken(rawToken))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.RevokedAt != nil {
+		// A rotated token coming back means someone kept a copy of it
+		if stored.ReplacedBy != "" {
+			return nil, s.revokeReusedFamily(stored)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	pair, next, err := s.newTokenPair(stored.UserID, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.refreshTokens.RotateRefreshToken(stored.ID, next)
+	if errors.Is(err, repository.ErrRefreshTokenRotated) {
+		// Lost a race against another refresh with the same token
+		return nil, s.revokeReusedFamily(stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The family ID is the session ID
+	if err := s.sessions.TouchSession(stored.FamilyID, client.IP, client.UserAgent, time.Now(), next.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+func (s *AuthService) revokeReusedFamily(token *models.RefreshToken) error {
+	log.Printf("⚠️ Refresh token reuse detected: user=%s family=%s", token.UserID, token.FamilyID)
+
+	if err := s.revokeSession(token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issueTokenPair signs an access token and persists a fresh refresh token for a session
+func (s *AuthService) issueTokenPair(userID, familyID string) (*TokenPair, error) {
+	pair, refresh, err := s.newTokenPair(userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.refreshTokens.CreateRefreshToken(refresh); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// newTokenPair builds a token pair without persisting the refresh token
+func (s *AuthService) newTokenPair(userID, familyID string) (*TokenPair, *models.RefreshToken, error) {
+	accessToken, err := s.signAccessToken(userID, familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawRefresh, err := generateOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(rawRefresh),
+		ExpiresAt: time.Now().Add(s.cfg.RefreshTokenTTL),
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+		ExpiresIn:    s.cfg.AccessTokenTTL,
+	}, refresh, nil
+}
+
+// signAccessToken mints an access token carrying the user's current roles, permissions and verification status.
+// They are re-read on every refresh, so changes take effect within one access token lifetime.
+func (s *AuthService) signAccessToken(userID, sessionID string) (string, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errors.New("user not found")
+	}
+
+	roles, err := s.repo.GetUserRoles(userID)
+	if err != nil {
+		return "", err
+	}
+
+	permissions, err := s.repo.GetRolePermissions(roles)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := AccessClaims{
+		UserID:        userID,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: user.EmailVerified,
+		SessionID:     sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.cfg.Issuer,
+			Audience:  jwt.ClaimStrings{s.cfg.Audience},
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL)),
+		},
+	}
+
+	key := s.keyring.SigningKey()
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// PublicKeys returns the keys that verify tokens issued by this service, in JWK format
+func (s *AuthService) PublicKeys() []keys.JWK {
+	return s.keyring.JWKS()
+}
+
+// parseAccessToken verifies the signature and expiry of an access token.
+// It does not consult the revocation store; use ValidateToken for that.
+func (s *AuthService) parseAccessToken(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.verificationKey,
+		jwt.WithValidMethods([]string{keys.AlgRS256, keys.AlgEdDSA}),
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithAudience(s.cfg.Audience),
+		jwt.WithIssuedAt(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+
+	// Tokens minted before jti/iat existed cannot be revoked, so they are rejected outright
+	if claims.UserID == "" || claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return nil, errors.New("Invalid token claims")
+	}
+
+	return claims, nil
+}
+
+// verificationKey picks the public key named by the token's kid header
+func (s *AuthService) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, err := s.keyring.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	// A key only verifies tokens signed with its own algorithm
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("token algorithm does not match signing key")
+	}
+
+	return key.Public(), nil
+}
+
+// generateOpaqueToken returns 32 random bytes encoded as URL-safe base64
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token; this is what gets stored in the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
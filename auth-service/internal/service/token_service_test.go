@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		// present returns the refresh token to exchange, given the one Login returned
+		present func(t *testing.T, env *testEnv, login *LoginResult) string
+		wantErr error
+		// Whether the session survives: its access token still validates afterwards
+		wantSessionAlive bool
+	}{
+		{
+			name:             "fresh token rotates",
+			present:          func(t *testing.T, env *testEnv, login *LoginResult) string { return login.Tokens.RefreshToken },
+			wantSessionAlive: true,
+		},
+		{
+			name: "rotated token comes back",
+			present: func(t *testing.T, env *testEnv, login *LoginResult) string {
+				if _, err := env.svc.RefreshToken(login.Tokens.RefreshToken, ClientInfo{}); err != nil {
+					t.Fatalf("first RefreshToken: %v", err)
+				}
+				return login.Tokens.RefreshToken
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "token of a logged out session",
+			present: func(t *testing.T, env *testEnv, login *LoginResult) string {
+				if err := env.svc.Logout(login.Tokens.AccessToken, login.Tokens.RefreshToken); err != nil {
+					t.Fatalf("Logout: %v", err)
+				}
+				return login.Tokens.RefreshToken
+			},
+			wantErr: ErrInvalidRefreshToken,
+		},
+		{
+			name:      "expired token",
+			configure: func(cfg *Config) { cfg.RefreshTokenTTL = -time.Second },
+			present:   func(t *testing.T, env *testEnv, login *LoginResult) string { return login.Tokens.RefreshToken },
+			wantErr:   ErrInvalidRefreshToken,
+			// Nothing was revoked; the token simply ran out
+			wantSessionAlive: true,
+		},
+		{
+			name:             "unknown token",
+			present:          func(t *testing.T, env *testEnv, login *LoginResult) string { return "not-a-refresh-token" },
+			wantErr:          ErrInvalidRefreshToken,
+			wantSessionAlive: true,
+		},
+		{
+			name:             "no token",
+			present:          func(t *testing.T, env *testEnv, login *LoginResult) string { return "" },
+			wantErr:          ErrInvalidRefreshToken,
+			wantSessionAlive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configure []func(*Config)
+			if tt.configure != nil {
+				configure = append(configure, tt.configure)
+			}
+			env := newTestEnv(t, nil, configure...)
+			user := env.addUser(t, "jane@example.com", testPassword, true)
+
+			login, err := env.svc.Login(user.Email, testPassword, ClientInfo{})
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+
+			pair, err := env.svc.RefreshToken(tt.present(t, env, login), ClientInfo{IP: "203.0.113.7"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RefreshToken error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil {
+				if pair.RefreshToken == login.Tokens.RefreshToken {
+					t.Error("refresh token was not rotated")
+				}
+				if _, err := env.svc.ValidateToken(pair.AccessToken); err != nil {
+					t.Errorf("new access token rejected: %v", err)
+				}
+				if _, err := env.svc.RefreshToken(pair.RefreshToken, ClientInfo{}); err != nil {
+					t.Errorf("new refresh token rejected: %v", err)
+				}
+			}
+
+			_, err = env.svc.ValidateToken(login.Tokens.AccessToken)
+			if alive := err == nil; alive != tt.wantSessionAlive {
+				t.Errorf("session alive = %v, want %v (ValidateToken: %v)", alive, tt.wantSessionAlive, err)
+			}
+		})
+	}
+}
+
+// Reuse of an old token must also end the token that legitimately replaced it
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	env := newTestEnv(t, nil)
+	user := env.addUser(t, "jane@example.com", testPassword, true)
+
+	login, err := env.svc.Login(user.Email, testPassword, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	other, err := env.svc.Login(user.Email, testPassword, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	rotated, err := env.svc.RefreshToken(login.Tokens.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// An attacker replays the stolen original
+	if _, err := env.svc.RefreshToken(login.Tokens.RefreshToken, ClientInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	if _, err := env.svc.RefreshToken(rotated.RefreshToken, ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("replacement token after reuse: error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, err := env.svc.ValidateToken(rotated.AccessToken); err == nil {
+		t.Error("access token of the compromised session still valid")
+	}
+
+	// Only the compromised session ends
+	if _, err := env.svc.RefreshToken(other.Tokens.RefreshToken, ClientInfo{}); err != nil {
+		t.Errorf("refresh token of another session rejected: %v", err)
+	}
+}
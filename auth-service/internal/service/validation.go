@@ -0,0 +1,45 @@
+package service
+
+import (
+	"auth-service/internal/password"
+	"strings"
+)
+
+// FieldError is a problem with one field of a request
+type FieldError struct {
+	Field   string // Request field, e.g. "password" or "new_password"
+	Code    string // Machine-readable reason, e.g. "too_short"
+	Message string
+}
+
+// ValidationError lists every invalid field of a request so clients can show them all at once
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// addPasswordViolations checks a new password against the configured policy
+func (e *ValidationError) addPasswordViolations(policy password.Policy, field, pw, email, name string) {
+	for _, v := range policy.Check(pw, email, name) {
+		e.add(field, v.Code, v.Message)
+	}
+}
+
+// err returns the ValidationError, or nil if no field was invalid
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,132 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed of RFC 6238 appendix B, "12345678901234567890", base32-encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B lists 8-digit codes; 6-digit codes are their last six digits
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseSecret(t *testing.T) {
+	upper, _ := Code(rfcSecret, 1)
+	lower, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+	if err != nil || lower != upper {
+		t.Errorf("Code with lowercase secret = %q, %v; want %q", lower, err, upper)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: rfcSecret, code: code(step), skew: 1, wantStep: step, wantOK: true},
+		{name: "with a space", secret: rfcSecret, code: code(step)[:3] + " " + code(step)[3:], skew: 1, wantStep: step, wantOK: true},
+		{name: "previous step within skew", secret: rfcSecret, code: code(step - 1), skew: 1, wantStep: step - 1, wantOK: true},
+		{name: "next step within skew", secret: rfcSecret, code: code(step + 1), skew: 1, wantStep: step + 1, wantOK: true},
+		{name: "previous step without skew", secret: rfcSecret, code: code(step - 1), skew: 0},
+		{name: "outside skew", secret: rfcSecret, code: code(step - 2), skew: 1},
+		{name: "wrong code", secret: rfcSecret, code: "000000", skew: 1},
+		{name: "too short", secret: rfcSecret, code: code(step)[:5], skew: 1},
+		{name: "too long", secret: rfcSecret, code: code(step) + "0", skew: 1},
+		{name: "invalid secret", secret: "not base32!", code: code(step), skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := Validate(tt.secret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate = %d, %v; want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Error("two secrets are equal")
+	}
+
+	key, err := encoding.DecodeString(a)
+	if err != nil || len(key) != secretSize {
+		t.Errorf("secret %q decodes to %d bytes, %v; want %d", a, len(key), err, secretSize)
+	}
+	if _, err := Code(a, 0); err != nil {
+		t.Errorf("Code with a generated secret: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	raw := URI("Acme Corp", "jane@example.com", rfcSecret)
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("URI %q is not an otpauth://totp/ URI", raw)
+	}
+	if u.Path != "/Acme Corp:jane@example.com" {
+		t.Errorf("label = %q, want %q", u.Path, "/Acme Corp:jane@example.com")
+	}
+
+	want := map[string]string{
+		"secret":    rfcSecret,
+		"issuer":    "Acme Corp",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	q := u.Query()
+	for key, value := range want {
+		if got := q.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
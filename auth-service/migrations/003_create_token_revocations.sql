@@ -0,0 +1,15 @@
+-- Revoked access tokens, keyed by their jti claim.
+-- Rows can be purged once expires_at has passed since the JWT itself is no longer valid.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(255) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+-- Per-user cutoff: every access token issued before revoked_before is rejected
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id VARCHAR(255) PRIMARY KEY,
+    revoked_before TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,33 @@
+-- Roles and the permissions they grant.
+-- Permissions follow the "<resource>:<action>:<scope>" convention, e.g. users:read:any
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(50) NOT NULL,
+    permission VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+-- Roles granted to each user
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id VARCHAR(255) NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('customer', 'users:read:self'),
+    ('customer', 'users:write:self'),
+    ('support', 'users:read:self'),
+    ('support', 'users:write:self'),
+    ('support', 'users:read:any'),
+    ('admin', 'users:read:self'),
+    ('admin', 'users:write:self'),
+    ('admin', 'users:read:any'),
+    ('admin', 'users:write:any')
+ON CONFLICT DO NOTHING;
+
+-- Existing accounts become customers
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'customer' FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,9 @@
+-- JWT signing keys, identified by the kid header of each token.
+-- The newest key signs; every key whose expires_at is in the future is still accepted for verification.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,  -- RS256 or EdDSA
+    private_key TEXT NOT NULL,       -- PKCS#8 PEM
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
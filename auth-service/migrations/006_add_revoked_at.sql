@@ -0,0 +1,5 @@
+-- Lets services that verify tokens locally pull only the revocations made since their last sync
+ALTER TABLE revoked_tokens ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_revoked_at ON revoked_tokens(revoked_at);
+CREATE INDEX IF NOT EXISTS idx_user_token_revocations_revoked_before ON user_token_revocations(revoked_before);
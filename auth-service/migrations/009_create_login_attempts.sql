@@ -0,0 +1,9 @@
+-- Failed login tracking for brute-force protection.
+-- key is "account:<email>" or "ip:<address>" so both are throttled independently.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    first_failure_at TIMESTAMP NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP  -- Back-off or lockout; attempts are refused until then
+);
@@ -0,0 +1,24 @@
+-- External identities (e.g. a Google account) linked to a local user
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL, -- The user's stable ID at the provider
+    user_id VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '', -- Email asserted by the provider when the identity was linked
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- In-flight OAuth logins; the state parameter is only stored as a hash and is single-use
+CREATE TABLE IF NOT EXISTS oauth_states (
+    id VARCHAR(255) PRIMARY KEY,
+    state_hash VARCHAR(64) UNIQUE NOT NULL,
+    provider VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL, -- PKCE verifier, sent with the code exchange
+    nonce VARCHAR(64) NOT NULL, -- Must come back in the ID token
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
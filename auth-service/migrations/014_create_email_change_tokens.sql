@@ -0,0 +1,14 @@
+-- Pending email changes: the link is sent to the new address (only the SHA-256 hash is stored)
+CREATE TABLE IF NOT EXISTS email_change_tokens (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    session_id VARCHAR(255) NOT NULL DEFAULT '', -- Session that asked for the change; it stays signed in
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_email_change_tokens_user_id ON email_change_tokens(user_id);
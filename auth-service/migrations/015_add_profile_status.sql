@@ -0,0 +1,5 @@
+-- Registration creates the user "pending" and marks it "active" once its user-service profile exists.
+-- Pending users cannot log in; the reconciliation job removes the ones left behind by failed registrations.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_status VARCHAR(20) NOT NULL DEFAULT 'active';
+
+CREATE INDEX IF NOT EXISTS idx_users_pending ON users(created_at) WHERE profile_status = 'pending';
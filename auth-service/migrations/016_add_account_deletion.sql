@@ -0,0 +1,5 @@
+-- A deleted account cannot log in; it can be restored until the grace period ends, then it is purged
+-- together with its user-service profile.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,17 @@
+-- Data exports answer data-subject access requests: a zip with everything both services store about
+-- a user. They are built in the background and deleted once they expire.
+CREATE TABLE IF NOT EXISTS data_exports (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending', -- pending, running, ready or failed
+    error TEXT NOT NULL DEFAULT '',
+    archive BYTEA, -- Set once the export is ready
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    claimed_at TIMESTAMP, -- When a worker started building it; a stale claim is picked up again
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id, created_at DESC);
+CREATE INDEX idx_data_exports_queue ON data_exports(created_at) WHERE status IN ('pending', 'running');
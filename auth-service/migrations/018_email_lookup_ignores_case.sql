@@ -0,0 +1,15 @@
+-- Users are looked up by lower(email) so that Alice@Example.com and alice@example.com are the same account,
+-- and only one account may hold an address in any case.
+--
+-- Accounts differing only in case are resolved first: the oldest keeps the address, as it is the one
+-- logins have always found. The others could not be reached by email anyway; they get a placeholder
+-- address marked unverified, which support can sort out with their owners.
+UPDATE users u
+SET email = 'duplicate-' || u.id || '+' || u.email, email_verified = FALSE
+WHERE EXISTS (
+    SELECT 1 FROM users o
+    WHERE lower(o.email) = lower(u.email) AND (o.created_at, o.id) < (u.created_at, u.id)
+);
+
+DROP INDEX IF EXISTS idx_users_lower_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_lower_email_unique ON users(lower(email));
@@ -123,6 +123,37 @@ test_auth_register() {
     fi
 }
 
+test_auth_weak_password() {
+    print_test_header "Authentication - Password Policy"
+
+    response=$(curl -s -w "\n%{http_code}" -X POST "$API_URL/api/v1/auth/register" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"weak-$(date +%s)@example.com\",\"password\":\"a\",\"name\":\"Weak User\"}")
+
+    http_code=$(echo "$response" | tail -n 1)
+    body=$(echo "$response" | sed '$d')
+
+    if [ "$http_code" = "400" ] && [ "$(echo "$body" | jq -r '.fields[0].field // empty')" = "password" ]; then
+        pass "Weak password returns 400 with field errors"
+    else
+        fail "Weak password accepted" "Expected 400 with fields, got $http_code. Body: $body"
+    fi
+
+    # The API tests load a sample breached password list (auth-service/data)
+    response=$(curl -s -w "\n%{http_code}" -X POST "$API_URL/api/v1/auth/register" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"breached-$(date +%s)@example.com\",\"password\":\"P@ssw0rd\",\"name\":\"Breached User\"}")
+
+    http_code=$(echo "$response" | tail -n 1)
+    body=$(echo "$response" | sed '$d')
+
+    if [ "$http_code" = "400" ] && echo "$body" | jq -e '.fields[] | select(.code == "breached")' > /dev/null; then
+        pass "Breached password is rejected"
+    else
+        fail "Breached password accepted" "Expected 400 with code breached, got $http_code. Body: $body"
+    fi
+}
+
 test_auth_login() {
     print_test_header "Authentication - Login"
 
@@ -244,6 +275,40 @@ test_user_get() {
     fi
 }
 
+test_user_update() {
+    print_test_header "User Endpoints - Partial Updates"
+
+    if [ -z "$TEST_JWT_TOKEN" ] || [ -z "$TEST_USER_ID" ]; then
+        fail "Skipping update tests - no auth token or user ID"
+        return
+    fi
+
+    local url="$API_URL/api/v1/users/$TEST_USER_ID"
+    etag=$(curl -s -D - -o /dev/null "$url" -H "Authorization: Bearer $TEST_JWT_TOKEN" | \
+        tr -d '\r' | awk 'tolower($1) == "etag:" {print $2}')
+    name=$(curl -s "$url" -H "Authorization: Bearer $TEST_JWT_TOKEN" | jq -r '.name')
+
+    # Changing only the phone must keep the name
+    patched=$(curl -s -X PATCH "$url" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/merge-patch+json" -H "If-Match: $etag" \
+        -d '{"phone":"+15550100"}')
+    if [ "$(echo "$patched" | jq -r '.phone')" = "+15550100" ] && [ "$(echo "$patched" | jq -r '.name')" = "$name" ]; then
+        pass "PATCH changes only the fields sent"
+    else
+        fail "PATCH changed other fields" "Expected name '$name', body: $patched"
+    fi
+
+    # The ETag read before the PATCH is stale now
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH "$url" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/merge-patch+json" -H "If-Match: $etag" \
+        -d '{"name":"Stale Edit"}')
+    if [ "$http_code" = "412" ]; then
+        pass "Update with a stale If-Match returns 412"
+    else
+        fail "Stale update accepted" "Expected 412, got $http_code"
+    fi
+}
+
 test_user_forbidden_access() {
     print_test_header "User Endpoints - Forbidden Access"
 
@@ -263,6 +328,501 @@ test_user_forbidden_access() {
     else
         info "Got $http_code (might be 404 if user doesn't exist, or 403 if forbidden)"
     fi
+
+    # Searching users is for support staff and admins only
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" "$API_URL/api/v1/admin/users?email=test" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN")
+    if [ "$http_code" = "403" ]; then
+        pass "Customers cannot list users (403)"
+    else
+        fail "Customer reached the user list" "Expected 403, got $http_code"
+    fi
+}
+
+# Assumes REQUIRE_VERIFIED_EMAIL is off, as in docker-compose
+test_user_addresses() {
+    print_test_header "User Endpoints - Addresses"
+
+    if [ -z "$TEST_JWT_TOKEN" ] || [ -z "$TEST_USER_ID" ]; then
+        fail "Skipping address tests - no auth token or user ID"
+        return
+    fi
+
+    local base="$API_URL/api/v1/users/$TEST_USER_ID/addresses"
+    local address='{"street":"1 Main St","city":"Springfield","state":"IL","postal_code":"62701","country":"US","is_default":true}'
+
+    first_id=$(curl -s -X POST "$base" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" -d "$address" | jq -r '.id // empty')
+    second_id=$(curl -s -X POST "$base" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" -d "$address" | jq -r '.id // empty')
+
+    if [ -z "$first_id" ] || [ -z "$second_id" ]; then
+        fail "Skipping address tests - could not add addresses"
+        return
+    fi
+
+    defaults=$(curl -s "$base" -H "Authorization: Bearer $TEST_JWT_TOKEN" | jq '[.[] | select(.is_default)] | length')
+    if [ "$defaults" = "1" ]; then
+        pass "Only one address is the default"
+    else
+        fail "Several default addresses" "Expected 1, got $defaults"
+    fi
+
+    is_default=$(curl -s -X POST "$base/$first_id/default" -H "Authorization: Bearer $TEST_JWT_TOKEN" | jq -r '.is_default')
+    if [ "$is_default" = "true" ]; then
+        pass "Set default address"
+    else
+        fail "Set default address failed" "Expected is_default true, got $is_default"
+    fi
+
+    city=$(curl -s -X PUT "$base/$second_id" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" \
+        -d '{"street":"2 Oak Ave","city":"Shelbyville","state":"IL","postal_code":"62565","country":"US"}' | jq -r '.city')
+    if [ "$city" = "Shelbyville" ]; then
+        pass "Update address"
+    else
+        fail "Update address failed" "Expected Shelbyville, got $city"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X DELETE "$base/$first_id" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN")
+    if [ "$http_code" = "204" ]; then
+        pass "Delete address returns 204"
+    else
+        fail "Delete address failed" "Expected 204, got $http_code"
+    fi
+
+    is_default=$(curl -s "$base/$second_id" -H "Authorization: Bearer $TEST_JWT_TOKEN" | jq -r '.is_default')
+    if [ "$is_default" = "true" ]; then
+        pass "Remaining address becomes the default"
+    else
+        fail "No default after deleting the default address" "Expected is_default true, got $is_default"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" "$base/$first_id" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN")
+    if [ "$http_code" = "404" ]; then
+        pass "Deleted address returns 404"
+    else
+        fail "Deleted address still found" "Expected 404, got $http_code"
+    fi
+
+    # A billing-only address can become the default billing address without touching shipping
+    billing=$(curl -s -X POST "$base" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" \
+        -d '{"type":"billing","label":"Office","recipient_name":"Accounts","street":"3 Elm St","city":"Springfield","state":"IL","postal_code":"62702","country":"US"}')
+    billing_id=$(echo "$billing" | jq -r '.id // empty')
+    if [ "$(echo "$billing" | jq -r '.label')" = "Office" ] && [ "$(echo "$billing" | jq -r '.is_default_billing')" = "false" ]; then
+        pass "Billing address keeps its label and is not the default yet"
+    else
+        fail "Unexpected billing address" "Body: $billing"
+    fi
+
+    curl -s -o /dev/null -X POST "$base/$billing_id/default?type=billing" -H "Authorization: Bearer $TEST_JWT_TOKEN"
+    shipping_default=$(curl -s "$base/$second_id" -H "Authorization: Bearer $TEST_JWT_TOKEN" | jq -r '"\(.is_default_shipping) \(.is_default_billing)"')
+    if [ "$shipping_default" = "true false" ]; then
+        pass "Default billing and shipping addresses are separate"
+    else
+        fail "Default per type not kept" "Expected 'true false', got '$shipping_default'"
+    fi
+
+    # Countries are stored as ISO codes and verification suggests the city the postal code belongs to
+    normalized=$(curl -s -X POST "$base" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" \
+        -d '{"street":"4 Pine St","city":"Springfeld","state":"Illinois","postal_code":"62701","country":"usa"}')
+    if [ "$(echo "$normalized" | jq -r '"\(.country) \(.state)"')" = "US IL" ] && \
+        [ "$(echo "$normalized" | jq -r '.suggestions[0].value // empty')" = "Springfield" ]; then
+        pass "Address is normalized and a city correction is suggested"
+    else
+        fail "Address not normalized" "Body: $normalized"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$base" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" \
+        -d '{"street":"5 Pine St","city":"Springfield","state":"IL","postal_code":"1234","country":"US"}')
+    if [ "$http_code" = "400" ]; then
+        pass "Postal code that does not fit the country is rejected (400)"
+    else
+        fail "Invalid postal code accepted" "Expected 400, got $http_code"
+    fi
+}
+
+test_user_preferences() {
+    print_test_header "User Endpoints - Preferences"
+
+    if [ -z "$TEST_JWT_TOKEN" ] || [ -z "$TEST_USER_ID" ]; then
+        fail "Skipping preference tests - no auth token or user ID"
+        return
+    fi
+
+    local url="$API_URL/api/v1/users/$TEST_USER_ID/preferences"
+
+    defaults=$(curl -s "$url" -H "Authorization: Bearer $TEST_JWT_TOKEN")
+    if [ "$(echo "$defaults" | jq -r '"\(.currency) \(.marketing_email)"')" = "USD false" ]; then
+        pass "New users get the default preferences"
+    else
+        fail "Unexpected default preferences" "Body: $defaults"
+    fi
+
+    updated=$(curl -s -X PATCH "$url" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/merge-patch+json" \
+        -d '{"currency":"eur","marketing_email":true}')
+    if [ "$(echo "$updated" | jq -r '"\(.currency) \(.marketing_email) \(.locale)"')" = "EUR true en-US" ]; then
+        pass "PATCH preferences normalizes values and keeps the others"
+    else
+        fail "Preferences not updated" "Body: $updated"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH "$url" -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/merge-patch+json" -d '{"timezone":"Mars/Olympus_Mons"}')
+    if [ "$http_code" = "400" ]; then
+        pass "Unknown time zone is rejected (400)"
+    else
+        fail "Invalid time zone accepted" "Expected 400, got $http_code"
+    fi
+}
+
+test_data_export() {
+    print_test_header "User Endpoints - Data Export"
+
+    if [ -z "$TEST_JWT_TOKEN" ] || [ -z "$TEST_USER_ID" ]; then
+        fail "Skipping data export tests - no auth token or user ID"
+        return
+    fi
+
+    response=$(curl -s -w "\n%{http_code}" -X POST "$API_URL/api/v1/users/$TEST_USER_ID/export" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN")
+    http_code=$(echo "$response" | tail -n1)
+    body=$(echo "$response" | sed '$d')
+    status_url=$(echo "$body" | jq -r '.status_url // empty')
+    if [ "$http_code" = "202" ] && [ -n "$status_url" ]; then
+        pass "Data export request returns 202 with a status URL"
+    else
+        fail "Data export request failed" "Expected 202, got $http_code. Body: $body"
+        return
+    fi
+
+    # The export is built in the background (DATA_EXPORT_INTERVAL is 5s in docker-compose)
+    local status=""
+    for _ in $(seq 1 15); do
+        body=$(curl -s "$API_URL$status_url" -H "Authorization: Bearer $TEST_JWT_TOKEN")
+        status=$(echo "$body" | jq -r '.status // empty')
+        if [ "$status" = "ready" ] || [ "$status" = "failed" ]; then
+            break
+        fi
+        sleep 2
+    done
+    if [ "$status" = "ready" ]; then
+        pass "Data export becomes ready"
+    else
+        fail "Data export did not become ready" "Body: $body"
+        return
+    fi
+
+    local archive="/tmp/data-export-$$.zip"
+    http_code=$(curl -s -o "$archive" -w "%{http_code}" "$API_URL$(echo "$body" | jq -r '.download_url')" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN")
+    if [ "$http_code" = "200" ] && [ "$(head -c 2 "$archive")" = "PK" ]; then
+        pass "Data export downloads as a zip archive"
+    else
+        fail "Data export download failed" "Expected 200 and a zip, got $http_code"
+    fi
+    rm -f "$archive"
+}
+
+test_api_keys() {
+    print_test_header "Authentication - API Keys"
+
+    if [ -z "$TEST_JWT_TOKEN" ] || [ -z "$TEST_USER_ID" ]; then
+        fail "Skipping API key tests - no auth token"
+        return
+    fi
+
+    response=$(curl -s -w "\n%{http_code}" -X POST "$API_URL/api/v1/auth/api-keys" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" \
+        -d '{"name":"test-script","scopes":["users:read:self"],"expires_in_days":1}')
+
+    http_code=$(echo "$response" | tail -n 1)
+    body=$(echo "$response" | sed '$d')
+    api_key=$(echo "$body" | jq -r '.key // empty')
+
+    if [ "$http_code" = "201" ] && [ -n "$api_key" ]; then
+        pass "Create API key returns 201 with the key"
+    else
+        fail "Create API key failed" "Expected 201, got $http_code. Body: $body"
+        return
+    fi
+    api_key_id=$(echo "$body" | jq -r '.id')
+
+    # The key acts as its owner
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" "$API_URL/api/v1/users/$TEST_USER_ID" \
+        -H "X-API-Key: $api_key")
+    if [ "$http_code" = "200" ] || [ "$http_code" = "404" ]; then
+        pass "X-API-Key authenticates as the key owner ($http_code)"
+    else
+        fail "X-API-Key request rejected" "Expected 200 or 404, got $http_code"
+    fi
+
+    # A read-only key must not write, even to its owner's data
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH "$API_URL/api/v1/users/$TEST_USER_ID" \
+        -H "X-API-Key: $api_key" \
+        -H "Content-Type: application/merge-patch+json" \
+        -d '{"phone":"+15550199"}')
+    if [ "$http_code" = "403" ]; then
+        pass "Key without users:write:self cannot update its owner (403)"
+    else
+        fail "Read-only API key wrote user data" "Expected 403, got $http_code"
+    fi
+
+    # A key must not be able to manage keys
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" "$API_URL/api/v1/auth/api-keys" -H "X-API-Key: $api_key")
+    if [ "$http_code" = "403" ]; then
+        pass "API keys cannot manage API keys (403)"
+    else
+        fail "API key reached key management" "Expected 403, got $http_code"
+    fi
+
+    # Customers hold no :any permission, so they cannot give a key one
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/api-keys" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" \
+        -d '{"name":"too-powerful","scopes":["users:write:any"]}')
+    if [ "$http_code" = "403" ]; then
+        pass "Scopes beyond the user's permissions are refused (403)"
+    else
+        fail "Over-scoped API key accepted" "Expected 403, got $http_code"
+    fi
+
+    # Revoke before first use, so no gateway cache can still hold it
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X DELETE "$API_URL/api/v1/auth/api-keys/$api_key_id" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN")
+    if [ "$http_code" = "200" ]; then
+        pass "Revoke API key returns 200"
+    else
+        fail "Revoke API key failed" "Expected 200, got $http_code"
+    fi
+
+    response=$(curl -s -X POST "$API_URL/api/v1/auth/api-keys" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN" \
+        -H "Content-Type: application/json" \
+        -d '{"name":"revoked-before-use"}')
+    unused_key=$(echo "$response" | jq -r '.key // empty')
+    curl -s -o /dev/null -X DELETE "$API_URL/api/v1/auth/api-keys/$(echo "$response" | jq -r '.id')" \
+        -H "Authorization: Bearer $TEST_JWT_TOKEN"
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" "$API_URL/api/v1/users/$TEST_USER_ID" \
+        -H "X-API-Key: $unused_key")
+    if [ "$http_code" = "401" ]; then
+        pass "Revoked API key returns 401"
+    else
+        fail "Revoked API key accepted" "Expected 401, got $http_code"
+    fi
+}
+
+# Social login against the fake OIDC provider from docker-compose (auth-service/cmd/fake-oidc).
+# The fake provider approves any login; login_hint picks the email to sign in as.
+oauth_login() {
+    local email="$1"
+
+    start=$(curl -s -o /dev/null -w "%{http_code} %{redirect_url}" "$API_URL/api/v1/auth/oauth/fake/start")
+    if [ "${start%% *}" != "302" ]; then
+        echo "start returned ${start%% *}"
+        return
+    fi
+
+    authorize_url="${start#* }&login_hint=$email&name=OAuth%20User"
+    callback_url=$(curl -s -o /dev/null -w "%{redirect_url}" "$authorize_url")
+
+    curl -s -w "\n%{http_code}" "$callback_url"
+}
+
+test_oauth_login() {
+    print_test_header "Authentication - OAuth Login"
+
+    providers=$(curl -s "$API_URL/api/v1/auth/oauth/providers" | jq -r '.providers[]?' 2>/dev/null || true)
+    if ! echo "$providers" | grep -qx "fake"; then
+        info "Fake identity provider not configured, skipping OAuth tests"
+        return
+    fi
+    pass "Fake identity provider is listed"
+
+    local email="oauth-$(date +%s)@example.com"
+
+    response=$(oauth_login "$email")
+    http_code=$(echo "$response" | tail -n 1)
+    body=$(echo "$response" | sed '$d')
+
+    if [ "$http_code" = "200" ] && [ -n "$(echo "$body" | jq -r '.token // empty')" ]; then
+        pass "OAuth callback returns a JWT token"
+    else
+        fail "OAuth login failed" "Expected 200 with token, got $http_code. Body: $body"
+        return
+    fi
+
+    oauth_user_id=$(echo "$body" | jq -r '.user_id')
+    if [ "$(echo "$body" | jq -r '.new_user')" = "true" ]; then
+        pass "First OAuth login creates the account"
+    else
+        fail "First OAuth login did not create an account" "Body: $body"
+    fi
+
+    # The same provider identity must log into the same account
+    response=$(oauth_login "$email")
+    body=$(echo "$response" | sed '$d')
+
+    if [ "$(echo "$body" | jq -r '.user_id')" = "$oauth_user_id" ] && [ "$(echo "$body" | jq -r '.new_user')" = "false" ]; then
+        pass "Second OAuth login reuses the linked account"
+    else
+        fail "Second OAuth login did not reuse the account" "Body: $body"
+    fi
+
+    # Callbacks with a made-up state are rejected
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" "$API_URL/api/v1/auth/oauth/fake/callback?code=abc&state=forged")
+    if [ "$http_code" = "401" ]; then
+        pass "OAuth callback with unknown state returns 401"
+    else
+        fail "Forged OAuth state accepted" "Expected 401, got $http_code"
+    fi
+}
+
+# Uses its own user so changing the password does not sign out the other tests
+test_change_password() {
+    print_test_header "Authentication - Change Password"
+
+    local email="change-$(date +%s)@example.com"
+    local old_password="OldPass123!"
+    local new_password="NewPass456!"
+
+    curl -s -o /dev/null -X POST "$API_URL/api/v1/auth/register" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"$email\",\"password\":\"$old_password\",\"name\":\"Change User\"}"
+
+    # Two logins: the first changes the password, the second should be signed out
+    body=$(curl -s -X POST "$API_URL/api/v1/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"$email\",\"password\":\"$old_password\"}")
+    token=$(echo "$body" | jq -r '.token // empty')
+    other_refresh=$(curl -s -X POST "$API_URL/api/v1/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"$email\",\"password\":\"$old_password\"}" | jq -r '.refresh_token // empty')
+
+    if [ -z "$token" ] || [ -z "$other_refresh" ]; then
+        fail "Skipping change password tests - login failed" "Body: $body"
+        return
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/password/change" \
+        -H "Authorization: Bearer $token" \
+        -H "Content-Type: application/json" \
+        -d "{\"current_password\":\"wrong-password\",\"new_password\":\"$new_password\"}")
+    if [ "$http_code" = "403" ]; then
+        pass "Change password with wrong current password returns 403"
+    else
+        fail "Wrong current password accepted" "Expected 403, got $http_code"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/password/change" \
+        -H "Authorization: Bearer $token" \
+        -H "Content-Type: application/json" \
+        -d "{\"current_password\":\"$old_password\",\"new_password\":\"$new_password\"}")
+    if [ "$http_code" = "200" ]; then
+        pass "Change password returns 200"
+    else
+        fail "Change password failed" "Expected 200, got $http_code"
+        return
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/refresh" \
+        -H "Content-Type: application/json" \
+        -d "{\"refresh_token\":\"$other_refresh\"}")
+    if [ "$http_code" = "401" ]; then
+        pass "Other sessions are signed out after a password change"
+    else
+        fail "Other session survived the password change" "Expected 401, got $http_code"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"$email\",\"password\":\"$new_password\"}")
+    if [ "$http_code" = "200" ]; then
+        pass "Login works with the new password"
+    else
+        fail "Login with new password failed" "Expected 200, got $http_code"
+    fi
+
+    # The email only changes once the link sent to the new address is opened
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/email/change" \
+        -H "Authorization: Bearer $token" \
+        -H "Content-Type: application/json" \
+        -d "{\"current_password\":\"$new_password\",\"new_email\":\"new-$email\"}")
+    if [ "$http_code" = "202" ]; then
+        pass "Email change request returns 202"
+    else
+        fail "Email change request failed" "Expected 202, got $http_code"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/email/confirm" \
+        -H "Content-Type: application/json" \
+        -d '{"token":"not-a-real-token"}')
+    if [ "$http_code" = "400" ]; then
+        pass "Email change with an unknown token returns 400"
+    else
+        fail "Unknown email change token accepted" "Expected 400, got $http_code"
+    fi
+}
+
+# Uses its own user since deleting it signs it out everywhere
+test_delete_account() {
+    print_test_header "Users - Delete Account"
+
+    local email="delete-$(date +%s)@example.com"
+    local password="DeleteMe123!"
+
+    curl -s -o /dev/null -X POST "$API_URL/api/v1/auth/register" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"$email\",\"password\":\"$password\",\"name\":\"Delete User\"}"
+
+    body=$(curl -s -X POST "$API_URL/api/v1/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"$email\",\"password\":\"$password\"}")
+    token=$(echo "$body" | jq -r '.token // empty')
+    refresh=$(echo "$body" | jq -r '.refresh_token // empty')
+    user_id=$(echo "$body" | jq -r '.user_id // empty')
+
+    if [ -z "$token" ] || [ -z "$user_id" ]; then
+        fail "Skipping delete account tests - login failed" "Body: $body"
+        return
+    fi
+
+    response=$(curl -s -w "\n%{http_code}" -X DELETE "$API_URL/api/v1/users/$user_id" \
+        -H "Authorization: Bearer $token")
+    http_code=$(echo "$response" | tail -n1)
+    body=$(echo "$response" | sed '$d')
+    if [ "$http_code" = "200" ] && [ -n "$(echo "$body" | jq -r '.purge_after // empty')" ]; then
+        pass "Delete account returns 200 with the purge date"
+    else
+        fail "Delete account failed" "Expected 200, got $http_code. Body: $body"
+        return
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/login" \
+        -H "Content-Type: application/json" \
+        -d "{\"email\":\"$email\",\"password\":\"$password\"}")
+    if [ "$http_code" = "401" ]; then
+        pass "Deleted account cannot log in"
+    else
+        fail "Deleted account logged in" "Expected 401, got $http_code"
+    fi
+
+    http_code=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$API_URL/api/v1/auth/refresh" \
+        -H "Content-Type: application/json" \
+        -d "{\"refresh_token\":\"$refresh\"}")
+    if [ "$http_code" = "401" ]; then
+        pass "Refresh tokens of a deleted account are revoked"
+    else
+        fail "Refresh token survived account deletion" "Expected 401, got $http_code"
+    fi
 }
 
 # Summary
@@ -299,13 +859,22 @@ main() {
     check_dependencies
     test_health_check
     test_auth_register
+    test_auth_weak_password
     test_auth_login
     test_auth_invalid_credentials
     test_protected_without_auth
     test_protected_invalid_token
     test_protected_malformed_header
     test_user_get
+    test_user_update
     test_user_forbidden_access
+    test_user_addresses
+    test_user_preferences
+    test_data_export
+    test_api_keys
+    test_oauth_login
+    test_change_password
+    test_delete_account
 
     print_summary
 }
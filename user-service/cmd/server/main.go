@@ -7,12 +7,14 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	_ "time/tzdata" // Preference time zones are validated against it; the alpine image has no zoneinfo
 
 	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
 
 	pb "go-project/proto/user"
 	"user-service/internal/handlers"
+	"user-service/internal/postal"
 	"user-service/internal/repository"
 	"user-service/internal/service"
 )
@@ -39,7 +41,8 @@ func main() {
 
 	// Initialize layers: Repository → Service → Handler
 	userRepo := repository.NewPostgresUserRepository(db)
-	userService := service.NewUserService(userRepo)
+	preferencesRepo := repository.NewPostgresPreferencesRepository(db)
+	userService := service.NewUserService(userRepo, preferencesRepo, postal.NewValidator(addressProvider()))
 	userHandler := handlers.NewUserHandler(userService)
 
 	// Create gRPC server
@@ -68,3 +71,26 @@ func main() {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
+
+// addressProvider returns the address verification provider selected by ADDRESS_PROVIDER:
+// "none" (the default) or "fixture", which reads postal codes from ADDRESS_FIXTURES_FILE
+func addressProvider() postal.Provider {
+	switch provider := os.Getenv("ADDRESS_PROVIDER"); provider {
+	case "", "none":
+		return nil
+	case "fixture":
+		path := os.Getenv("ADDRESS_FIXTURES_FILE")
+		if path == "" {
+			path = "data/address-fixtures.json"
+		}
+		fixtures, err := postal.LoadFixtureProvider(path)
+		if err != nil {
+			log.Fatalf("Failed to load address fixtures: %v", err)
+		}
+		log.Printf("📮 Verifying addresses against fixtures from %s", path)
+		return fixtures
+	default:
+		log.Fatalf("Unknown ADDRESS_PROVIDER %q, use none or fixture", provider)
+		return nil
+	}
+}
@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	pb "go-project/proto/user"
+	"user-service/internal/models"
+	"user-service/internal/postal"
+	"user-service/internal/repository"
 	"user-service/internal/service"
 
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -31,16 +36,7 @@ func (h *UserHandler) CreateUser(ctx context.Context, req *pb.CreateUserRequest)
 		}, nil // Return error in response, not as gRPC error
 	}
 
-	// Convert internal model to protobuf
-	pbUser := &pb.User{
-		Id:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		Phone:     user.Phone,
-		CreatedAt: timestamppb.New(user.CreatedAt),
-		UpdatedAt: timestamppb.New(user.UpdatedAt),
-		Addresses: []*pb.Address{}, // Empty for now, will populate if needed
-	}
+	pbUser := userToProto(user)
 
 	return &pb.CreateUserResponse{
 		User:  pbUser,
@@ -64,28 +60,11 @@ func (h *UserHandler) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.
 	// Convert addresses to protobuf
 	pbAddresses := make([]*pb.Address, 0, len(addresses))
 	for _, addr := range addresses {
-		pbAddresses = append(pbAddresses, &pb.Address{
-			Id:         addr.ID,
-			UserId:     addr.UserID,
-			Street:     addr.Street,
-			City:       addr.City,
-			State:      addr.State,
-			PostalCode: addr.PostalCode,
-			Country:    addr.Country,
-			IsDefault:  addr.IsDefault,
-			CreatedAt:  timestamppb.New(addr.CreatedAt),
-		})
+		pbAddresses = append(pbAddresses, addressToProto(addr))
 	}
 
-	pbUser := &pb.User{
-		Id:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		Phone:     user.Phone,
-		CreatedAt: timestamppb.New(user.CreatedAt),
-		UpdatedAt: timestamppb.New(user.UpdatedAt),
-		Addresses: pbAddresses,
-	}
+	pbUser := userToProto(user)
+	pbUser.Addresses = pbAddresses
 
 	return &pb.GetUserResponse{
 		User:  pbUser,
@@ -95,14 +74,34 @@ func (h *UserHandler) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.
 
 // UpdateUser handles user update requests
 func (h *UserHandler) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UpdateUserResponse, error) {
-	// TODO(human): Implement UpdateUser handler
-	// Hints:
-	// 1. Call h.service.UpdateUser(req.UserId, req.Name, req.Phone)
-	// 2. If error, return pb.UpdateUserResponse with error field set
-	// 3. Convert the returned user to pb.User (like in CreateUser)
-	// 4. Return pb.UpdateUserResponse with user and empty error
-	user, err := h.service.UpdateUser(req.UserId, req.Name, req.Phone)
+	update := service.UserUpdate{ExpectedVersion: req.ExpectedVersion}
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"name", "phone"}
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			update.Name = &req.Name
+		case "phone":
+			update.Phone = &req.Phone
+		default:
+			return &pb.UpdateUserResponse{
+				User:  nil,
+				Error: fmt.Sprintf("field %q cannot be updated", path),
+			}, nil
+		}
+	}
+
+	user, err := h.service.UpdateUser(req.UserId, update)
 
+	if errors.Is(err, service.ErrVersionConflict) {
+		return &pb.UpdateUserResponse{
+			User:     userToProto(user),
+			Error:    err.Error(),
+			Conflict: true,
+		}, nil
+	}
 	if err != nil {
 		return &pb.UpdateUserResponse{
 			User:  nil,
@@ -115,28 +114,11 @@ func (h *UserHandler) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest)
 	// Convert addresses to protobuf
 	pbAddresses := make([]*pb.Address, 0, len(addresses))
 	for _, addr := range addresses {
-		pbAddresses = append(pbAddresses, &pb.Address{
-			Id:         addr.ID,
-			UserId:     addr.UserID,
-			Street:     addr.Street,
-			City:       addr.City,
-			State:      addr.State,
-			PostalCode: addr.PostalCode,
-			Country:    addr.Country,
-			IsDefault:  addr.IsDefault,
-			CreatedAt:  timestamppb.New(addr.CreatedAt),
-		})
+		pbAddresses = append(pbAddresses, addressToProto(addr))
 	}
 
-	pbUser := &pb.User{
-		Id:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		Phone:     user.Phone,
-		CreatedAt: timestamppb.New(user.CreatedAt),
-		UpdatedAt: timestamppb.New(user.UpdatedAt),
-		Addresses: pbAddresses,
-	}
+	pbUser := userToProto(user)
+	pbUser.Addresses = pbAddresses
 
 	return &pb.UpdateUserResponse{
 		User:  pbUser,
@@ -144,6 +126,24 @@ func (h *UserHandler) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest)
 	}, nil
 }
 
+// UpdateEmail handles email changes confirmed through auth-service
+func (h *UserHandler) UpdateEmail(ctx context.Context, req *pb.UpdateEmailRequest) (*pb.UpdateEmailResponse, error) {
+	user, err := h.service.UpdateEmail(req.UserId, req.Email)
+	if err != nil {
+		return &pb.UpdateEmailResponse{
+			User:  nil,
+			Error: err.Error(),
+		}, nil
+	}
+
+	pbUser := userToProto(user)
+
+	return &pb.UpdateEmailResponse{
+		User:  pbUser,
+		Error: "",
+	}, nil
+}
+
 // DeleteUser handles user deletion requests
 func (h *UserHandler) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
 	// TODO(human): Implement DeleteUser handler
@@ -151,7 +151,12 @@ func (h *UserHandler) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest)
 	// 1. Call h.service.DeleteUser(req.UserId)
 	// 2. If error, return pb.DeleteUserResponse{Success: false, Error: err.Error()}
 	// 3. If success, return pb.DeleteUserResponse{Success: true, Error: ""}
-	err := h.service.DeleteUser(req.UserId)
+	var err error
+	if req.Purge {
+		err = h.service.PurgeUser(req.UserId)
+	} else {
+		err = h.service.DeleteUser(req.UserId)
+	}
 
 	if err != nil {
 		return &pb.DeleteUserResponse{
@@ -166,17 +171,93 @@ func (h *UserHandler) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest)
 	}, nil
 }
 
+// UndeleteUser handles requests to restore a soft-deleted user
+func (h *UserHandler) UndeleteUser(ctx context.Context, req *pb.UndeleteUserRequest) (*pb.UndeleteUserResponse, error) {
+	user, err := h.service.UndeleteUser(req.UserId)
+	if err != nil {
+		return &pb.UndeleteUserResponse{
+			User:  nil,
+			Error: err.Error(),
+		}, nil
+	}
+
+	pbUser := userToProto(user)
+
+	return &pb.UndeleteUserResponse{
+		User:  pbUser,
+		Error: "",
+	}, nil
+}
+
+// ListUserIDs handles requests to page through all user IDs
+func (h *UserHandler) ListUserIDs(ctx context.Context, req *pb.ListUserIDsRequest) (*pb.ListUserIDsResponse, error) {
+	ids, err := h.service.ListUserIDs(req.AfterId, int(req.Limit))
+	if err != nil {
+		return &pb.ListUserIDsResponse{
+			UserIds: nil,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &pb.ListUserIDsResponse{
+		UserIds: ids,
+		Error:   "",
+	}, nil
+}
+
+// ListUsers handles back-office user searches
+func (h *UserHandler) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	query := repository.UserListQuery{
+		EmailPrefix:    req.EmailPrefix,
+		NamePrefix:     req.NamePrefix,
+		IncludeDeleted: req.IncludeDeleted,
+		SortBy:         req.SortBy,
+		Descending:     req.Descending,
+		Limit:          int(req.PageSize),
+	}
+	if req.CreatedAfter != nil {
+		createdAfter := req.CreatedAfter.AsTime()
+		query.CreatedAfter = &createdAfter
+	}
+	if req.CreatedBefore != nil {
+		createdBefore := req.CreatedBefore.AsTime()
+		query.CreatedBefore = &createdBefore
+	}
+
+	users, nextPageToken, total, err := h.service.ListUsers(query, req.PageToken)
+	if err != nil {
+		return &pb.ListUsersResponse{
+			Error: err.Error(),
+		}, nil
+	}
+
+	pbUsers := make([]*pb.User, 0, len(users))
+	for _, user := range users {
+		pbUsers = append(pbUsers, userToProto(user))
+	}
+
+	return &pb.ListUsersResponse{
+		Users:         pbUsers,
+		NextPageToken: nextPageToken,
+		TotalCount:    int64(total),
+		Error:         "",
+	}, nil
+}
+
 // AddAddress handles address creation requests
 func (h *UserHandler) AddAddress(ctx context.Context, req *pb.AddAddressRequest) (*pb.AddAddressResponse, error) {
-	address, err := h.service.AddAddress(
-		req.UserId,
-		req.Street,
-		req.City,
-		req.State,
-		req.PostalCode,
-		req.Country,
-		req.IsDefault,
-	)
+	address, suggestions, err := h.service.AddAddress(ctx, req.UserId, service.AddressInput{
+		Type:          req.Type,
+		Label:         req.Label,
+		RecipientName: req.RecipientName,
+		Phone:         req.Phone,
+		Street:        req.Street,
+		City:          req.City,
+		State:         req.State,
+		PostalCode:    req.PostalCode,
+		Country:       req.Country,
+		IsDefault:     &req.IsDefault,
+	})
 
 	if err != nil {
 		return &pb.AddAddressResponse{
@@ -185,21 +266,10 @@ func (h *UserHandler) AddAddress(ctx context.Context, req *pb.AddAddressRequest)
 		}, nil
 	}
 
-	pbAddress := &pb.Address{
-		Id:         address.ID,
-		UserId:     address.UserID,
-		Street:     address.Street,
-		City:       address.City,
-		State:      address.State,
-		PostalCode: address.PostalCode,
-		Country:    address.Country,
-		IsDefault:  address.IsDefault,
-		CreatedAt:  timestamppb.New(address.CreatedAt),
-	}
-
 	return &pb.AddAddressResponse{
-		Address: pbAddress,
-		Error:   "",
+		Address:     addressToProto(address),
+		Error:       "",
+		Suggestions: suggestionsToProto(suggestions),
 	}, nil
 }
 
@@ -215,17 +285,7 @@ func (h *UserHandler) GetAddresses(ctx context.Context, req *pb.GetAddressesRequ
 
 	pbAddresses := make([]*pb.Address, 0, len(addresses))
 	for _, addr := range addresses {
-		pbAddresses = append(pbAddresses, &pb.Address{
-			Id:         addr.ID,
-			UserId:     addr.UserID,
-			Street:     addr.Street,
-			City:       addr.City,
-			State:      addr.State,
-			PostalCode: addr.PostalCode,
-			Country:    addr.Country,
-			IsDefault:  addr.IsDefault,
-			CreatedAt:  timestamppb.New(addr.CreatedAt),
-		})
+		pbAddresses = append(pbAddresses, addressToProto(addr))
 	}
 
 	return &pb.GetAddressesResponse{
@@ -233,3 +293,202 @@ func (h *UserHandler) GetAddresses(ctx context.Context, req *pb.GetAddressesRequ
 		Error:     "",
 	}, nil
 }
+
+// GetAddress handles requests for a single address
+func (h *UserHandler) GetAddress(ctx context.Context, req *pb.GetAddressRequest) (*pb.GetAddressResponse, error) {
+	address, err := h.service.GetAddress(req.UserId, req.AddressId)
+	if err != nil {
+		return &pb.GetAddressResponse{
+			Address: nil,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &pb.GetAddressResponse{
+		Address: addressToProto(address),
+		Error:   "",
+	}, nil
+}
+
+// UpdateAddress handles address update requests
+func (h *UserHandler) UpdateAddress(ctx context.Context, req *pb.UpdateAddressRequest) (*pb.UpdateAddressResponse, error) {
+	address, suggestions, err := h.service.UpdateAddress(ctx, req.UserId, req.AddressId, service.AddressInput{
+		Type:          req.Type,
+		Label:         req.Label,
+		RecipientName: req.RecipientName,
+		Phone:         req.Phone,
+		Street:        req.Street,
+		City:          req.City,
+		State:         req.State,
+		PostalCode:    req.PostalCode,
+		Country:       req.Country,
+		IsDefault:     req.IsDefault,
+	})
+	if err != nil {
+		return &pb.UpdateAddressResponse{
+			Address: nil,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &pb.UpdateAddressResponse{
+		Address:     addressToProto(address),
+		Error:       "",
+		Suggestions: suggestionsToProto(suggestions),
+	}, nil
+}
+
+// DeleteAddress handles address deletion requests
+func (h *UserHandler) DeleteAddress(ctx context.Context, req *pb.DeleteAddressRequest) (*pb.DeleteAddressResponse, error) {
+	if err := h.service.DeleteAddress(req.UserId, req.AddressId); err != nil {
+		return &pb.DeleteAddressResponse{
+			IsDeleted: false,
+			Error:     err.Error(),
+		}, nil
+	}
+
+	return &pb.DeleteAddressResponse{
+		IsDeleted: true,
+		Error:     "",
+	}, nil
+}
+
+// SetDefaultAddress handles requests to change the default address
+func (h *UserHandler) SetDefaultAddress(ctx context.Context, req *pb.SetDefaultAddressRequest) (*pb.SetDefaultAddressResponse, error) {
+	address, err := h.service.SetDefaultAddress(req.UserId, req.AddressId, req.Type)
+	if err != nil {
+		return &pb.SetDefaultAddressResponse{
+			Address: nil,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &pb.SetDefaultAddressResponse{
+		Address: addressToProto(address),
+		Error:   "",
+	}, nil
+}
+
+// addressToProto converts an internal address to protobuf
+func addressToProto(addr *models.Address) *pb.Address {
+	return &pb.Address{
+		Id:                addr.ID,
+		UserId:            addr.UserID,
+		Type:              addr.Type,
+		Label:             addr.Label,
+		RecipientName:     addr.RecipientName,
+		Phone:             addr.Phone,
+		Street:            addr.Street,
+		City:              addr.City,
+		State:             addr.State,
+		PostalCode:        addr.PostalCode,
+		Country:           addr.Country,
+		IsDefault:         addr.IsDefault(),
+		IsDefaultShipping: addr.IsDefaultShipping,
+		IsDefaultBilling:  addr.IsDefaultBilling,
+		CreatedAt:         timestamppb.New(addr.CreatedAt),
+	}
+}
+
+// GetPreferences handles preference retrieval requests
+func (h *UserHandler) GetPreferences(ctx context.Context, req *pb.GetPreferencesRequest) (*pb.GetPreferencesResponse, error) {
+	prefs, err := h.service.GetPreferences(req.UserId)
+	if err != nil {
+		return &pb.GetPreferencesResponse{
+			Preferences: nil,
+			Error:       err.Error(),
+		}, nil
+	}
+
+	return &pb.GetPreferencesResponse{
+		Preferences: preferencesToProto(prefs),
+		Error:       "",
+	}, nil
+}
+
+// UpdatePreferences handles preference update requests
+func (h *UserHandler) UpdatePreferences(ctx context.Context, req *pb.UpdatePreferencesRequest) (*pb.UpdatePreferencesResponse, error) {
+	values := req.GetPreferences()
+	prefs, err := h.service.UpdatePreferences(req.UserId, models.Preferences{
+		Locale:               values.GetLocale(),
+		Currency:             values.GetCurrency(),
+		Timezone:             values.GetTimezone(),
+		MarketingEmail:       values.GetMarketingEmail(),
+		MarketingSMS:         values.GetMarketingSms(),
+		NotificationChannels: values.GetNotificationChannels(),
+	}, req.GetUpdateMask().GetPaths())
+	if err != nil {
+		return &pb.UpdatePreferencesResponse{
+			Preferences: nil,
+			Error:       err.Error(),
+		}, nil
+	}
+
+	return &pb.UpdatePreferencesResponse{
+		Preferences: preferencesToProto(prefs),
+		Error:       "",
+	}, nil
+}
+
+// ExportUserData handles data export requests from auth-service
+func (h *UserHandler) ExportUserData(ctx context.Context, req *pb.ExportUserDataRequest) (*pb.ExportUserDataResponse, error) {
+	data, err := h.service.ExportUserData(req.UserId)
+	if err != nil {
+		return &pb.ExportUserDataResponse{
+			Data:  nil,
+			Error: err.Error(),
+		}, nil
+	}
+
+	return &pb.ExportUserDataResponse{
+		Data:  data,
+		Error: "",
+	}, nil
+}
+
+// preferencesToProto converts preferences to protobuf
+func preferencesToProto(prefs *models.Preferences) *pb.Preferences {
+	pbPrefs := &pb.Preferences{
+		Locale:               prefs.Locale,
+		Currency:             prefs.Currency,
+		Timezone:             prefs.Timezone,
+		MarketingEmail:       prefs.MarketingEmail,
+		MarketingSms:         prefs.MarketingSMS,
+		NotificationChannels: prefs.NotificationChannels,
+	}
+	if !prefs.UpdatedAt.IsZero() {
+		pbPrefs.UpdatedAt = timestamppb.New(prefs.UpdatedAt)
+	}
+	return pbPrefs
+}
+
+// userToProto converts a user to protobuf, without addresses
+func userToProto(user *models.User) *pb.User {
+	pbUser := &pb.User{
+		Id:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+		Addresses: []*pb.Address{},
+		Version:   user.Version,
+	}
+	if user.DeletedAt != nil {
+		pbUser.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+	return pbUser
+}
+
+// suggestionsToProto converts address verification suggestions to protobuf messages
+func suggestionsToProto(suggestions []postal.Suggestion) []*pb.AddressSuggestion {
+	pbSuggestions := make([]*pb.AddressSuggestion, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		pbSuggestions = append(pbSuggestions, &pb.AddressSuggestion{
+			Field:   suggestion.Field,
+			Value:   suggestion.Value,
+			Message: suggestion.Message,
+		})
+	}
+	return pbSuggestions
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Preferences are a user's settings for the storefront and notifications
+type Preferences struct {
+	UserID               string
+	Locale               string   // BCP 47 language tag, e.g. "en-US"
+	Currency             string   // ISO 4217 code, e.g. "USD"
+	Timezone             string   // IANA time zone, e.g. "Europe/Berlin"
+	MarketingEmail       bool     // Opted in to marketing emails
+	MarketingSMS         bool     // Opted in to marketing text messages
+	NotificationChannels []string // Where order and account notifications go: NotificationEmail, NotificationSMS, NotificationPush
+	UpdatedAt            time.Time
+}
+
+// Channels notifications can be sent on
+const (
+	NotificationEmail = "email"
+	NotificationSMS   = "sms"
+	NotificationPush  = "push"
+)
+
+// DefaultPreferences are the preferences of a user who never changed any.
+// Marketing is opt-in, so both opt-ins start out false.
+func DefaultPreferences(userID string) *Preferences {
+	return &Preferences{
+		UserID:               userID,
+		Locale:               "en-US",
+		Currency:             "USD",
+		Timezone:             "UTC",
+		NotificationChannels: []string{NotificationEmail},
+	}
+}
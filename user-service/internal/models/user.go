@@ -11,17 +11,46 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt *time.Time // Pointer because it can be NULL
+	Version   int64      // Incremented by every profile change
 }
 
 // Address represents a user's shipping/billing address
 type Address struct {
-	ID         string
-	UserID     string
-	Street     string
-	City       string
-	State      string
-	PostalCode string
-	Country    string
-	IsDefault  bool
-	CreatedAt  time.Time
+	ID            string
+	UserID        string
+	Type          string // AddressTypeShipping, AddressTypeBilling or AddressTypeBoth
+	Label         string // Chosen by the user, e.g. "Home"
+	RecipientName string
+	Phone         string
+	Street        string
+	City          string
+	State         string
+	PostalCode    string
+	Country       string
+	CreatedAt     time.Time
+
+	IsDefaultShipping bool
+	IsDefaultBilling  bool
+}
+
+// What an address can be used for (see Address.Type)
+const (
+	AddressTypeShipping = "shipping"
+	AddressTypeBilling  = "billing"
+	AddressTypeBoth     = "both"
+)
+
+// ForShipping reports whether the address can be used for shipping
+func (a *Address) ForShipping() bool {
+	return a.Type == AddressTypeShipping || a.Type == AddressTypeBoth
+}
+
+// ForBilling reports whether the address can be used for billing
+func (a *Address) ForBilling() bool {
+	return a.Type == AddressTypeBilling || a.Type == AddressTypeBoth
+}
+
+// IsDefault reports whether the address is the default for anything
+func (a *Address) IsDefault() bool {
+	return a.IsDefaultShipping || a.IsDefaultBilling
 }
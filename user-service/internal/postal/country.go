@@ -0,0 +1,127 @@
+package postal
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// countryAliases are common names that are neither ISO 3166 codes nor the English short name, keyed by
+// their folded spelling. Migration 004 normalized stored addresses with the same names; a test keeps
+// the two in step, so add new names here first.
+var countryAliases = map[string]string{
+	"america":                  "US",
+	"united states of america": "US",
+	"deutschland":              "DE",
+	"espana":                   "ES",
+	"italia":                   "IT",
+	"brasil":                   "BR",
+	"nederland":                "NL",
+	"schweiz":                  "CH",
+	"suisse":                   "CH",
+	"uae":                      "AE",
+	"great britain":            "GB",
+	"britain":                  "GB",
+	"england":                  "GB",
+	"scotland":                 "GB",
+	"wales":                    "GB",
+	"northern ireland":         "GB",
+	"holland":                  "NL",
+	"the netherlands":          "NL",
+	"czech republic":           "CZ",
+	"ivory coast":              "CI",
+	"korea":                    "KR",
+	"south korea":              "KR",
+	"republic of korea":        "KR",
+	"russian federation":       "RU",
+	"turkiye":                  "TR",
+	"vatican":                  "VA",
+}
+
+var (
+	countryNamesOnce sync.Once
+	countryNames     map[string]string // folded English name -> ISO 3166-1 alpha-2 code
+)
+
+// NormalizeCountry turns an ISO 3166-1 code (alpha-2, alpha-3 or numeric), an English country name or a
+// common alias such as "U.S." into the alpha-2 code. ok is false if the country is unknown.
+func NormalizeCountry(input string) (code string, ok bool) {
+	folded := fold(input)
+	if folded == "" {
+		return "", false
+	}
+
+	if compact := strings.ReplaceAll(folded, " ", ""); len(compact) <= 3 {
+		if region, err := language.ParseRegion(compact); err == nil {
+			region = region.Canonicalize()
+			if region.IsCountry() {
+				return region.String(), true
+			}
+		}
+	}
+
+	if code, ok := countryAliases[folded]; ok {
+		return code, true
+	}
+
+	countryNamesOnce.Do(loadCountryNames)
+	code, ok = countryNames[folded]
+	return code, ok
+}
+
+// CountryName returns the English short name of an alpha-2 code, e.g. "United States" for "US"
+func CountryName(code string) string {
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return code
+	}
+	return display.English.Regions().Name(region)
+}
+
+// loadCountryNames indexes the English name of every current ISO 3166-1 country
+func loadCountryNames() {
+	countryNames = make(map[string]string)
+	namer := display.English.Regions()
+
+	for a := 'A'; a <= 'Z'; a++ {
+		for b := 'A'; b <= 'Z'; b++ {
+			code := string([]rune{a, b})
+			region, err := language.ParseRegion(code)
+			// Deprecated codes such as "UK" canonicalize to another one and are left out
+			if err != nil || !region.IsCountry() || region.Canonicalize().String() != code {
+				continue
+			}
+			countryNames[fold(namer.Name(region))] = code
+		}
+	}
+}
+
+// accentRemover drops combining marks after decomposition, so "Côte" becomes "Cote"
+var accentRemover = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// fold makes names comparable: lower case, no accents or punctuation, "&" spelled "and", single spaces
+func fold(s string) string {
+	s, _, err := transform.String(accentRemover, s)
+	if err != nil {
+		return ""
+	}
+	s = strings.ReplaceAll(strings.ToLower(s), "&", " and ")
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == ',':
+			b.WriteRune(' ')
+		}
+		// Other punctuation such as the dots in "U.S." or apostrophes is dropped
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,83 @@
+package postal
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCountry(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{"US", "US", true},
+		{"us", "US", true},
+		{"USA", "US", true},
+		{"U.S.", "US", true},
+		{"840", "US", true},
+		{"United States of America", "US", true},
+		{"uk", "GB", true},
+		{"England", "GB", true},
+		{"Deutschland", "DE", true},
+		{"germany", "DE", true},
+		{"España", "ES", true},
+		{"Korea", "KR", true},
+		{"Côte d'Ivoire", "CI", true},
+		{"Bosnia & Herzegovina", "BA", true},
+		{"  the   netherlands ", "NL", true},
+		{"Ireland", "IE", true},
+		{"Atlantis", "", false},
+		{"EU", "", false}, // A region, not a country
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := NormalizeCountry(tt.input)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("NormalizeCountry(%q) = %q, %v; want %q, %v", tt.input, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// migrationMapping matches the statements of migration 004 that map a list of spellings to a code
+var migrationMapping = regexp.MustCompile(`(?s)SET country = '([A-Z]{2})'\s+WHERE [^;]*? IN \(([^)]*)\)`)
+
+// Stored addresses were normalized by migration 004; the validator must agree with every spelling it
+// mapped, or addresses that were fine on disk get rejected on their next update
+func TestMigrationCountryAliasesMatchValidator(t *testing.T) {
+	sql, err := os.ReadFile("../../migrations/004_normalize_countries.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+
+	mappings := migrationMapping.FindAllStringSubmatch(string(sql), -1)
+	if len(mappings) == 0 {
+		t.Fatal("no country mappings found in migration 004")
+	}
+
+	for _, m := range mappings {
+		code := m[1]
+		for _, quoted := range strings.Split(m[2], ",") {
+			spelling := strings.Trim(strings.TrimSpace(quoted), "'")
+			if got, ok := NormalizeCountry(spelling); !ok || got != code {
+				t.Errorf("migration maps %q to %s, NormalizeCountry gives %q, %v", spelling, code, got, ok)
+			}
+		}
+	}
+}
+
+func TestCountryAliasesAreFolded(t *testing.T) {
+	for alias, code := range countryAliases {
+		if fold(alias) != alias {
+			t.Errorf("alias %q is not in folded form %q and can never match", alias, fold(alias))
+		}
+		if CountryName(code) == code {
+			t.Errorf("alias %q maps to unknown code %s", alias, code)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package postal
+
+import (
+	"regexp"
+	"strings"
+)
+
+// countryRules describes what a valid address looks like in one country
+type countryRules struct {
+	postalPattern *regexp.Regexp      // Valid postal codes after formatting; nil if the country has none
+	postalExample string              // Shown in error messages
+	formatPostal  func(string) string // Brings a postal code into its canonical spelling; nil uppercases it
+	subdivisions  map[string]string   // State or province codes and their names; nil accepts any state
+	stateRequired bool                // Whether an address needs a state or province
+	noPostalCodes bool                // The country does not use postal codes
+}
+
+// rules covers the countries we ship to most. A postal code is required only where a pattern says what
+// one looks like; elsewhere (Ireland, most of Africa, ...) many addresses have none, so it is optional
+// and only uppercased.
+var rules = map[string]countryRules{
+	"US": {
+		postalPattern: regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+		postalExample: "12345 or 12345-6789",
+		formatPostal:  splitDigitsAt(5, "-", 9),
+		subdivisions:  usStates,
+		stateRequired: true,
+	},
+	"CA": {
+		postalPattern: regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z] \d[ABCEGHJ-NPRSTV-Z]\d$`),
+		postalExample: "K1A 0B1",
+		formatPostal:  spaceBeforeLast(3),
+		subdivisions:  caProvinces,
+		stateRequired: true,
+	},
+	"AU": {
+		postalPattern: regexp.MustCompile(`^\d{4}$`),
+		postalExample: "2000",
+		subdivisions:  auStates,
+		stateRequired: true,
+	},
+	"GB": {
+		postalPattern: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? \d[A-Z]{2}$`),
+		postalExample: "SW1A 1AA",
+		formatPostal:  spaceBeforeLast(3),
+	},
+	"NL": {
+		postalPattern: regexp.MustCompile(`^[1-9]\d{3} [A-Z]{2}$`),
+		postalExample: "1012 JS",
+		formatPostal:  spaceBeforeLast(2),
+	},
+	"JP": {
+		postalPattern: regexp.MustCompile(`^\d{3}-\d{4}$`),
+		postalExample: "100-0001",
+		formatPostal:  splitDigitsAt(3, "-", 7),
+	},
+	"BR": {
+		postalPattern: regexp.MustCompile(`^\d{5}-\d{3}$`),
+		postalExample: "01310-100",
+		formatPostal:  splitDigitsAt(5, "-", 8),
+	},
+	"IN": {
+		postalPattern: regexp.MustCompile(`^[1-9]\d{5}$`),
+		postalExample: "110001",
+	},
+	"DE": fiveDigits("10115"),
+	"FR": fiveDigits("75001"),
+	"ES": fiveDigits("28001"),
+	"IT": fiveDigits("00118"),
+	"MX": fiveDigits("06000"),
+	"CH": {
+		postalPattern: regexp.MustCompile(`^\d{4}$`),
+		postalExample: "8001",
+	},
+	"AE": {noPostalCodes: true},
+	"HK": {noPostalCodes: true},
+}
+
+func fiveDigits(example string) countryRules {
+	return countryRules{
+		postalPattern: regexp.MustCompile(`^\d{5}$`),
+		postalExample: example,
+	}
+}
+
+// spaceBeforeLast formats codes like "k1a0b1" as "K1A 0B1", with a space before the last n characters
+func spaceBeforeLast(n int) func(string) string {
+	return func(code string) string {
+		code = strings.ToUpper(strings.Join(strings.Fields(code), ""))
+		if len(code) <= n {
+			return code
+		}
+		return code[:len(code)-n] + " " + code[len(code)-n:]
+	}
+}
+
+// splitDigitsAt formats a code of exactly total digits, e.g. "123456789" as "12345-6789"
+func splitDigitsAt(at int, sep string, total int) func(string) string {
+	return func(code string) string {
+		code = strings.Join(strings.Fields(code), "")
+		if len(code) != total || strings.Trim(code, "0123456789") != "" {
+			return code
+		}
+		return code[:at] + sep + code[at:]
+	}
+}
+
+var usStates = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California",
+	"CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "FL": "Florida", "GA": "Georgia",
+	"HI": "Hawaii", "ID": "Idaho", "IL": "Illinois", "IN": "Indiana", "IA": "Iowa",
+	"KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana", "ME": "Maine", "MD": "Maryland",
+	"MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota", "MS": "Mississippi", "MO": "Missouri",
+	"MT": "Montana", "NE": "Nebraska", "NV": "Nevada", "NH": "New Hampshire", "NJ": "New Jersey",
+	"NM": "New Mexico", "NY": "New York", "NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio",
+	"OK": "Oklahoma", "OR": "Oregon", "PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina",
+	"SD": "South Dakota", "TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont",
+	"VA": "Virginia", "WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+	"DC": "District of Columbia",
+	"AS": "American Samoa", "GU": "Guam", "MP": "Northern Mariana Islands", "PR": "Puerto Rico", "VI": "U.S. Virgin Islands",
+	"AA": "Armed Forces Americas", "AE": "Armed Forces Europe", "AP": "Armed Forces Pacific",
+}
+
+var caProvinces = map[string]string{
+	"AB": "Alberta", "BC": "British Columbia", "MB": "Manitoba", "NB": "New Brunswick",
+	"NL": "Newfoundland and Labrador", "NS": "Nova Scotia", "NT": "Northwest Territories", "NU": "Nunavut",
+	"ON": "Ontario", "PE": "Prince Edward Island", "QC": "Quebec", "SK": "Saskatchewan", "YT": "Yukon",
+}
+
+var auStates = map[string]string{
+	"ACT": "Australian Capital Territory", "NSW": "New South Wales", "NT": "Northern Territory", "QLD": "Queensland",
+	"SA": "South Australia", "TAS": "Tasmania", "VIC": "Victoria", "WA": "Western Australia",
+}
+
+// normalizeSubdivision returns the code of a state or province given as a code or a name
+func normalizeSubdivision(subdivisions map[string]string, state string) (string, bool) {
+	if _, ok := subdivisions[strings.ToUpper(state)]; ok {
+		return strings.ToUpper(state), true
+	}
+
+	folded := fold(state)
+	for code, name := range subdivisions {
+		if fold(name) == folded {
+			return code, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,134 @@
+// Package postal normalizes and validates postal addresses: ISO 3166 countries, per-country postal code
+// and state rules, and optional verification against an external address provider.
+package postal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"user-service/internal/models"
+)
+
+// Suggestion is a correction the user may want to apply to an address that was otherwise accepted
+type Suggestion struct {
+	Field   string // "street", "city", "state", "postal_code" or "country"
+	Value   string // Suggested value
+	Message string // Human-readable reason
+}
+
+// Provider verifies normalized addresses against an external source of truth.
+// It returns corrections rather than errors for addresses it knows better; err is for provider failures.
+type Provider interface {
+	Verify(ctx context.Context, address models.Address) ([]Suggestion, error)
+}
+
+// ValidationError lists everything wrong with an address
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validator normalizes addresses and rejects those that cannot be right
+type Validator struct {
+	provider Provider // May be nil
+}
+
+// NewValidator creates a validator; provider may be nil to skip external verification
+func NewValidator(provider Provider) *Validator {
+	return &Validator{provider: provider}
+}
+
+// Validate normalizes the address in place: country as ISO 3166-1 alpha-2 code, postal code and
+// state in their usual spelling. Invalid addresses return a *ValidationError. Valid ones are checked
+// with the provider, whose suggestions are returned; if the provider fails the address is accepted
+// unverified.
+func (v *Validator) Validate(ctx context.Context, address *models.Address) ([]Suggestion, error) {
+	address.Street = collapseSpaces(address.Street)
+	address.City = collapseSpaces(address.City)
+	address.State = collapseSpaces(address.State)
+	address.PostalCode = strings.ToUpper(collapseSpaces(address.PostalCode))
+
+	invalid := &ValidationError{}
+	if address.Street == "" {
+		invalid.Problems = append(invalid.Problems, "street is required")
+	}
+	if address.City == "" {
+		invalid.Problems = append(invalid.Problems, "city is required")
+	}
+
+	country, ok := NormalizeCountry(address.Country)
+	switch {
+	case strings.TrimSpace(address.Country) == "":
+		invalid.Problems = append(invalid.Problems, "country is required")
+	case !ok:
+		invalid.Problems = append(invalid.Problems, fmt.Sprintf("unknown country %q, use an ISO 3166 code such as US", address.Country))
+	default:
+		address.Country = country
+		invalid.Problems = append(invalid.Problems, checkCountryRules(address)...)
+	}
+
+	if len(invalid.Problems) > 0 {
+		return nil, invalid
+	}
+
+	if v.provider == nil {
+		return nil, nil
+	}
+
+	suggestions, err := v.provider.Verify(ctx, *address)
+	if err != nil {
+		log.Printf("Address verification failed, accepting the address unverified: %v", err)
+		return nil, nil
+	}
+	return suggestions, nil
+}
+
+// checkCountryRules formats the postal code and state of an address in a known country and reports
+// what does not fit the country's rules
+func checkCountryRules(address *models.Address) []string {
+	countryRules, known := rules[address.Country]
+	var problems []string
+
+	switch {
+	case countryRules.noPostalCodes:
+		// Forms often force something into the field; it means nothing here
+		address.PostalCode = ""
+	case !known || countryRules.postalPattern == nil:
+		// Not known to use postal codes everywhere: take one if given, never require it
+	case address.PostalCode == "":
+		problems = append(problems, "postal code is required")
+	default:
+		if countryRules.formatPostal != nil {
+			address.PostalCode = countryRules.formatPostal(address.PostalCode)
+		}
+		if !countryRules.postalPattern.MatchString(address.PostalCode) {
+			problems = append(problems, fmt.Sprintf("postal code %q is not valid in %s, expected a code like %s",
+				address.PostalCode, CountryName(address.Country), countryRules.postalExample))
+		}
+	}
+
+	switch {
+	case address.State == "":
+		if countryRules.stateRequired {
+			problems = append(problems, fmt.Sprintf("state or province is required in %s", CountryName(address.Country)))
+		}
+	case countryRules.subdivisions != nil:
+		code, ok := normalizeSubdivision(countryRules.subdivisions, address.State)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown state or province %q in %s", address.State, CountryName(address.Country)))
+		} else {
+			address.State = code
+		}
+	}
+
+	return problems
+}
+
+// collapseSpaces trims s and replaces every run of whitespace with a single space
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,135 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"user-service/internal/models"
+)
+
+func TestValidatorValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     models.Address
+		want        models.Address // Normalized address, compared when the address is valid
+		wantProblem string         // Substring of the expected error; empty if the address is valid
+	}{
+		{
+			name:    "US address is normalized",
+			address: models.Address{Street: " 1  Main St ", City: "Springfield", State: "illinois", PostalCode: "627011234", Country: "usa"},
+			want:    models.Address{Street: "1 Main St", City: "Springfield", State: "IL", PostalCode: "62701-1234", Country: "US"},
+		},
+		{
+			name:        "US postal code is required",
+			address:     models.Address{Street: "1 Main St", City: "Springfield", State: "IL", Country: "US"},
+			wantProblem: "postal code is required",
+		},
+		{
+			name:        "US postal code must fit",
+			address:     models.Address{Street: "1 Main St", City: "Springfield", State: "IL", PostalCode: "6270", Country: "US"},
+			wantProblem: "expected a code like 12345",
+		},
+		{
+			name:        "US state is required",
+			address:     models.Address{Street: "1 Main St", City: "Springfield", PostalCode: "62701", Country: "US"},
+			wantProblem: "state or province is required",
+		},
+		{
+			name:        "unknown US state",
+			address:     models.Address{Street: "1 Main St", City: "Springfield", State: "Ontario", PostalCode: "62701", Country: "US"},
+			wantProblem: `unknown state or province "Ontario"`,
+		},
+		{
+			name:    "Canadian postal code gets its space",
+			address: models.Address{Street: "24 Sussex Dr", City: "Ottawa", State: "ON", PostalCode: "k1m1m4", Country: "Canada"},
+			want:    models.Address{Street: "24 Sussex Dr", City: "Ottawa", State: "ON", PostalCode: "K1M 1M4", Country: "CA"},
+		},
+		{
+			name:    "German address by its own name",
+			address: models.Address{Street: "Unter den Linden 1", City: "Berlin", PostalCode: "10117", Country: "Deutschland"},
+			want:    models.Address{Street: "Unter den Linden 1", City: "Berlin", PostalCode: "10117", Country: "DE"},
+		},
+		{
+			name:    "Irish address without an Eircode",
+			address: models.Address{Street: "1 Main Street", City: "Dingle", Country: "Ireland"},
+			want:    models.Address{Street: "1 Main Street", City: "Dingle", Country: "IE"},
+		},
+		{
+			name:    "Irish address with an Eircode",
+			address: models.Address{Street: "1 Main Street", City: "Dublin", PostalCode: "d02 x285", Country: "IE"},
+			want:    models.Address{Street: "1 Main Street", City: "Dublin", PostalCode: "D02 X285", Country: "IE"},
+		},
+		{
+			name:    "postal code dropped where there are none",
+			address: models.Address{Street: "1 Queen's Road", City: "Hong Kong", PostalCode: "00000", Country: "HK"},
+			want:    models.Address{Street: "1 Queen's Road", City: "Hong Kong", Country: "HK"},
+		},
+		{
+			name:    "South Korean address",
+			address: models.Address{Street: "110 Sejong-daero", City: "Seoul", PostalCode: "04524", Country: "Korea"},
+			want:    models.Address{Street: "110 Sejong-daero", City: "Seoul", PostalCode: "04524", Country: "KR"},
+		},
+		{
+			name:        "unknown country",
+			address:     models.Address{Street: "1 Main St", City: "Poseidonis", Country: "Atlantis"},
+			wantProblem: `unknown country "Atlantis"`,
+		},
+		{
+			name:        "everything missing",
+			address:     models.Address{},
+			wantProblem: "street is required; city is required; country is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := tt.address
+			_, err := NewValidator(nil).Validate(context.Background(), &address)
+
+			if tt.wantProblem != "" {
+				var invalid *ValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("Validate error = %v, want a ValidationError", err)
+				}
+				if !strings.Contains(err.Error(), tt.wantProblem) {
+					t.Errorf("Validate error = %q, want it to mention %q", err, tt.wantProblem)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if address != tt.want {
+				t.Errorf("normalized address = %+v, want %+v", address, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostalFormatters(t *testing.T) {
+	tests := []struct {
+		name   string
+		format func(string) string
+		in     string
+		want   string
+	}{
+		{"space before last 3", spaceBeforeLast(3), "sw1a1aa", "SW1A 1AA"},
+		{"space before last 3, spaced already", spaceBeforeLast(3), "SW1A 1AA", "SW1A 1AA"},
+		{"space before last 3, too short", spaceBeforeLast(3), "ab", "AB"},
+		{"space before last 2", spaceBeforeLast(2), "1012js", "1012 JS"},
+		{"ZIP+4", splitDigitsAt(5, "-", 9), "627011234", "62701-1234"},
+		{"ZIP+4 with separator", splitDigitsAt(5, "-", 9), "62701-1234", "62701-1234"},
+		{"ZIP", splitDigitsAt(5, "-", 9), "62701", "62701"},
+		{"not all digits", splitDigitsAt(3, "-", 7), "100a001", "100a001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format(tt.in); got != tt.want {
+				t.Errorf("format(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"user-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// PreferencesRepository stores user preferences
+type PreferencesRepository interface {
+	// GetPreferences returns the stored preferences, or nil if the user never changed any
+	GetPreferences(userID string) (*models.Preferences, error)
+	// UpdatePreferences loads the user's preferences (the defaults if none are stored), lets update change
+	// them and saves the result. The user is locked meanwhile, so concurrent partial updates do not
+	// overwrite each other. A nil result means there is no such user.
+	UpdatePreferences(userID string, update func(*models.Preferences) error) (*models.Preferences, error)
+}
+
+// PostgresPreferencesRepository implements PreferencesRepository for PostgreSQL
+type PostgresPreferencesRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresPreferencesRepository creates a new PostgreSQL preferences repository
+func NewPostgresPreferencesRepository(db *sql.DB) PreferencesRepository {
+	return &PostgresPreferencesRepository{db: db}
+}
+
+// preferencesColumns is the column list matching scanPreferences
+const preferencesColumns = `user_id, locale, currency, timezone, marketing_email, marketing_sms, notification_channels, updated_at`
+
+func scanPreferences(row rowScanner) (*models.Preferences, error) {
+	prefs := &models.Preferences{}
+	err := row.Scan(
+		&prefs.UserID,
+		&prefs.Locale,
+		&prefs.Currency,
+		&prefs.Timezone,
+		&prefs.MarketingEmail,
+		&prefs.MarketingSMS,
+		pq.Array(&prefs.NotificationChannels),
+		&prefs.UpdatedAt,
+	)
+	return prefs, err
+}
+
+func (r *PostgresPreferencesRepository) GetPreferences(userID string) (*models.Preferences, error) {
+	query := `SELECT ` + preferencesColumns + ` FROM user_preferences WHERE user_id = $1`
+
+	prefs, err := scanPreferences(r.db.QueryRow(query, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return prefs, err
+}
+
+func (r *PostgresPreferencesRepository) UpdatePreferences(userID string, update func(*models.Preferences) error) (*models.Preferences, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(`SELECT id FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := scanPreferences(tx.QueryRow(`SELECT `+preferencesColumns+` FROM user_preferences WHERE user_id = $1`, userID))
+	if err == sql.ErrNoRows {
+		prefs = models.DefaultPreferences(userID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := update(prefs); err != nil {
+		return nil, err
+	}
+	prefs.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO user_preferences (` + preferencesColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE SET
+			locale = EXCLUDED.locale,
+			currency = EXCLUDED.currency,
+			timezone = EXCLUDED.timezone,
+			marketing_email = EXCLUDED.marketing_email,
+			marketing_sms = EXCLUDED.marketing_sms,
+			notification_channels = EXCLUDED.notification_channels,
+			updated_at = EXCLUDED.updated_at`
+
+	_, err = tx.Exec(query, prefs.UserID, prefs.Locale, prefs.Currency, prefs.Timezone,
+		prefs.MarketingEmail, prefs.MarketingSMS, pq.Array(prefs.NotificationChannels), prefs.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return prefs, tx.Commit()
+}
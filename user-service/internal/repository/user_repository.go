@@ -2,6 +2,8 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"user-service/internal/models"
@@ -12,13 +14,29 @@ import (
 // UserRepository defines the interface for user data operations
 // Using an interface allows us to easily mock this for testing
 type UserRepository interface {
-	CreateUser(user *models.User) error
+	// CreateUser inserts the user; false means a user with this ID already exists and nothing was written
+	CreateUser(user *models.User) (bool, error)
 	GetUserByID(userID string) (*models.User, error)
-	UpdateUser(user *models.User) error
+	// UpdateUser saves the name and phone if the stored profile is still at user.Version, then increments it;
+	// false means the profile changed or was deleted meanwhile and nothing was written
+	UpdateUser(user *models.User) (bool, error)
+	UpdateEmail(user *models.User) error
 	DeleteUser(userID string) error
+	UndeleteUser(userID string) error
+	PurgeUser(userID string) error
+	ListUserIDs(afterID string, limit int) ([]string, error)
+	// ListUsers returns one page of users matching the query and how many users match across all pages
+	ListUsers(query UserListQuery) ([]*models.User, int, error)
 
+	// AddAddress inserts an address; the user's first shipping and first billing address always become the defaults
 	AddAddress(address *models.Address) error
 	GetAddressesByUserID(userID string) ([]*models.Address, error)
+	GetAddressByID(userID, addressID string) (*models.Address, error)
+	UpdateAddress(address *models.Address) error
+	// DeleteAddress removes an address; false means the user has no such address
+	DeleteAddress(userID, addressID string) (bool, error)
+	// SetDefaultAddress makes one address the default shipping and/or billing address; false means the user has no such address
+	SetDefaultAddress(userID, addressID string, shipping, billing bool) (bool, error)
 }
 
 // PostgresUserRepository implements UserRepository for PostgreSQL
@@ -32,7 +50,7 @@ func NewPostgresUserRepository(db *sql.DB) UserRepository {
 }
 
 // CreateUser inserts a new user into the database
-func (r *PostgresUserRepository) CreateUser(user *models.User) error {
+func (r *PostgresUserRepository) CreateUser(user *models.User) (bool, error) {
 	// Generate a new UUID for the user if not provided
 	if user.ID == "" {
 		user.ID = uuid.New().String()
@@ -41,36 +59,31 @@ func (r *PostgresUserRepository) CreateUser(user *models.User) error {
 	now := time.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
+	user.Version = 1
 
 	query := `
 		INSERT INTO users (id, email, name, phone, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING
 	`
 
-	_, err := r.db.Exec(query, user.ID, user.Email, user.Name, user.Phone, user.CreatedAt, user.UpdatedAt)
-	return err
+	result, err := r.db.Exec(query, user.ID, user.Email, user.Name, user.Phone, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
 }
 
 // GetUserByID retrieves a user by their ID
 func (r *PostgresUserRepository) GetUserByID(userID string) (*models.User, error) {
-	user := &models.User{}
-
-	query := `
-		SELECT id, email, name, phone, created_at, updated_at, deleted_at
-		FROM users
-		WHERE id = $1 AND deleted_at IS NULL
-	`
-
-	err := r.db.QueryRow(query, userID).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Name,
-		&user.Phone,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.DeletedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
 
+	user, err := scanUser(r.db.QueryRow(query, userID))
 	if err == sql.ErrNoRows {
 		return nil, nil // User not found
 	}
@@ -79,26 +92,317 @@ func (r *PostgresUserRepository) GetUserByID(userID string) (*models.User, error
 }
 
 // UpdateUser updates an existing user's information
-func (r *PostgresUserRepository) UpdateUser(user *models.User) error {
+func (r *PostgresUserRepository) UpdateUser(user *models.User) (bool, error) {
+	updatedAt := time.Now()
+
+	query := `
+		UPDATE users SET name = $1, phone = $2, updated_at = $3, version = version + 1
+		WHERE id = $4 AND version = $5 AND deleted_at IS NULL
+		RETURNING version`
+
+	err := r.db.QueryRow(query, user.Name, user.Phone, updatedAt, user.ID, user.Version).Scan(&user.Version)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	user.UpdatedAt = updatedAt
+	return true, nil
+}
+
+// UpdateEmail changes a user's email address
+func (r *PostgresUserRepository) UpdateEmail(user *models.User) error {
 	user.UpdatedAt = time.Now()
 
 	query := `
-		UPDATE users SET name = $1, phone = $2, updated_at = $3 WHERE id = $4`
+		UPDATE users SET email = $1, updated_at = $2, version = version + 1 WHERE id = $3
+		RETURNING version`
 
-	_, err := r.db.Exec(query, user.Name, user.Phone, user.UpdatedAt, user.ID)
-	return err
+	return r.db.QueryRow(query, user.Email, user.UpdatedAt, user.ID).Scan(&user.Version)
 }
 
 // DeleteUser performs a soft delete on a user
 func (r *PostgresUserRepository) DeleteUser(userID string) error {
 	deleted_at := time.Now()
 	query := `
-	UPDATE users SET deleted_at = $1 WHERE id = $2`
+	UPDATE users SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`
 
 	_, err := r.db.Exec(query, deleted_at, userID)
 	return err
 }
 
+// UndeleteUser restores a soft-deleted user
+func (r *PostgresUserRepository) UndeleteUser(userID string) error {
+	query := `
+	UPDATE users SET deleted_at = NULL, updated_at = $1 WHERE id = $2 AND deleted_at IS NOT NULL`
+
+	_, err := r.db.Exec(query, time.Now(), userID)
+	return err
+}
+
+// PurgeUser removes a user and their addresses for good
+func (r *PostgresUserRepository) PurgeUser(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM users WHERE id = $1`, userID)
+	return err
+}
+
+// ListUserIDs returns up to limit user IDs after afterID, soft-deleted users included.
+// IDs are compared byte by byte so other services can merge the list with their own.
+func (r *PostgresUserRepository) ListUserIDs(afterID string, limit int) ([]string, error) {
+	query := `
+		SELECT id FROM users WHERE id > $1 COLLATE "C" ORDER BY id COLLATE "C" LIMIT $2`
+
+	rows, err := r.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Orders ListUsers can sort by
+const (
+	UserSortCreatedAt = "created_at"
+	UserSortEmail     = "email"
+	UserSortName      = "name"
+)
+
+// UserListQuery filters, sorts and pages ListUsers
+type UserListQuery struct {
+	EmailPrefix    string     // Case-insensitive
+	NamePrefix     string     // Case-insensitive
+	CreatedAfter   *time.Time // Inclusive
+	CreatedBefore  *time.Time // Exclusive
+	IncludeDeleted bool
+	SortBy         string // UserSortCreatedAt, UserSortEmail or UserSortName
+	Descending     bool
+	After          *UserCursor // Last user of the previous page; nil for the first page
+	Limit          int
+}
+
+// UserCursor is the position of a user in a sorted list: its sort value and, to break ties, its ID.
+// Creation times are in RFC 3339 format with nanoseconds.
+type UserCursor struct {
+	Value string
+	ID    string
+}
+
+// ListUsers pages with the cursor instead of an offset, so pages stay stable while users sign up
+func (r *PostgresUserRepository) ListUsers(query UserListQuery) ([]*models.User, int, error) {
+	switch query.SortBy {
+	case UserSortCreatedAt, UserSortEmail, UserSortName:
+	default:
+		return nil, 0, fmt.Errorf("unknown sort order %q", query.SortBy)
+	}
+
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !query.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if query.EmailPrefix != "" {
+		conditions = append(conditions, fmt.Sprintf(`lower(email) LIKE %s ESCAPE '\'`, arg(likePrefix(query.EmailPrefix))))
+	}
+	if query.NamePrefix != "" {
+		conditions = append(conditions, fmt.Sprintf(`lower(name) LIKE %s ESCAPE '\'`, arg(likePrefix(query.NamePrefix))))
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*query.CreatedAfter))
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*query.CreatedBefore))
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM users"+whereClause(conditions), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if query.After != nil {
+		var value any = query.After.Value
+		if query.SortBy == UserSortCreatedAt {
+			createdAt, err := time.Parse(time.RFC3339Nano, query.After.Value)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid cursor: %w", err)
+			}
+			value = createdAt
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", query.SortBy, comparison, arg(value), arg(query.After.ID)))
+	}
+
+	rows, err := r.db.Query(
+		fmt.Sprintf("SELECT %s FROM users%s ORDER BY %s %s, id %s LIMIT %s",
+			userColumns, whereClause(conditions), query.SortBy, direction, direction, arg(query.Limit)),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// whereClause joins conditions with AND; no conditions give an empty clause
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// likePrefix turns a prefix into a lower-case LIKE pattern, escaping the LIKE wildcards it contains
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
+
+// userColumns is the column list matching scanUser
+const userColumns = `id, email, name, phone, created_at, updated_at, deleted_at, version`
+
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.Phone,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.DeletedAt,
+		&user.Version,
+	)
+	return user, err
+}
+
+// addressColumns is the column list matching scanAddress
+const addressColumns = `id, user_id, type, label, recipient_name, phone, street, city, state, postal_code, country,
+	is_default_shipping, is_default_billing, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAddress(row rowScanner) (*models.Address, error) {
+	addr := &models.Address{}
+	err := row.Scan(
+		&addr.ID,
+		&addr.UserID,
+		&addr.Type,
+		&addr.Label,
+		&addr.RecipientName,
+		&addr.Phone,
+		&addr.Street,
+		&addr.City,
+		&addr.State,
+		&addr.PostalCode,
+		&addr.Country,
+		&addr.IsDefaultShipping,
+		&addr.IsDefaultBilling,
+		&addr.CreatedAt,
+	)
+	return addr, err
+}
+
+// addressPurpose is what a default address is chosen for: its flag column and the address types it applies to
+type addressPurpose struct {
+	column string
+	types  string
+}
+
+var (
+	shippingPurpose = addressPurpose{column: "is_default_shipping", types: "('shipping', 'both')"}
+	billingPurpose  = addressPurpose{column: "is_default_billing", types: "('billing', 'both')"}
+)
+
+// withUserLock runs fn in a transaction holding a lock on the user's row, so concurrent
+// changes to the same user's addresses cannot both pick a default
+func (r *PostgresUserRepository) withUserLock(userID string, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// clearDefaults unsets the user's default address for the purposes the address is the default for,
+// so that it can take over
+func clearDefaults(tx *sql.Tx, address *models.Address) error {
+	for _, p := range defaultPurposes(address.IsDefaultShipping, address.IsDefaultBilling) {
+		query := `UPDATE addresses SET ` + p.column + ` = FALSE WHERE user_id = $1 AND ` + p.column + ` AND id <> $2`
+		if _, err := tx.Exec(query, address.UserID, address.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureDefaults gives every purpose without a default address the newest address usable for it
+func ensureDefaults(tx *sql.Tx, userID string) error {
+	for _, p := range []addressPurpose{shippingPurpose, billingPurpose} {
+		query := `
+		UPDATE addresses SET ` + p.column + ` = TRUE
+		WHERE id = (SELECT id FROM addresses WHERE user_id = $1 AND type IN ` + p.types + ` ORDER BY created_at DESC, id DESC LIMIT 1)
+		AND NOT EXISTS (SELECT 1 FROM addresses WHERE user_id = $1 AND ` + p.column + `)`
+
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func defaultPurposes(shipping, billing bool) []addressPurpose {
+	var purposes []addressPurpose
+	if shipping {
+		purposes = append(purposes, shippingPurpose)
+	}
+	if billing {
+		purposes = append(purposes, billingPurpose)
+	}
+	return purposes
+}
+
 // AddAddress adds a new address for a user
 func (r *PostgresUserRepository) AddAddress(address *models.Address) error {
 	if address.ID == "" {
@@ -107,31 +411,56 @@ func (r *PostgresUserRepository) AddAddress(address *models.Address) error {
 
 	address.CreatedAt = time.Now()
 
-	query := `
-		INSERT INTO addresses (id, user_id, street, city, state, postal_code, country, is_default, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	return r.withUserLock(address.UserID, func(tx *sql.Tx) error {
+		if err := clearDefaults(tx, address); err != nil {
+			return err
+		}
+
+		query := `
+		INSERT INTO addresses (id, user_id, type, label, recipient_name, phone, street, city, state, postal_code, country,
+			is_default_shipping, is_default_billing, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 
-	_, err := r.db.Exec(query,
-		address.ID,
-		address.UserID,
-		address.Street,
-		address.City,
-		address.State,
-		address.PostalCode,
-		address.Country,
-		address.IsDefault,
-		address.CreatedAt,
-	)
+		_, err := tx.Exec(query,
+			address.ID,
+			address.UserID,
+			address.Type,
+			address.Label,
+			address.RecipientName,
+			address.Phone,
+			address.Street,
+			address.City,
+			address.State,
+			address.PostalCode,
+			address.Country,
+			address.IsDefaultShipping,
+			address.IsDefaultBilling,
+			address.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
 
-	return err
+		if err := ensureDefaults(tx, address.UserID); err != nil {
+			return err
+		}
+		return reloadDefaults(tx, address)
+	})
+}
+
+// reloadDefaults reads back the default flags ensureDefaults may have changed
+func reloadDefaults(tx *sql.Tx, address *models.Address) error {
+	query := `SELECT is_default_shipping, is_default_billing FROM addresses WHERE id = $1`
+	return tx.QueryRow(query, address.ID).Scan(&address.IsDefaultShipping, &address.IsDefaultBilling)
 }
 
-// GetAddressesByUserID retrieves all addresses for a user
+// GetAddressesByUserID retrieves all addresses for a user, the defaults first
 func (r *PostgresUserRepository) GetAddressesByUserID(userID string) ([]*models.Address, error) {
 
 	query := `
-	SELECT id, user_id, street, city, state, postal_code, country, is_default, created_at FROM addresses WHERE user_id = $1
+	SELECT ` + addressColumns + ` FROM addresses WHERE user_id = $1
+	ORDER BY (is_default_shipping OR is_default_billing) DESC, created_at
 	`
 
 	rows, err := r.db.Query(query, userID)
@@ -144,8 +473,7 @@ func (r *PostgresUserRepository) GetAddressesByUserID(userID string) ([]*models.
 	addresses := []*models.Address{}
 
 	for rows.Next() {
-		addr := &models.Address{}
-		err := rows.Scan(&addr.ID, &addr.UserID, &addr.Street, &addr.City, &addr.State, &addr.PostalCode, &addr.Country, &addr.IsDefault, &addr.CreatedAt)
+		addr, err := scanAddress(rows)
 
 		if err != nil {
 			return nil, err
@@ -159,3 +487,113 @@ func (r *PostgresUserRepository) GetAddressesByUserID(userID string) ([]*models.
 
 	return addresses, nil
 }
+
+// GetAddressByID retrieves one of a user's addresses, or nil if the user has no such address
+func (r *PostgresUserRepository) GetAddressByID(userID, addressID string) (*models.Address, error) {
+	query := `SELECT ` + addressColumns + ` FROM addresses WHERE id = $1 AND user_id = $2`
+
+	addr, err := scanAddress(r.db.QueryRow(query, addressID, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return addr, err
+}
+
+// UpdateAddress saves every field of an address. Making it a default unsets the previous one; a purpose
+// left without a default (the address stopped being it, or changed type) falls to the newest address usable for it.
+func (r *PostgresUserRepository) UpdateAddress(address *models.Address) error {
+	return r.withUserLock(address.UserID, func(tx *sql.Tx) error {
+		if err := clearDefaults(tx, address); err != nil {
+			return err
+		}
+
+		query := `
+		UPDATE addresses SET type = $1, label = $2, recipient_name = $3, phone = $4, street = $5, city = $6, state = $7,
+			postal_code = $8, country = $9, is_default_shipping = $10, is_default_billing = $11
+		WHERE id = $12 AND user_id = $13`
+
+		_, err := tx.Exec(query,
+			address.Type,
+			address.Label,
+			address.RecipientName,
+			address.Phone,
+			address.Street,
+			address.City,
+			address.State,
+			address.PostalCode,
+			address.Country,
+			address.IsDefaultShipping,
+			address.IsDefaultBilling,
+			address.ID,
+			address.UserID,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := ensureDefaults(tx, address.UserID); err != nil {
+			return err
+		}
+		return reloadDefaults(tx, address)
+	})
+}
+
+// DeleteAddress removes an address; a default it leaves behind passes to the newest address usable for it
+func (r *PostgresUserRepository) DeleteAddress(userID, addressID string) (bool, error) {
+	deleted := false
+
+	err := r.withUserLock(userID, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM addresses WHERE id = $1 AND user_id = $2`, addressID, userID)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return nil
+		}
+		deleted = true
+
+		return ensureDefaults(tx, userID)
+	})
+
+	return deleted, err
+}
+
+// SetDefaultAddress makes the address the user's default for shipping and/or billing, unsetting the previous ones
+func (r *PostgresUserRepository) SetDefaultAddress(userID, addressID string, shipping, billing bool) (bool, error) {
+	err := r.withUserLock(userID, func(tx *sql.Tx) error {
+		address := &models.Address{ID: addressID, UserID: userID, IsDefaultShipping: shipping, IsDefaultBilling: billing}
+		if err := clearDefaults(tx, address); err != nil {
+			return err
+		}
+
+		query := `
+		UPDATE addresses SET is_default_shipping = is_default_shipping OR $1, is_default_billing = is_default_billing OR $2
+		WHERE id = $3 AND user_id = $4`
+
+		result, err := tx.Exec(query, shipping, billing, addressID, userID)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			// Unknown address: roll back so the previous defaults stay
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
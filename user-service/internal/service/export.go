@@ -0,0 +1,122 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+	"user-service/internal/models"
+)
+
+// UserExport is everything user-service stores about a user, in the form it takes in a data export.
+// The JSON names are part of the export format, so fields are only ever added.
+type UserExport struct {
+	ExportedAt  time.Time         `json:"exported_at"`
+	Profile     ProfileExport     `json:"profile"`
+	Addresses   []AddressExport   `json:"addresses"`
+	Preferences PreferencesExport `json:"preferences"`
+}
+
+type ProfileExport struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type AddressExport struct {
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	Label             string    `json:"label"`
+	RecipientName     string    `json:"recipient_name"`
+	Phone             string    `json:"phone"`
+	Street            string    `json:"street"`
+	City              string    `json:"city"`
+	State             string    `json:"state"`
+	PostalCode        string    `json:"postal_code"`
+	Country           string    `json:"country"`
+	IsDefaultShipping bool      `json:"is_default_shipping"`
+	IsDefaultBilling  bool      `json:"is_default_billing"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type PreferencesExport struct {
+	Locale               string     `json:"locale"`
+	Currency             string     `json:"currency"`
+	Timezone             string     `json:"timezone"`
+	MarketingEmail       bool       `json:"marketing_email"`
+	MarketingSMS         bool       `json:"marketing_sms"`
+	NotificationChannels []string   `json:"notification_channels"`
+	UpdatedAt            *time.Time `json:"updated_at"` // null while the user has the defaults
+}
+
+// ExportUserData returns the user's profile, addresses and preferences as indented JSON,
+// for auth-service to put into the user's data export
+func (s *UserService) ExportUserData(userID string) ([]byte, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := s.repo.GetAddressesByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := s.GetPreferences(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := UserExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: ProfileExport{
+			ID:        user.ID,
+			Email:     user.Email,
+			Name:      user.Name,
+			Phone:     user.Phone,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+		Addresses:   make([]AddressExport, 0, len(addresses)),
+		Preferences: preferencesExport(prefs),
+	}
+	for _, addr := range addresses {
+		export.Addresses = append(export.Addresses, AddressExport{
+			ID:                addr.ID,
+			Type:              addr.Type,
+			Label:             addr.Label,
+			RecipientName:     addr.RecipientName,
+			Phone:             addr.Phone,
+			Street:            addr.Street,
+			City:              addr.City,
+			State:             addr.State,
+			PostalCode:        addr.PostalCode,
+			Country:           addr.Country,
+			IsDefaultShipping: addr.IsDefaultShipping,
+			IsDefaultBilling:  addr.IsDefaultBilling,
+			CreatedAt:         addr.CreatedAt,
+		})
+	}
+
+	return json.MarshalIndent(export, "", "  ")
+}
+
+func preferencesExport(prefs *models.Preferences) PreferencesExport {
+	export := PreferencesExport{
+		Locale:               prefs.Locale,
+		Currency:             prefs.Currency,
+		Timezone:             prefs.Timezone,
+		MarketingEmail:       prefs.MarketingEmail,
+		MarketingSMS:         prefs.MarketingSMS,
+		NotificationChannels: prefs.NotificationChannels,
+	}
+	if export.NotificationChannels == nil {
+		export.NotificationChannels = []string{}
+	}
+	if !prefs.UpdatedAt.IsZero() {
+		updatedAt := prefs.UpdatedAt
+		export.UpdatedAt = &updatedAt
+	}
+	return export
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"user-service/internal/models"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+)
+
+// PreferenceFields are the preferences UpdatePreferences can change, by their API names
+var PreferenceFields = []string{"locale", "currency", "timezone", "marketing_email", "marketing_sms", "notification_channels"}
+
+// GetPreferences returns the user's preferences, or the defaults if the user never changed any
+func (s *UserService) GetPreferences(userID string) (*models.Preferences, error) {
+	if _, err := s.GetUser(userID); err != nil {
+		return nil, err
+	}
+
+	prefs, err := s.preferences.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		return models.DefaultPreferences(userID), nil
+	}
+
+	return prefs, nil
+}
+
+// UpdatePreferences copies the listed fields of values onto the user's preferences, checking each
+// against its schema; the others keep their current value. An empty list updates every field.
+func (s *UserService) UpdatePreferences(userID string, values models.Preferences, fields []string) (*models.Preferences, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+	if len(fields) == 0 {
+		fields = PreferenceFields
+	}
+
+	// Check everything before taking the lock
+	if err := normalizePreferences(&values, fields); err != nil {
+		return nil, err
+	}
+
+	prefs, err := s.preferences.UpdatePreferences(userID, func(prefs *models.Preferences) error {
+		for _, field := range fields {
+			switch field {
+			case "locale":
+				prefs.Locale = values.Locale
+			case "currency":
+				prefs.Currency = values.Currency
+			case "timezone":
+				prefs.Timezone = values.Timezone
+			case "marketing_email":
+				prefs.MarketingEmail = values.MarketingEmail
+			case "marketing_sms":
+				prefs.MarketingSMS = values.MarketingSMS
+			case "notification_channels":
+				prefs.NotificationChannels = values.NotificationChannels
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		return nil, errors.New("user not found")
+	}
+
+	return prefs, nil
+}
+
+// normalizePreferences validates the listed fields and puts them in canonical form,
+// e.g. locale "en_us" becomes "en-US" and currency "eur" becomes "EUR"
+func normalizePreferences(prefs *models.Preferences, fields []string) error {
+	for _, field := range fields {
+		switch field {
+		case "locale":
+			tag, err := language.Parse(strings.ReplaceAll(strings.TrimSpace(prefs.Locale), "_", "-"))
+			if err != nil || tag == language.Und {
+				return fmt.Errorf("locale %q is not a valid language tag such as en-US", prefs.Locale)
+			}
+			prefs.Locale = tag.String()
+		case "currency":
+			unit, err := currency.ParseISO(strings.ToUpper(strings.TrimSpace(prefs.Currency)))
+			if err != nil {
+				return fmt.Errorf("currency %q is not an ISO 4217 code such as USD", prefs.Currency)
+			}
+			prefs.Currency = unit.String()
+		case "timezone":
+			name := strings.TrimSpace(prefs.Timezone)
+			// "Local" would be the server's zone, not the user's
+			if _, err := time.LoadLocation(name); err != nil || name == "" || name == "Local" {
+				return fmt.Errorf("timezone %q is not an IANA time zone such as Europe/Berlin", prefs.Timezone)
+			}
+			prefs.Timezone = name
+		case "notification_channels":
+			channels, err := normalizeChannels(prefs.NotificationChannels)
+			if err != nil {
+				return err
+			}
+			prefs.NotificationChannels = channels
+		case "marketing_email", "marketing_sms":
+		default:
+			return fmt.Errorf("unknown preference %q", field)
+		}
+	}
+	return nil
+}
+
+// normalizeChannels drops duplicates and lists channels in a fixed order; no channels is allowed
+func normalizeChannels(channels []string) ([]string, error) {
+	wanted := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		switch channel {
+		case models.NotificationEmail, models.NotificationSMS, models.NotificationPush:
+			wanted[channel] = true
+		default:
+			return nil, fmt.Errorf("notification channel %q must be email, sms or push", channel)
+		}
+	}
+
+	normalized := []string{}
+	for _, channel := range []string{models.NotificationEmail, models.NotificationSMS, models.NotificationPush} {
+		if wanted[channel] {
+			normalized = append(normalized, channel)
+		}
+	}
+	return normalized, nil
+}
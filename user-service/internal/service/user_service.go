@@ -1,22 +1,47 @@
 package service
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 	"user-service/internal/models"
+	"user-service/internal/postal"
 	"user-service/internal/repository"
 )
 
+// errAddressNotFound is returned for addresses that do not exist or belong to another user
+var errAddressNotFound = errors.New("address not found")
+
+// maxUserIDsPage caps how many IDs ListUserIDs returns at once
+const maxUserIDsPage = 1000
+
+// Page sizes of ListUsers
+const (
+	defaultUsersPage = 50
+	maxUsersPage     = 200
+)
+
+// errInvalidPageToken is returned for page tokens that were not issued for the same sort order
+var errInvalidPageToken = errors.New("invalid page token")
+
 // UserService contains business logic for user operations
 type UserService struct {
-	repo repository.UserRepository
+	repo        repository.UserRepository
+	preferences repository.PreferencesRepository
+	addresses   *postal.Validator
 }
 
 // NewUserService creates a new user service
-func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.UserRepository, preferences repository.PreferencesRepository, addresses *postal.Validator) *UserService {
+	return &UserService{repo: repo, preferences: preferences, addresses: addresses}
 }
 
-// CreateUser creates a new user profile
+// CreateUser creates a new user profile. It is idempotent: creating the same user ID and email again
+// returns the existing profile.
 func (s *UserService) CreateUser(userID, email, name, phone string) (*models.User, error) {
 	// Validation: email is required
 	if email == "" {
@@ -35,12 +60,24 @@ func (s *UserService) CreateUser(userID, email, name, phone string) (*models.Use
 		Phone: phone,
 	}
 
-	err := s.repo.CreateUser(user)
+	created, err := s.repo.CreateUser(user)
 	if err != nil {
 		return nil, err
 	}
+	if created {
+		return user, nil
+	}
 
-	return user, nil
+	// Auth-service retries creations it is unsure about; the same request returns the existing profile
+	existing, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil || existing.Email != email {
+		return nil, errors.New("a different user with this ID already exists")
+	}
+
+	return existing, nil
 }
 
 // GetUser retrieves a user by ID
@@ -61,13 +98,81 @@ func (s *UserService) GetUser(userID string) (*models.User, error) {
 	return user, nil
 }
 
-// UpdateUser updates user information
-func (s *UserService) UpdateUser(userID, name, phone string) (*models.User, error) {
+// UserUpdate is a partial update of a profile; nil fields are left unchanged
+type UserUpdate struct {
+	Name            *string
+	Phone           *string
+	ExpectedVersion int64 // The version the caller based the update on; 0 skips the check
+}
+
+// ErrVersionConflict is returned when a profile has changed since the version an update was based on
+var ErrVersionConflict = errors.New("the profile was changed by someone else; reload it and try again")
+
+// updateUserAttempts bounds retries of updates without an expected version that race with another write
+const updateUserAttempts = 3
+
+// UpdateUser applies a partial update. If the profile is no longer at update.ExpectedVersion, it returns
+// the current profile with ErrVersionConflict. Updates without an expected version still never overwrite
+// a concurrent change to a field they do not set: they are retried on the new version instead.
+func (s *UserService) UpdateUser(userID string, update UserUpdate) (*models.User, error) {
 	if userID == "" {
 		return nil, errors.New("user ID is required")
 	}
-	user, err := s.repo.GetUserByID(userID)
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+
+	for attempt := 1; ; attempt++ {
+		user, err := s.repo.GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, errors.New("user not found")
+		}
+		if update.ExpectedVersion != 0 && user.Version != update.ExpectedVersion {
+			return user, ErrVersionConflict
+		}
 
+		if update.Name != nil {
+			user.Name = strings.TrimSpace(*update.Name)
+		}
+		if update.Phone != nil {
+			user.Phone = strings.TrimSpace(*update.Phone)
+		}
+
+		updated, err := s.repo.UpdateUser(user)
+		if err != nil {
+			return nil, err
+		}
+		if updated {
+			return user, nil
+		}
+
+		// Changed or deleted since it was read
+		if update.ExpectedVersion != 0 || attempt == updateUserAttempts {
+			current, err := s.repo.GetUserByID(userID)
+			if err != nil {
+				return nil, err
+			}
+			if current == nil {
+				return nil, errors.New("user not found")
+			}
+			return current, ErrVersionConflict
+		}
+	}
+}
+
+// UpdateEmail sets the email address auth-service has verified for the user
+func (s *UserService) UpdateEmail(userID, email string) (*models.User, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+	if email == "" {
+		return nil, errors.New("email is required")
+	}
+
+	user, err := s.repo.GetUserByID(userID)
 	if err != nil {
 		return nil, err
 	}
@@ -75,13 +180,14 @@ func (s *UserService) UpdateUser(userID, name, phone string) (*models.User, erro
 		return nil, errors.New("user not found")
 	}
 
-	user.Name = name
-	user.Phone = phone
-
-	err_update := s.repo.UpdateUser(user)
+	// Retries from auth-service may send the same address again
+	if user.Email == email {
+		return user, nil
+	}
 
-	if err_update != nil {
-		return nil, err_update
+	user.Email = email
+	if err := s.repo.UpdateEmail(user); err != nil {
+		return nil, err
 	}
 
 	return user, nil
@@ -98,32 +204,176 @@ func (s *UserService) DeleteUser(userID string) error {
 	return err
 }
 
-// AddAddress adds a new address for a user
-func (s *UserService) AddAddress(userID, street, city, state, postalCode, country string, isDefault bool) (*models.Address, error) {
-	// Validation
+// UndeleteUser restores a soft-deleted user. Restoring a user that is not deleted returns it unchanged.
+func (s *UserService) UndeleteUser(userID string) (*models.User, error) {
 	if userID == "" {
 		return nil, errors.New("user ID is required")
 	}
-	if street == "" || city == "" || postalCode == "" || country == "" {
-		return nil, errors.New("street, city, postal code, and country are required")
-	}
 
-	address := &models.Address{
-		UserID:     userID,
-		Street:     street,
-		City:       city,
-		State:      state,
-		PostalCode: postalCode,
-		Country:    country,
-		IsDefault:  isDefault,
+	if err := s.repo.UndeleteUser(userID); err != nil {
+		return nil, err
 	}
 
-	err := s.repo.AddAddress(address)
+	user, err := s.repo.GetUserByID(userID)
 	if err != nil {
 		return nil, err
 	}
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
 
-	return address, nil
+	return user, nil
+}
+
+// PurgeUser removes a user and their addresses for good; unknown IDs are not an error
+func (s *UserService) PurgeUser(userID string) error {
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	return s.repo.PurgeUser(userID)
+}
+
+// ListUserIDs pages through every user ID, including soft-deleted users
+func (s *UserService) ListUserIDs(afterID string, limit int) ([]string, error) {
+	if limit <= 0 || limit > maxUserIDsPage {
+		limit = maxUserIDsPage
+	}
+
+	return s.repo.ListUserIDs(afterID, limit)
+}
+
+// ListUsers returns a page of users for the back office and how many users match in total.
+// pageToken is empty for the first page; nextPageToken is empty once there are no more users.
+func (s *UserService) ListUsers(query repository.UserListQuery, pageToken string) (users []*models.User, nextPageToken string, total int, err error) {
+	if query.SortBy == "" {
+		query.SortBy = repository.UserSortCreatedAt
+	}
+	switch query.SortBy {
+	case repository.UserSortCreatedAt, repository.UserSortEmail, repository.UserSortName:
+	default:
+		return nil, "", 0, errors.New("sort must be created_at, email or name")
+	}
+
+	if query.CreatedAfter != nil && query.CreatedBefore != nil && !query.CreatedAfter.Before(*query.CreatedBefore) {
+		return nil, "", 0, errors.New("created_after must be before created_before")
+	}
+
+	pageSize := query.Limit
+	if pageSize <= 0 {
+		pageSize = defaultUsersPage
+	}
+	if pageSize > maxUsersPage {
+		pageSize = maxUsersPage
+	}
+
+	if pageToken != "" {
+		query.After, err = decodePageToken(pageToken, query.SortBy, query.Descending)
+		if err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	// One extra user tells whether there is another page
+	query.Limit = pageSize + 1
+	users, total, err = s.repo.ListUsers(query)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		nextPageToken = encodePageToken(users[pageSize-1], query.SortBy, query.Descending)
+	}
+
+	return users, nextPageToken, total, nil
+}
+
+// pageToken is the content of a ListUsers page token. It records the sort order it was issued for,
+// so it cannot be replayed against another order.
+type pageToken struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	ID         string `json:"i"`
+}
+
+// encodePageToken makes the token for the page after user
+func encodePageToken(user *models.User, sortBy string, descending bool) string {
+	token := pageToken{SortBy: sortBy, Descending: descending, ID: user.ID}
+	switch sortBy {
+	case repository.UserSortEmail:
+		token.Value = user.Email
+	case repository.UserSortName:
+		token.Value = user.Name
+	default:
+		token.Value = user.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageToken reads a token made by encodePageToken for the same sort order
+func decodePageToken(raw, sortBy string, descending bool) (*repository.UserCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errInvalidPageToken
+	}
+
+	var token pageToken
+	if err := json.Unmarshal(data, &token); err != nil || token.ID == "" {
+		return nil, errInvalidPageToken
+	}
+	if token.SortBy != sortBy || token.Descending != descending {
+		return nil, errInvalidPageToken
+	}
+	if sortBy == repository.UserSortCreatedAt {
+		if _, err := time.Parse(time.RFC3339Nano, token.Value); err != nil {
+			return nil, errInvalidPageToken
+		}
+	}
+
+	return &repository.UserCursor{Value: token.Value, ID: token.ID}, nil
+}
+
+// AddressInput holds the fields of an address a user can set
+type AddressInput struct {
+	Type          string // models.AddressTypeShipping, AddressTypeBilling or AddressTypeBoth (the default)
+	Label         string
+	RecipientName string
+	Phone         string
+	Street        string
+	City          string
+	State         string
+	PostalCode    string
+	Country       string
+	IsDefault     *bool // Default for every purpose the type covers; nil keeps the current defaults
+}
+
+// maxLabelLength caps address labels such as "Home" or "Office"
+const maxLabelLength = 50
+
+// AddAddress normalizes, validates and adds a new address for a user. Suggestions from address
+// verification are returned for the user to apply; the address is saved as given either way.
+func (s *UserService) AddAddress(ctx context.Context, userID string, input AddressInput) (*models.Address, []postal.Suggestion, error) {
+	// Validation
+	if userID == "" {
+		return nil, nil, errors.New("user ID is required")
+	}
+
+	address := &models.Address{UserID: userID}
+	suggestions, err := s.applyAddressInput(ctx, address, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.repo.AddAddress(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return address, suggestions, nil
 }
 
 // GetAddresses retrieves all addresses for a user
@@ -134,3 +384,127 @@ func (s *UserService) GetAddresses(userID string) ([]*models.Address, error) {
 
 	return s.repo.GetAddressesByUserID(userID)
 }
+
+// GetAddress retrieves one of a user's addresses
+func (s *UserService) GetAddress(userID, addressID string) (*models.Address, error) {
+	if userID == "" || addressID == "" {
+		return nil, errors.New("user ID and address ID are required")
+	}
+
+	address, err := s.repo.GetAddressByID(userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+	if address == nil {
+		return nil, errAddressNotFound
+	}
+
+	return address, nil
+}
+
+// UpdateAddress replaces every field of an address, validated like in AddAddress. Without IsDefault
+// the address keeps the defaults its type still allows.
+func (s *UserService) UpdateAddress(ctx context.Context, userID, addressID string, input AddressInput) (*models.Address, []postal.Suggestion, error) {
+	address, err := s.GetAddress(userID, addressID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	suggestions, err := s.applyAddressInput(ctx, address, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.repo.UpdateAddress(address); err != nil {
+		return nil, nil, err
+	}
+
+	return address, suggestions, nil
+}
+
+// DeleteAddress removes one of a user's addresses
+func (s *UserService) DeleteAddress(userID, addressID string) error {
+	if userID == "" || addressID == "" {
+		return errors.New("user ID and address ID are required")
+	}
+
+	deleted, err := s.repo.DeleteAddress(userID, addressID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errAddressNotFound
+	}
+
+	return nil
+}
+
+// SetDefaultAddress makes one of a user's addresses the default for addressType ("shipping" or "billing"),
+// or for every purpose it covers if addressType is empty
+func (s *UserService) SetDefaultAddress(userID, addressID, addressType string) (*models.Address, error) {
+	address, err := s.GetAddress(userID, addressID)
+	if err != nil {
+		return nil, err
+	}
+
+	shipping, billing := address.ForShipping(), address.ForBilling()
+	switch addressType {
+	case "":
+	case models.AddressTypeShipping:
+		if !shipping {
+			return nil, errors.New("address is not a shipping address")
+		}
+		billing = false
+	case models.AddressTypeBilling:
+		if !billing {
+			return nil, errors.New("address is not a billing address")
+		}
+		shipping = false
+	default:
+		return nil, errors.New("type must be shipping or billing")
+	}
+
+	found, err := s.repo.SetDefaultAddress(userID, addressID, shipping, billing)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errAddressNotFound
+	}
+
+	return s.GetAddress(userID, addressID)
+}
+
+// applyAddressInput copies the input onto the address, then normalizes and validates it
+func (s *UserService) applyAddressInput(ctx context.Context, address *models.Address, input AddressInput) ([]postal.Suggestion, error) {
+	switch input.Type {
+	case "":
+		input.Type = models.AddressTypeBoth
+	case models.AddressTypeShipping, models.AddressTypeBilling, models.AddressTypeBoth:
+	default:
+		return nil, errors.New("type must be shipping, billing or both")
+	}
+
+	input.Label = strings.TrimSpace(input.Label)
+	if len([]rune(input.Label)) > maxLabelLength {
+		return nil, fmt.Errorf("label must be at most %d characters", maxLabelLength)
+	}
+
+	address.Type = input.Type
+	address.Label = input.Label
+	address.RecipientName = strings.TrimSpace(input.RecipientName)
+	address.Phone = strings.TrimSpace(input.Phone)
+	address.Street = input.Street
+	address.City = input.City
+	address.State = input.State
+	address.PostalCode = input.PostalCode
+	address.Country = input.Country
+	if input.IsDefault != nil {
+		address.IsDefaultShipping = *input.IsDefault
+		address.IsDefaultBilling = *input.IsDefault
+	}
+	address.IsDefaultShipping = address.IsDefaultShipping && address.ForShipping()
+	address.IsDefaultBilling = address.IsDefaultBilling && address.ForBilling()
+
+	return s.addresses.Validate(ctx, address)
+}
@@ -0,0 +1,415 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+	"user-service/internal/models"
+	"user-service/internal/postal"
+	"user-service/internal/repository"
+)
+
+// fakeUserRepo keeps users in a list, paging through them like the Postgres keyset query; methods
+// not needed by the tests panic
+type fakeUserRepo struct {
+	repository.UserRepository
+
+	users     []*models.User
+	addresses []*models.Address
+	queries   []repository.UserListQuery
+
+	// beforeUpdate runs before each UpdateUser, e.g. to simulate a concurrent write
+	beforeUpdate func(stored *models.User)
+}
+
+func (r *fakeUserRepo) GetUserByID(id string) (*models.User, error) {
+	for _, u := range r.users {
+		if u.ID == id {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+// UpdateUser only writes if the stored version is still the one the user was read at
+func (r *fakeUserRepo) UpdateUser(user *models.User) (bool, error) {
+	for _, stored := range r.users {
+		if stored.ID != user.ID {
+			continue
+		}
+		if r.beforeUpdate != nil {
+			r.beforeUpdate(stored)
+		}
+		if stored.Version != user.Version {
+			return false, nil
+		}
+		user.Version++
+		*stored = *user
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *fakeUserRepo) GetAddressByID(userID, addressID string) (*models.Address, error) {
+	for _, a := range r.addresses {
+		if a.ID == addressID && a.UserID == userID {
+			copied := *a
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+// UpdateAddress stores the address as given; moving defaults between addresses is the database's job
+func (r *fakeUserRepo) UpdateAddress(address *models.Address) error {
+	for _, stored := range r.addresses {
+		if stored.ID == address.ID {
+			*stored = *address
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) ListUsers(query repository.UserListQuery) ([]*models.User, int, error) {
+	r.queries = append(r.queries, query)
+
+	key := func(u *models.User) string {
+		switch query.SortBy {
+		case repository.UserSortEmail:
+			return u.Email
+		case repository.UserSortName:
+			return u.Name
+		default:
+			return u.CreatedAt.Format(time.RFC3339Nano)
+		}
+	}
+	// (value, id) pairs compare like the row comparison of the SQL query; the fixtures' times sort as text
+	less := func(a, b *models.User) bool {
+		if key(a) != key(b) {
+			return key(a) < key(b)
+		}
+		return a.ID < b.ID
+	}
+
+	sorted := append([]*models.User(nil), r.users...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if query.Descending {
+			return less(sorted[j], sorted[i])
+		}
+		return less(sorted[i], sorted[j])
+	})
+
+	var page []*models.User
+	for _, u := range sorted {
+		if after := query.After; after != nil {
+			cursor := &models.User{ID: after.ID, Email: after.Value, Name: after.Value}
+			if query.SortBy == repository.UserSortCreatedAt {
+				cursor.CreatedAt, _ = time.Parse(time.RFC3339Nano, after.Value)
+			}
+			if query.Descending && !less(u, cursor) || !query.Descending && !less(cursor, u) {
+				continue
+			}
+		}
+		if len(page) < query.Limit {
+			page = append(page, u)
+		}
+	}
+	return page, len(r.users), nil
+}
+
+func newListFixture(n int) *fakeUserRepo {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakeUserRepo{}
+	for i := range n {
+		repo.users = append(repo.users, &models.User{
+			ID:    fmt.Sprintf("user-%02d", i),
+			Email: fmt.Sprintf("%c@example.com", 'z'-i),
+			// Pairs of users share a name and a creation time, so the ID has to break ties
+			Name:      fmt.Sprintf("User %d", i/2),
+			CreatedAt: created.Add(time.Duration(i/2) * time.Second),
+		})
+	}
+	return repo
+}
+
+func TestListUsersPagesThroughEveryUser(t *testing.T) {
+	tests := []struct {
+		sortBy     string
+		descending bool
+	}{
+		{repository.UserSortCreatedAt, false},
+		{repository.UserSortCreatedAt, true},
+		{repository.UserSortEmail, false},
+		{repository.UserSortName, false},
+		{repository.UserSortName, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s descending=%v", tt.sortBy, tt.descending), func(t *testing.T) {
+			repo := newListFixture(7)
+			svc := NewUserService(repo, nil, nil)
+			query := repository.UserListQuery{SortBy: tt.sortBy, Descending: tt.descending, Limit: 3}
+
+			// One query for everything tells which order the pages should add up to
+			all, _, _ := repo.ListUsers(repository.UserListQuery{SortBy: tt.sortBy, Descending: tt.descending, Limit: 100})
+
+			var seen []*models.User
+			pageToken := ""
+			for pages := 1; ; pages++ {
+				users, next, total, err := svc.ListUsers(query, pageToken)
+				if err != nil {
+					t.Fatalf("page %d: %v", pages, err)
+				}
+				if total != 7 {
+					t.Errorf("page %d: total = %d, want 7", pages, total)
+				}
+				seen = append(seen, users...)
+				if next == "" {
+					break
+				}
+				if pages > 7 {
+					t.Fatal("paging does not end")
+				}
+				pageToken = next
+			}
+
+			if len(seen) != len(all) {
+				t.Fatalf("paged through %d users, want %d", len(seen), len(all))
+			}
+			for i := range all {
+				if seen[i].ID != all[i].ID {
+					t.Errorf("user %d = %s, want %s", i, seen[i].ID, all[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestListUsersPageSize(t *testing.T) {
+	tests := []struct {
+		limit     int
+		wantLimit int // Limit asked of the repository, one more than the page size
+	}{
+		{limit: 0, wantLimit: defaultUsersPage + 1},
+		{limit: -1, wantLimit: defaultUsersPage + 1},
+		{limit: 10, wantLimit: 11},
+		{limit: maxUsersPage + 1, wantLimit: maxUsersPage + 1},
+	}
+
+	for _, tt := range tests {
+		repo := newListFixture(0)
+		if _, _, _, err := NewUserService(repo, nil, nil).ListUsers(repository.UserListQuery{Limit: tt.limit}, ""); err != nil {
+			t.Fatalf("ListUsers: %v", err)
+		}
+		if got := repo.queries[0].Limit; got != tt.wantLimit {
+			t.Errorf("limit %d: repository asked for %d users, want %d", tt.limit, got, tt.wantLimit)
+		}
+	}
+}
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	user := &models.User{
+		ID:        "user-1",
+		Email:     "jane@example.com",
+		Name:      "Jane",
+		CreatedAt: time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC),
+	}
+
+	tests := []struct {
+		sortBy string
+		want   repository.UserCursor
+	}{
+		{repository.UserSortCreatedAt, repository.UserCursor{Value: "2024-05-06T07:08:09.123456789Z", ID: "user-1"}},
+		{repository.UserSortEmail, repository.UserCursor{Value: "jane@example.com", ID: "user-1"}},
+		{repository.UserSortName, repository.UserCursor{Value: "Jane", ID: "user-1"}},
+	}
+
+	for _, tt := range tests {
+		for _, descending := range []bool{false, true} {
+			cursor, err := decodePageToken(encodePageToken(user, tt.sortBy, descending), tt.sortBy, descending)
+			if err != nil {
+				t.Fatalf("%s descending=%v: %v", tt.sortBy, descending, err)
+			}
+			if *cursor != tt.want {
+				t.Errorf("%s descending=%v: cursor = %+v, want %+v", tt.sortBy, descending, *cursor, tt.want)
+			}
+		}
+	}
+}
+
+func TestDecodePageTokenRejects(t *testing.T) {
+	user := &models.User{ID: "user-1", Email: "jane@example.com", CreatedAt: time.Now()}
+	encode := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+
+	tests := []struct {
+		name       string
+		token      string
+		sortBy     string
+		descending bool
+	}{
+		{name: "not base64", token: "not a token!", sortBy: repository.UserSortCreatedAt},
+		{name: "not JSON", token: encode("user-1"), sortBy: repository.UserSortCreatedAt},
+		{name: "no ID", token: encode(`{"s":"email","v":"jane@example.com"}`), sortBy: repository.UserSortEmail},
+		{name: "another sort", token: encodePageToken(user, repository.UserSortEmail, false), sortBy: repository.UserSortName},
+		{name: "another direction", token: encodePageToken(user, repository.UserSortEmail, false), sortBy: repository.UserSortEmail, descending: true},
+		{name: "creation time that is not a time", token: encode(`{"s":"created_at","v":"yesterday","i":"user-1"}`), sortBy: repository.UserSortCreatedAt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodePageToken(tt.token, tt.sortBy, tt.descending); !errors.Is(err, errInvalidPageToken) {
+				t.Errorf("decodePageToken error = %v, want %v", err, errInvalidPageToken)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name         string
+		update       UserUpdate
+		beforeUpdate func(stored *models.User)
+		want         models.User // Name, Phone and Version of the stored profile afterwards
+		wantErr      error
+		wantProblem  string // Error message expected when wantErr is not a sentinel
+	}{
+		{
+			name:   "name only keeps the phone",
+			update: UserUpdate{Name: str("  Janet ")},
+			want:   models.User{Name: "Janet", Phone: "+15550100", Version: 4},
+		},
+		{
+			name:   "phone only keeps the name",
+			update: UserUpdate{Phone: str("")},
+			want:   models.User{Name: "Jane", Phone: "", Version: 4},
+		},
+		{
+			name:   "both fields",
+			update: UserUpdate{Name: str("Janet"), Phone: str("+15550199")},
+			want:   models.User{Name: "Janet", Phone: "+15550199", Version: 4},
+		},
+		{
+			name:        "empty name",
+			update:      UserUpdate{Name: str(" ")},
+			want:        models.User{Name: "Jane", Phone: "+15550100", Version: 3},
+			wantProblem: "name cannot be empty",
+		},
+		{
+			name:   "expected version matches",
+			update: UserUpdate{Name: str("Janet"), ExpectedVersion: 3},
+			want:   models.User{Name: "Janet", Phone: "+15550100", Version: 4},
+		},
+		{
+			name:    "expected version is stale",
+			update:  UserUpdate{Name: str("Janet"), ExpectedVersion: 2},
+			want:    models.User{Name: "Jane", Phone: "+15550100", Version: 3},
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:   "concurrent write is kept and the update retried",
+			update: UserUpdate{Name: str("Janet")},
+			beforeUpdate: func(stored *models.User) {
+				if stored.Version == 3 {
+					stored.Phone, stored.Version = "+15550142", 4
+				}
+			},
+			want: models.User{Name: "Janet", Phone: "+15550142", Version: 5},
+		},
+		{
+			name:   "concurrent write with an expected version",
+			update: UserUpdate{Name: str("Janet"), ExpectedVersion: 3},
+			beforeUpdate: func(stored *models.User) {
+				if stored.Version == 3 {
+					stored.Phone, stored.Version = "+15550142", 4
+				}
+			},
+			want:    models.User{Name: "Jane", Phone: "+15550142", Version: 4},
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:   "writes racing every attempt",
+			update: UserUpdate{Name: str("Janet")},
+			beforeUpdate: func(stored *models.User) {
+				stored.Version++
+			},
+			want:    models.User{Name: "Jane", Phone: "+15550100", Version: 3 + updateUserAttempts},
+			wantErr: ErrVersionConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepo{
+				users:        []*models.User{{ID: "user-1", Email: "jane@example.com", Name: "Jane", Phone: "+15550100", Version: 3}},
+				beforeUpdate: tt.beforeUpdate,
+			}
+
+			user, err := NewUserService(repo, nil, nil).UpdateUser("user-1", tt.update)
+			switch {
+			case tt.wantProblem != "":
+				if err == nil || err.Error() != tt.wantProblem {
+					t.Fatalf("UpdateUser error = %v, want %q", err, tt.wantProblem)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("UpdateUser error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored := repo.users[0]
+			if got := (models.User{Name: stored.Name, Phone: stored.Phone, Version: stored.Version}); got != tt.want {
+				t.Errorf("stored profile = %+v, want %+v", got, tt.want)
+			}
+			// Conflicts return the current profile so the caller can show what changed
+			if user != nil && (user.Name != stored.Name || user.Phone != stored.Phone || user.Version != stored.Version) {
+				t.Errorf("returned profile = %+v, want the stored %+v", *user, *stored)
+			}
+		})
+	}
+}
+
+func TestUpdateAddressDefaults(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name         string
+		storedType   string
+		newType      string
+		isDefault    *bool
+		wantShipping bool
+		wantBilling  bool
+	}{
+		{name: "is_default left out", storedType: models.AddressTypeBoth, newType: models.AddressTypeBoth, wantShipping: true, wantBilling: true},
+		{name: "is_default left out, type narrowed", storedType: models.AddressTypeBoth, newType: models.AddressTypeBilling, wantBilling: true},
+		{name: "is_default false", storedType: models.AddressTypeBoth, newType: models.AddressTypeBoth, isDefault: &no},
+		{name: "is_default true", storedType: models.AddressTypeShipping, newType: models.AddressTypeBoth, isDefault: &yes, wantShipping: true, wantBilling: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepo{addresses: []*models.Address{{
+				ID: "address-1", UserID: "user-1", Type: tt.storedType,
+				Street: "1 Main St", City: "Springfield", Country: "IE",
+				IsDefaultShipping: tt.storedType != models.AddressTypeBilling,
+				IsDefaultBilling:  tt.storedType != models.AddressTypeShipping,
+			}}}
+			svc := NewUserService(repo, nil, postal.NewValidator(nil))
+
+			address, _, err := svc.UpdateAddress(context.Background(), "user-1", "address-1", AddressInput{
+				Type: tt.newType, Street: "2 Main St", City: "Springfield", Country: "IE", IsDefault: tt.isDefault,
+			})
+			if err != nil {
+				t.Fatalf("UpdateAddress: %v", err)
+			}
+			if address.IsDefaultShipping != tt.wantShipping || address.IsDefaultBilling != tt.wantBilling {
+				t.Errorf("defaults = shipping %v, billing %v; want %v, %v",
+					address.IsDefaultShipping, address.IsDefaultBilling, tt.wantShipping, tt.wantBilling)
+			}
+		})
+	}
+}
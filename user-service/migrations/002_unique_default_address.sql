@@ -0,0 +1,14 @@
+-- A user has at most one default address.
+-- Existing duplicates keep only their most recent default.
+UPDATE addresses a SET is_default = FALSE
+WHERE a.is_default AND EXISTS (
+    SELECT 1 FROM addresses newer
+    WHERE newer.user_id = a.user_id
+      AND newer.is_default
+      AND (newer.created_at, newer.id) > (a.created_at, a.id)
+);
+
+UPDATE addresses SET is_default = FALSE WHERE is_default IS NULL;
+ALTER TABLE addresses ALTER COLUMN is_default SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_one_default ON addresses(user_id) WHERE is_default;
@@ -0,0 +1,21 @@
+-- Addresses are for shipping, billing or both, with a label, recipient and phone of their own.
+-- Each user has at most one default shipping and one default billing address.
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'both';
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS label VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS recipient_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS phone VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS is_default_shipping BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS is_default_billing BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Existing addresses become "both", so the old default is the default for both purposes
+UPDATE addresses SET is_default_shipping = is_default, is_default_billing = is_default;
+
+DROP INDEX IF EXISTS idx_addresses_one_default;
+ALTER TABLE addresses DROP COLUMN IF EXISTS is_default;
+
+ALTER TABLE addresses ADD CONSTRAINT addresses_type_check CHECK (type IN ('shipping', 'billing', 'both'));
+ALTER TABLE addresses ADD CONSTRAINT addresses_default_shipping_check CHECK (NOT is_default_shipping OR type IN ('shipping', 'both'));
+ALTER TABLE addresses ADD CONSTRAINT addresses_default_billing_check CHECK (NOT is_default_billing OR type IN ('billing', 'both'));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_shipping ON addresses(user_id) WHERE is_default_shipping;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_billing ON addresses(user_id) WHERE is_default_billing;
@@ -0,0 +1,16 @@
+-- Countries are stored as ISO 3166-1 alpha-2 codes. Addresses saved before validation keep whatever
+-- was typed; the common spellings are normalized here, anything else is fixed on the next update.
+-- Every spelling below must normalize to the same code in internal/postal (checked by its tests).
+UPDATE addresses SET country = 'US'
+WHERE lower(replace(country, '.', '')) IN ('us', 'usa', 'united states', 'united states of america', 'america');
+
+UPDATE addresses SET country = 'GB'
+WHERE lower(replace(country, '.', '')) IN ('gb', 'uk', 'united kingdom', 'great britain', 'england', 'scotland', 'wales');
+
+UPDATE addresses SET country = 'CA' WHERE lower(country) IN ('ca', 'can', 'canada');
+UPDATE addresses SET country = 'DE' WHERE lower(country) IN ('de', 'deu', 'germany', 'deutschland');
+UPDATE addresses SET country = 'FR' WHERE lower(country) IN ('fr', 'fra', 'france');
+UPDATE addresses SET country = 'AU' WHERE lower(country) IN ('au', 'aus', 'australia');
+
+-- Remaining two-letter values are most likely codes in the wrong case
+UPDATE addresses SET country = upper(country) WHERE length(country) = 2 AND country <> upper(country);
@@ -0,0 +1,3 @@
+-- Every profile change increments version; clients send it back (If-Match) so concurrent edits
+-- are detected instead of overwriting each other.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+-- Preferences are only stored once a user changes one; until then the defaults apply
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id VARCHAR(255) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    locale VARCHAR(35) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    timezone VARCHAR(64) NOT NULL,
+    marketing_email BOOLEAN NOT NULL DEFAULT FALSE,
+    marketing_sms BOOLEAN NOT NULL DEFAULT FALSE,
+    notification_channels TEXT[] NOT NULL DEFAULT '{email}',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);